@@ -0,0 +1,455 @@
+package mkot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+	olog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Attributes edits the attributes of spans and log records before they are
+// exported, like the collector's attributes processor. The actions run in
+// order on the items the include and exclude rules select.
+//
+// The SDK hands every processor the same span or record, so it wraps the
+// processor of each exporter rather than being installed beside them, and
+// runs in the order it is listed among the other such processors.
+type Attributes struct {
+	UnimplementedProcessorConfig `yaml:"-"`
+
+	Include *MatchConfig      `yaml:"include,omitempty"`
+	Exclude *MatchConfig      `yaml:"exclude,omitempty"`
+	Actions []AttributeAction `yaml:"actions"`
+}
+
+// AttributeAction is an edit of the attributes:
+//   - "insert" sets the key if it is not present;
+//   - "update" sets the key if it is present;
+//   - "upsert" sets the key;
+//   - "delete" removes the key, or every key Pattern matches;
+//   - "hash" replaces the value of the key, or of every key Pattern
+//     matches, with its SHA-256 in hex;
+//   - "extract" sets an attribute for each named group of Pattern, matched
+//     against the string value of the key.
+//
+// Insert, update, and upsert set Value, or the value of FromAttribute if it
+// is present.
+type AttributeAction struct {
+	Key           string `yaml:"key,omitempty"`
+	Action        string `yaml:"action"`
+	Value         any    `yaml:"value,omitempty"`
+	FromAttribute string `yaml:"from_attribute,omitempty"`
+	Pattern       string `yaml:"pattern,omitempty"`
+}
+
+func (c *Attributes) TracerOpts(ctx context.Context) ([]trace.TracerProviderOption, error) {
+	// The edits are wired by WrapSpanProcessor.
+	if _, err := c.editor("traces"); err != nil {
+		return nil, err
+	}
+	return []trace.TracerProviderOption{}, nil
+}
+
+func (c *Attributes) LoggerOpts(ctx context.Context) ([]log.LoggerProviderOption, error) {
+	// The edits are wired by WrapLogProcessor.
+	if _, err := c.editor("logs"); err != nil {
+		return nil, err
+	}
+	return []log.LoggerProviderOption{}, nil
+}
+
+func (c *Attributes) WrapSpanProcessor(ctx context.Context, p trace.SpanProcessor) (trace.SpanProcessor, error) {
+	e, err := c.editor("traces")
+	if err != nil {
+		return nil, err
+	}
+	return attributesSpanProcessor{p, e}, nil
+}
+
+func (c *Attributes) WrapLogProcessor(ctx context.Context, p log.Processor) (log.Processor, error) {
+	e, err := c.editor("logs")
+	if err != nil {
+		return nil, err
+	}
+	return attributesLogProcessor{p, e}, nil
+}
+
+type attrEditor struct {
+	selector
+	actions []attrAction
+}
+
+type attrAction struct {
+	action  string
+	key     string
+	value   attribute.Value
+	from    string
+	pattern *regexp.Regexp
+}
+
+func (c *Attributes) editor(signal string) (*attrEditor, error) {
+	s, err := newSelector(c.Include, c.Exclude, signal)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &attrEditor{selector: s}
+	errs := []error{}
+	for i, v := range c.Actions {
+		a, err := v.compile()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("actions[%d]: %w", i, err))
+			continue
+		}
+		e.actions = append(e.actions, a)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (c AttributeAction) compile() (attrAction, error) {
+	a := attrAction{action: c.Action, key: c.Key, from: c.FromAttribute}
+	if c.Pattern != "" {
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return attrAction{}, fmt.Errorf("pattern: %w", err)
+		}
+		a.pattern = re
+	}
+
+	switch c.Action {
+	case "insert", "update", "upsert":
+		if c.Key == "" {
+			return attrAction{}, errors.New("key is required")
+		}
+		if (c.Value == nil) == (c.FromAttribute == "") {
+			return attrAction{}, errors.New("either value or from_attribute is required")
+		}
+		if c.Value != nil {
+			v, err := (&Attr{}).decodeValue(c.Value)
+			if err != nil {
+				return attrAction{}, fmt.Errorf("value: %w", err)
+			}
+			a.value = v
+		}
+	case "delete", "hash":
+		if c.Key == "" && c.Pattern == "" {
+			return attrAction{}, errors.New("key or pattern is required")
+		}
+	case "extract":
+		if c.Key == "" || a.pattern == nil {
+			return attrAction{}, errors.New("key and pattern are required")
+		}
+		if !slices.ContainsFunc(a.pattern.SubexpNames(), func(v string) bool { return v != "" }) {
+			return attrAction{}, errors.New("pattern has no named groups")
+		}
+	default:
+		return attrAction{}, fmt.Errorf("unknown action %q (want insert, update, upsert, delete, hash, or extract)", c.Action)
+	}
+	return a, nil
+}
+
+// keys reports if the action applies to the key.
+func (a *attrAction) keys(key string) bool {
+	return key == a.key || (a.pattern != nil && a.pattern.MatchString(key))
+}
+
+type keyValue[V any] struct {
+	key   string
+	value V
+}
+
+// valueKind converts the values of spans or of log records.
+type valueKind[V any] struct {
+	from   func(attribute.Value) V
+	of     func(string) V
+	int    func(int64) V
+	string func(V) (string, bool)
+	format func(V) string
+
+	// strings returns the value with each string in it, including those of
+	// slices and maps, replaced by f.
+	strings func(V, func(string) string) V
+}
+
+var spanValues = valueKind[attribute.Value]{
+	from: func(v attribute.Value) attribute.Value { return v },
+	of:   attribute.StringValue,
+	int:  attribute.Int64Value,
+	string: func(v attribute.Value) (string, bool) {
+		return v.AsString(), v.Type() == attribute.STRING
+	},
+	format:  attribute.Value.Emit,
+	strings: attrStrings,
+}
+
+var logValues = valueKind[olog.Value]{
+	from: attrToLog,
+	of:   olog.StringValue,
+	int:  olog.Int64Value,
+	string: func(v olog.Value) (string, bool) {
+		return v.AsString(), v.Kind() == olog.KindString
+	},
+	format:  olog.Value.String,
+	strings: logStrings,
+}
+
+func attrToLog(v attribute.Value) olog.Value {
+	switch v.Type() {
+	case attribute.BOOL:
+		return olog.BoolValue(v.AsBool())
+	case attribute.INT64:
+		return olog.Int64Value(v.AsInt64())
+	case attribute.FLOAT64:
+		return olog.Float64Value(v.AsFloat64())
+	case attribute.STRING:
+		return olog.StringValue(v.AsString())
+	case attribute.BYTESLICE:
+		return olog.BytesValue(v.AsByteSlice())
+	case attribute.BOOLSLICE:
+		return logSlice(v.AsBoolSlice(), olog.BoolValue)
+	case attribute.INT64SLICE:
+		return logSlice(v.AsInt64Slice(), olog.Int64Value)
+	case attribute.FLOAT64SLICE:
+		return logSlice(v.AsFloat64Slice(), olog.Float64Value)
+	case attribute.STRINGSLICE:
+		return logSlice(v.AsStringSlice(), olog.StringValue)
+	case attribute.SLICE:
+		return logSlice(v.AsSlice(), attrToLog)
+	default:
+		return olog.Value{}
+	}
+}
+
+func attrStrings(v attribute.Value, f func(string) string) attribute.Value {
+	switch v.Type() {
+	case attribute.STRING:
+		return attribute.StringValue(f(v.AsString()))
+	case attribute.STRINGSLICE:
+		ss := v.AsStringSlice()
+		for i, s := range ss {
+			ss[i] = f(s)
+		}
+		return attribute.StringSliceValue(ss)
+	case attribute.SLICE:
+		vs := v.AsSlice()
+		for i, v := range vs {
+			vs[i] = attrStrings(v, f)
+		}
+		return attribute.SliceValue(vs...)
+	default:
+		return v
+	}
+}
+
+func logStrings(v olog.Value, f func(string) string) olog.Value {
+	switch v.Kind() {
+	case olog.KindString:
+		return olog.StringValue(f(v.AsString()))
+	case olog.KindSlice:
+		vs := slices.Clone(v.AsSlice())
+		for i, v := range vs {
+			vs[i] = logStrings(v, f)
+		}
+		return olog.SliceValue(vs...)
+	case olog.KindMap:
+		kvs := slices.Clone(v.AsMap())
+		for i, kv := range kvs {
+			kvs[i].Value = logStrings(kv.Value, f)
+		}
+		return olog.MapValue(kvs...)
+	default:
+		return v
+	}
+}
+
+func logSlice[T any](vs []T, f func(T) olog.Value) olog.Value {
+	ls := make([]olog.Value, len(vs))
+	for i, v := range vs {
+		ls[i] = f(v)
+	}
+	return olog.SliceValue(ls...)
+}
+
+// edit applies the actions to kvs, which it may modify.
+func edit[V any](actions []attrAction, k valueKind[V], kvs []keyValue[V]) []keyValue[V] {
+	index := func(key string) int {
+		return slices.IndexFunc(kvs, func(kv keyValue[V]) bool { return kv.key == key })
+	}
+	set := func(key string, v V) {
+		if i := index(key); i >= 0 {
+			kvs[i].value = v
+		} else {
+			kvs = append(kvs, keyValue[V]{key, v})
+		}
+	}
+
+	for _, a := range actions {
+		switch a.action {
+		case "insert", "update", "upsert":
+			i := index(a.key)
+			if (a.action == "insert" && i >= 0) || (a.action == "update" && i < 0) {
+				continue
+			}
+			v := k.from(a.value)
+			if a.from != "" {
+				j := index(a.from)
+				if j < 0 {
+					continue
+				}
+				v = kvs[j].value
+			}
+			set(a.key, v)
+
+		case "delete":
+			kvs = slices.DeleteFunc(kvs, func(kv keyValue[V]) bool { return a.keys(kv.key) })
+
+		case "hash":
+			for i, kv := range kvs {
+				if a.keys(kv.key) {
+					sum := sha256.Sum256([]byte(k.format(kv.value)))
+					kvs[i].value = k.of(hex.EncodeToString(sum[:]))
+				}
+			}
+
+		case "extract":
+			i := index(a.key)
+			if i < 0 {
+				continue
+			}
+			s, ok := k.string(kvs[i].value)
+			if !ok {
+				continue
+			}
+			ms := a.pattern.FindStringSubmatch(s)
+			if ms == nil {
+				continue
+			}
+			for j, name := range a.pattern.SubexpNames() {
+				if name != "" {
+					set(name, k.of(ms[j]))
+				}
+			}
+		}
+	}
+	return kvs
+}
+
+type attributesSpanProcessor struct {
+	next trace.SpanProcessor
+	e    *attrEditor
+}
+
+func (p attributesSpanProcessor) OnStart(parent context.Context, s trace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p attributesSpanProcessor) OnEnd(s trace.ReadOnlySpan) {
+	if p.e.selects(spanItem(s)) {
+		kvs := edit(p.e.actions, spanValues, spanKeyValues(s))
+		s = editedSpan{s, spanAttrs(kvs)}
+	}
+	p.next.OnEnd(s)
+}
+
+func (p attributesSpanProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p attributesSpanProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+func (p attributesSpanProcessor) Pending() int64 {
+	return pendingOf(p.next)
+}
+
+func spanKeyValues(s trace.ReadOnlySpan) []keyValue[attribute.Value] {
+	kvs := []keyValue[attribute.Value]{}
+	for _, kv := range s.Attributes() {
+		kvs = append(kvs, keyValue[attribute.Value]{string(kv.Key), kv.Value})
+	}
+	return kvs
+}
+
+func spanAttrs(kvs []keyValue[attribute.Value]) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, len(kvs))
+	for i, kv := range kvs {
+		attrs[i] = attribute.KeyValue{Key: attribute.Key(kv.key), Value: kv.value}
+	}
+	return attrs
+}
+
+// editedSpan is a span with its attributes replaced.
+type editedSpan struct {
+	trace.ReadOnlySpan
+	attrs []attribute.KeyValue
+}
+
+func (s editedSpan) Attributes() []attribute.KeyValue {
+	return s.attrs
+}
+
+type attributesLogProcessor struct {
+	next log.Processor
+	e    *attrEditor
+}
+
+func (p attributesLogProcessor) Enabled(ctx context.Context, param log.EnabledParameters) bool {
+	return p.next.Enabled(ctx, param)
+}
+
+func (p attributesLogProcessor) OnEmit(ctx context.Context, r *log.Record) error {
+	if p.e.selects(recordItem(r)) {
+		// The record is shared with the processors of the other exporters.
+		r_ := r.Clone()
+		setRecordKeyValues(&r_, edit(p.e.actions, logValues, recordKeyValues(&r_)))
+		r = &r_
+	}
+	return p.next.OnEmit(ctx, r)
+}
+
+func recordKeyValues(r *log.Record) []keyValue[olog.Value] {
+	kvs := []keyValue[olog.Value]{}
+	r.WalkAttributes(func(kv olog.KeyValue) bool {
+		kvs = append(kvs, keyValue[olog.Value]{kv.Key, kv.Value})
+		return true
+	})
+	return kvs
+}
+
+func setRecordKeyValues(r *log.Record, kvs []keyValue[olog.Value]) {
+	attrs := make([]olog.KeyValue, len(kvs))
+	for i, kv := range kvs {
+		attrs[i] = olog.KeyValue{Key: kv.key, Value: kv.value}
+	}
+	r.SetAttributes(attrs...)
+}
+
+func (p attributesLogProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p attributesLogProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+func (p attributesLogProcessor) Pending() int64 {
+	return pendingOf(p.next)
+}
+
+func init() {
+	DefaultProcessorRegistry.Set("attributes", func() ProcessorConfig {
+		return &Attributes{}
+	})
+}
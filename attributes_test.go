@@ -0,0 +1,150 @@
+package mkot_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lesomnus/mkot"
+	"github.com/lesomnus/mkot/internal/x"
+	"go.opentelemetry.io/otel/attribute"
+	olog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	otrace "go.opentelemetry.io/otel/trace"
+)
+
+// componentExporterConfig exports spans and records as they end, through
+// components the processors can wrap.
+type componentExporterConfig struct {
+	mkot.UnimplementedExporterConfig `yaml:"-"`
+
+	spans   *tracetest.InMemoryExporter
+	records flakyLogExporter
+}
+
+func (c *componentExporterConfig) SpanExporter(ctx context.Context) (trace.SpanExporter, []trace.TracerProviderOption, error) {
+	c.spans = tracetest.NewInMemoryExporter()
+	p := trace.NewSimpleSpanProcessor(c.spans)
+	return mkot.SpanComponent(c.spans, p), []trace.TracerProviderOption{trace.WithSpanProcessor(p)}, nil
+}
+
+func (c *componentExporterConfig) LogExporter(ctx context.Context) (log.Exporter, []log.LoggerProviderOption, error) {
+	p := log.NewSimpleProcessor(&c.records)
+	return mkot.LogComponent(&c.records, p), []log.LoggerProviderOption{log.WithProcessor(p)}, nil
+}
+
+func hashOf(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAttributes(t *testing.T) {
+	ctx, x := x.New(t)
+
+	e := &componentExporterConfig{}
+	e2 := &componentExporterConfig{}
+	c := mkot.NewConfig()
+	err := yaml.Unmarshal([]byte(`
+processors:
+  attributes:
+    exclude:
+      attributes:
+        - key: keep
+    actions:
+      - key: http.request.header.cookie
+        action: delete
+      - key: user.email
+        action: hash
+      - key: deployment
+        action: insert
+        value: prod
+      - key: http.url
+        action: extract
+        pattern: ^(?P<url_scheme>\w+)://(?P<url_host>[^/]+)
+`), c)
+	x.NoError(err)
+	c.Exporters["e"] = e
+	c.Exporters["e2"] = e2
+	c.Providers = map[mkot.Id]*mkot.ProviderConfig{
+		"tracer": {Processors: []mkot.Id{"attributes"}, Exporters: []mkot.Id{"e"}},
+		"logger": {Processors: []mkot.Id{"attributes"}, Exporters: []mkot.Id{"e", "e2"}},
+	}
+	x.NoError(c.Validate(ctx))
+
+	r := mkot.Make(ctx, c)
+	tp, err := r.Tracer(ctx, "")
+	x.NoError(err)
+	lp, err := r.Logger(ctx, "")
+	x.NoError(err)
+
+	_, span := tp.Tracer("t").Start(ctx, "s", otrace.WithAttributes(
+		attribute.String("http.request.header.cookie", "secret"),
+		attribute.String("user.email", "dwight@dunder.com"),
+		attribute.String("http.url", "https://dunder.com/paper"),
+	))
+	span.End()
+	_, span = tp.Tracer("t").Start(ctx, "kept", otrace.WithAttributes(
+		attribute.Bool("keep", true),
+		attribute.String("user.email", "dwight@dunder.com"),
+	))
+	span.End()
+
+	rec := olog.Record{}
+	rec.AddAttributes(
+		olog.String("user.email", "dwight@dunder.com"),
+		olog.String("deployment", "dev"),
+	)
+	lp.Logger("l").Emit(ctx, rec)
+
+	spans := e.spans.GetSpans()
+	x.Eq(2, len(spans))
+	x.Eq([]attribute.KeyValue{
+		attribute.String("user.email", hashOf("dwight@dunder.com")),
+		attribute.String("http.url", "https://dunder.com/paper"),
+		attribute.String("deployment", "prod"),
+		attribute.String("url_scheme", "https"),
+		attribute.String("url_host", "dunder.com"),
+	}, spans[0].Attributes)
+	x.Eq([]attribute.KeyValue{
+		attribute.Bool("keep", true),
+		attribute.String("user.email", "dwight@dunder.com"),
+	}, spans[1].Attributes)
+
+	// Each exporter gets the record edited once.
+	for _, e := range []*componentExporterConfig{e, e2} {
+		x.Eq(1, len(e.records.records))
+		attrs := map[string]string{}
+		e.records.records[0].WalkAttributes(func(kv olog.KeyValue) bool {
+			attrs[kv.Key] = kv.Value.AsString()
+			return true
+		})
+		x.Eq(map[string]string{
+			"user.email": hashOf("dwight@dunder.com"),
+			"deployment": "dev",
+		}, attrs)
+	}
+	x.NoError(r.Shutdown(ctx))
+}
+
+func TestAttributesInvalid(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := mkot.NewConfig()
+	c.Processors["attributes"] = &mkot.Attributes{
+		Actions: []mkot.AttributeAction{{Key: "k", Action: "rename"}},
+	}
+	c.Processors["attributes/logs"] = &mkot.Attributes{
+		Include: &mkot.MatchConfig{SpanNames: []string{"s"}},
+	}
+	c.Exporters["e"] = &componentExporterConfig{}
+	c.Providers["tracer"] = &mkot.ProviderConfig{Processors: []mkot.Id{"attributes"}, Exporters: []mkot.Id{"e"}}
+	c.Providers["logger"] = &mkot.ProviderConfig{Processors: []mkot.Id{"attributes/logs"}, Exporters: []mkot.Id{"e"}}
+
+	err := c.Validate(ctx)
+	x.Contains(err.Error(), `processor "attributes": actions[0]: unknown action "rename"`)
+	x.Contains(err.Error(), `processor "attributes/logs": include: span_names does not apply to logs`)
+}
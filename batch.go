@@ -0,0 +1,76 @@
+package mkot
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Batch batches the spans or log records of every exporter a provider lists,
+// in place of the exporters' own sending queues, like the collector's batch
+// processor. Each exporter gets a batcher of its own with the same policy. An
+// exporter whose sending queue has storage cannot be listed with it, since
+// its storage would be bypassed.
+type Batch struct {
+	UnimplementedProcessorConfig `yaml:"-"`
+
+	// Timeout is the time after which a batch is sent regardless of its size.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+
+	// SendBatchSize is the number of items after which a batch is sent
+	// regardless of the timeout.
+	SendBatchSize int64 `yaml:"send_batch_size,omitempty"`
+
+	// SendBatchMaxSize is the upper limit of the size of a batch. Zero means
+	// SendBatchSize.
+	SendBatchMaxSize int64 `yaml:"send_batch_max_size,omitempty"`
+
+	// MaxQueueSize is the number of items that can wait to be batched. More
+	// are dropped.
+	MaxQueueSize int64 `yaml:"max_queue_size,omitempty"`
+}
+
+var errStorageBypassed = errors.New("its sending_queue storage would be bypassed by the batch processor")
+
+func (c *Batch) TracerOpts(ctx context.Context) ([]trace.TracerProviderOption, error) {
+	// The batcher is wired per exporter by SpanProcessor.
+	return []trace.TracerProviderOption{}, nil
+}
+
+func (c *Batch) LoggerOpts(ctx context.Context) ([]log.LoggerProviderOption, error) {
+	// The batcher is wired per exporter by LogProcessor.
+	return []log.LoggerProviderOption{}, nil
+}
+
+func (c *Batch) SpanProcessor(ctx context.Context, v trace.SpanExporter) (trace.SpanProcessor, error) {
+	return c.queue().BuildSpanProcessor(v)
+}
+
+func (c *Batch) LogProcessor(ctx context.Context, v log.Exporter) (log.Processor, error) {
+	return c.queue().BuildLogProcessor(v)
+}
+
+// queue returns the sending queue that batches as c does.
+func (c *Batch) queue() QueueConfig {
+	max_size := c.SendBatchMaxSize
+	if max_size == 0 {
+		max_size = c.SendBatchSize
+	}
+	return QueueConfig{
+		QueueSize: c.MaxQueueSize,
+		Batch: BatchConfig{
+			FlushTimeout: c.Timeout,
+			MinSize:      c.SendBatchSize,
+			MaxSize:      max_size,
+		},
+	}
+}
+
+func init() {
+	DefaultProcessorRegistry.Set("batch", func() ProcessorConfig {
+		return &Batch{}
+	})
+}
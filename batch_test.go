@@ -0,0 +1,137 @@
+package mkot_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lesomnus/mkot"
+	"github.com/lesomnus/mkot/internal/x"
+	olog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type recordingLogExporter struct {
+	records atomic.Int32
+}
+
+func (e *recordingLogExporter) Export(ctx context.Context, records []log.Record) error {
+	e.records.Add(int32(len(records)))
+	return nil
+}
+
+func (e *recordingLogExporter) Shutdown(context.Context) error   { return nil }
+func (e *recordingLogExporter) ForceFlush(context.Context) error { return nil }
+
+type recordingLogExporterConfig struct {
+	mkot.UnimplementedExporterConfig `yaml:"-"`
+
+	exporter recordingLogExporter
+}
+
+func (c *recordingLogExporterConfig) LogExporter(ctx context.Context) (log.Exporter, []log.LoggerProviderOption, error) {
+	return &c.exporter, []log.LoggerProviderOption{log.WithProcessor(log.NewSimpleProcessor(&c.exporter))}, nil
+}
+
+func TestBatch(t *testing.T) {
+	ctx, x := x.New(t)
+
+	spans_a := &inMemoryExporterConfig{}
+	spans_b := &inMemoryExporterConfig{}
+	logs_a := &recordingLogExporterConfig{}
+	logs_b := &recordingLogExporterConfig{}
+
+	c := mkot.NewConfig()
+	err := yaml.Unmarshal([]byte(`
+processors:
+  batch:
+    timeout: 1h
+    send_batch_size: 100
+    max_queue_size: 1000
+`), c)
+	x.NoError(err)
+	c.Exporters["spans/a"] = spans_a
+	c.Exporters["spans/b"] = spans_b
+	c.Exporters["logs/a"] = logs_a
+	c.Exporters["logs/b"] = logs_b
+	c.Providers = map[mkot.Id]*mkot.ProviderConfig{
+		"tracer": {Processors: []mkot.Id{"batch"}, Exporters: []mkot.Id{"spans/a", "spans/b"}},
+		"logger": {Processors: []mkot.Id{"batch"}, Exporters: []mkot.Id{"logs/a", "logs/b"}},
+	}
+	x.NoError(c.Validate(ctx))
+
+	r := mkot.Make(ctx, c)
+	tp, err := r.Tracer(ctx, "")
+	x.NoError(err)
+	lp, err := r.Logger(ctx, "")
+	x.NoError(err)
+
+	_, span := tp.Tracer("t").Start(ctx, "s")
+	span.End()
+	lp.Logger("l").Emit(ctx, olog.Record{})
+
+	// Batched instead of exported by the exporters' own processors.
+	x.Eq(0, len(spans_a.exporter.GetSpans()))
+	x.Eq(int32(0), logs_a.exporter.records.Load())
+
+	x.NoError(r.ForceFlush(ctx))
+	x.Eq(1, len(spans_a.exporter.GetSpans()))
+	x.Eq(1, len(spans_b.exporter.GetSpans()))
+	x.Eq(int32(1), logs_a.exporter.records.Load())
+	x.Eq(int32(1), logs_b.exporter.records.Load())
+	x.NoError(r.Shutdown(ctx))
+}
+
+func TestBatchInvalid(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := mkot.NewConfig()
+	c.Processors["batch"] = &mkot.Batch{SendBatchSize: 20, SendBatchMaxSize: 10}
+	c.Processors["batch/other"] = &mkot.Batch{}
+	c.Exporters["spans"] = &inMemoryExporterConfig{}
+	c.Providers["tracer"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"spans"}, Processors: []mkot.Id{"batch"}}
+	c.Providers["tracer/two"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"spans"}, Processors: []mkot.Id{"batch/other", "batch/other"}}
+
+	err := c.Validate(ctx)
+	x.Contains(err.Error(), `$.providers.tracer/two.processors: processor "batch/other": only one processor can wire the exporters`)
+
+	r := mkot.Make(ctx, c)
+	_, err = r.Tracer(ctx, "")
+	x.Contains(err.Error(), "sending_queue: batch.min_size must not exceed batch.max_size")
+}
+
+type storedExporterConfig struct {
+	mkot.UnimplementedExporterConfig `yaml:"-"`
+
+	dir string
+}
+
+func (c *storedExporterConfig) SpanExporter(ctx context.Context) (trace.SpanExporter, []trace.TracerProviderOption, error) {
+	e := tracetest.NewInMemoryExporter()
+	p, err := mkot.QueueConfig{Storage: &mkot.StorageConfig{Directory: c.dir}}.BuildSpanProcessor(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mkot.SpanComponent(e, p), []trace.TracerProviderOption{trace.WithSpanProcessor(p)}, nil
+}
+
+func TestBatchStorage(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := mkot.NewConfig()
+	c.Processors["batch"] = &mkot.Batch{}
+	c.Exporters["stored"] = &storedExporterConfig{dir: t.TempDir()}
+	c.Providers["tracer"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"stored"}, Processors: []mkot.Id{"batch"}}
+
+	// The storage is not silently bypassed.
+	err := c.Validate(ctx)
+	x.Contains(err.Error(), `$.providers.tracer.exporters[0]: exporter "stored": its sending_queue storage would be bypassed by the batch processor`)
+
+	r := mkot.Make(ctx, c)
+	_, err = r.Tracer(ctx, "")
+	x.Contains(err.Error(), `exporter "stored": its sending_queue storage would be bypassed by the batch processor`)
+	x.NoError(r.Shutdown(ctx))
+}
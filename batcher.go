@@ -0,0 +1,604 @@
+package mkot
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	olog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// batcherDefaults are the sizes a [QueueConfig] leaves unset falls back to.
+// They are those of the SDK batch processors, so an unconfigured queue
+// behaves as before.
+type batcherDefaults struct {
+	queueSize    int64
+	maxSize      int64
+	flushTimeout time.Duration
+}
+
+var (
+	spanBatcherDefaults = batcherDefaults{queueSize: 2048, maxSize: 512, flushTimeout: 5 * time.Second}
+	logBatcherDefaults  = batcherDefaults{queueSize: 2048, maxSize: 512, flushTimeout: time.Second}
+)
+
+// itemCodec measures and serializes the items of a signal.
+type itemCodec[T any] struct {
+	signal string
+	bytes  func(T) int64
+	encode func([]T) ([]byte, error)
+	decode func([]byte) ([]T, error)
+}
+
+var (
+	spanCodec = itemCodec[trace.ReadOnlySpan]{"spans", spanBytes, encodeSpans, decodeSpans}
+	logCodec  = itemCodec[log.Record]{"logs", recordBytes, encodeRecords, decodeRecords}
+)
+
+// sizerOf returns the func that measures an item in the unit the sizer
+// names.
+func sizerOf[T any](name string, bytes func(T) int64) (func(T) int64, error) {
+	switch name {
+	case "", "items":
+		return func(T) int64 { return 1 }, nil
+	case "bytes":
+		return bytes, nil
+	default:
+		return nil, fmt.Errorf("unknown sizer %q", name)
+	}
+}
+
+// batcher is the queue behind a [QueueConfig]. Items wait in a bounded queue
+// until a consumer cuts a batch of them, which it does once the queue holds
+// batch.min_size of them, the oldest one waited batch.flush_timeout, or a
+// flush or a shutdown asks for it. Consumers export their batches
+// concurrently.
+type batcher[T any] struct {
+	export func(ctx context.Context, items []T) error
+
+	queueSize    int64
+	minSize      int64
+	maxSize      int64
+	flushTimeout time.Duration
+	block        bool
+	wait         bool
+	numConsumers int
+
+	queueSizeOf func(T) int64
+	batchSizeOf func(T) int64
+
+	// persistent stores the batches, if the queue has storage.
+	persistent *persistent[T]
+
+	mu      sync.Mutex
+	changed chan struct{}
+	entries []*entry[T]
+	queued  int64 // Size of the entries in the queue sizer.
+	batched int64 // Size of the entries in the batch sizer.
+	seq     uint64
+	flushTo uint64
+	// inflight maps the seq of the first entry of each batch being exported
+	// to the number of entries in it.
+	inflight map[uint64]int
+	closed   bool
+
+	// start starts the consumers on the first item, so a batcher that is
+	// built but never used runs nothing.
+	start     sync.Once
+	consumers sync.WaitGroup
+	dropped   atomic.Int64
+}
+
+type entry[T any] struct {
+	v     T
+	seq   uint64
+	at    time.Time
+	qsize int64
+	bsize int64
+	// result receives the result of the export if the producer waits for it.
+	result chan error
+}
+
+func newBatcher[T any](c QueueConfig, d batcherDefaults, codec itemCodec[T], export func(context.Context, []T) error) (*batcher[T], error) {
+	queue_size_of, err := sizerOf(c.Sizer, codec.bytes)
+	if err != nil {
+		return nil, fmt.Errorf("sending_queue: %w", err)
+	}
+	batch_sizer := c.Batch.Sizer
+	if batch_sizer == "" {
+		batch_sizer = c.Sizer
+	}
+	batch_size_of, err := sizerOf(batch_sizer, codec.bytes)
+	if err != nil {
+		return nil, fmt.Errorf("sending_queue: batch: %w", err)
+	}
+
+	// The defaults count items, so they do not apply to bytes.
+	queue_size := c.QueueSize
+	if queue_size <= 0 {
+		if c.Sizer == "bytes" {
+			return nil, fmt.Errorf("sending_queue: queue_size is required with sizer bytes")
+		}
+		queue_size = d.queueSize
+	}
+	max_size := c.Batch.MaxSize
+	if max_size <= 0 && batch_sizer != "bytes" {
+		max_size = d.maxSize
+	}
+	min_size := c.Batch.MinSize
+	if min_size <= 0 {
+		min_size = max_size
+	}
+	if max_size > 0 && min_size > max_size {
+		return nil, fmt.Errorf("sending_queue: batch.min_size must not exceed batch.max_size")
+	}
+	flush_timeout := c.Batch.FlushTimeout
+	if flush_timeout <= 0 {
+		flush_timeout = d.flushTimeout
+	}
+	num_consumers := c.NumConsumers
+	if num_consumers <= 0 {
+		num_consumers = 1
+	}
+
+	b := &batcher[T]{
+		export: export,
+
+		queueSize:    queue_size,
+		minSize:      min_size,
+		maxSize:      max_size,
+		flushTimeout: flush_timeout,
+		block:        c.BlockOnOverflow,
+		wait:         c.WaitForResult,
+		numConsumers: num_consumers,
+
+		queueSizeOf: queue_size_of,
+		batchSizeOf: batch_size_of,
+
+		changed:  make(chan struct{}),
+		inflight: map[uint64]int{},
+	}
+	if c.Storage != nil {
+		p, err := newPersistent(c.Storage, codec.signal, codec.encode, codec.decode, export)
+		if err != nil {
+			return nil, err
+		}
+		b.persistent = p
+		b.export = p.Export
+	}
+	return b, nil
+}
+
+// Start starts replaying the stored batches, if b has storage. Otherwise they
+// are replayed once b first exports.
+func (b *batcher[T]) Start(ctx context.Context) error {
+	if b.persistent != nil {
+		b.persistent.begin()
+	}
+	return nil
+}
+
+// stored reports if b writes its batches to storage.
+func (b *batcher[T]) stored() bool {
+	return b.persistent != nil
+}
+
+// notify wakes everyone waiting for the state of b to change. b.mu must be
+// held.
+func (b *batcher[T]) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// enqueue adds v to the queue. If the queue is full, it waits for space if b
+// blocks on overflow and drops v otherwise. If b waits for results, it returns
+// the result of exporting v.
+func (b *batcher[T]) enqueue(ctx context.Context, v T) error {
+	e := &entry[T]{v: v, qsize: b.queueSizeOf(v), bsize: b.batchSizeOf(v)}
+	if b.wait {
+		e.result = make(chan error, 1)
+	}
+	b.start.Do(func() {
+		for range b.numConsumers {
+			b.consumers.Go(b.consume)
+		}
+	})
+
+	b.mu.Lock()
+	// An item larger than the queue is let in once the queue is empty, so it
+	// does not block forever.
+	for !b.closed && len(b.entries) > 0 && b.queued+e.qsize > b.queueSize {
+		if !b.block {
+			b.mu.Unlock()
+			b.dropped.Add(1)
+			return nil
+		}
+
+		changed := b.changed
+		b.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		b.mu.Lock()
+	}
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+
+	b.seq++
+	e.seq = b.seq
+	e.at = time.Now()
+	b.entries = append(b.entries, e)
+	b.queued += e.qsize
+	b.batched += e.bsize
+	b.notify()
+	b.mu.Unlock()
+
+	if e.result == nil {
+		return nil
+	}
+	select {
+	case err := <-e.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *batcher[T]) consume() {
+	for {
+		es, ok := b.next()
+		if !ok {
+			return
+		}
+
+		vs := make([]T, len(es))
+		for i, e := range es {
+			vs[i] = e.v
+		}
+		err := b.export(context.Background(), vs)
+
+		b.mu.Lock()
+		delete(b.inflight, es[0].seq)
+		b.notify()
+		b.mu.Unlock()
+
+		if b.wait {
+			for _, e := range es {
+				e.result <- err
+			}
+		} else if err != nil {
+			otel.Handle(err)
+		}
+		if n := b.dropped.Swap(0); n > 0 {
+			otel.Handle(fmt.Errorf("sending_queue: %d items dropped on a full queue", n))
+		}
+	}
+}
+
+// next waits until a batch is due and cuts it. It reports false once b is
+// shut down and its queue is drained.
+func (b *batcher[T]) next() ([]*entry[T], bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		var t *time.Timer
+		var timeout <-chan time.Time
+		if len(b.entries) == 0 {
+			if b.closed {
+				return nil, false
+			}
+		} else if d := b.due(); d <= 0 {
+			return b.cut(), true
+		} else {
+			t = time.NewTimer(d)
+			timeout = t.C
+		}
+
+		changed := b.changed
+		b.mu.Unlock()
+		select {
+		case <-changed:
+		case <-timeout:
+		}
+		if t != nil {
+			t.Stop()
+		}
+		b.mu.Lock()
+	}
+}
+
+// due returns how long the head of the queue has left before it is due. b.mu
+// must be held and the queue must not be empty.
+func (b *batcher[T]) due() time.Duration {
+	if b.closed || b.entries[0].seq <= b.flushTo || b.batched >= b.minSize {
+		return 0
+	}
+	return b.flushTimeout - time.Since(b.entries[0].at)
+}
+
+// cut takes a batch of at most b.maxSize off the head of the queue, but at
+// least one entry. b.mu must be held.
+func (b *batcher[T]) cut() []*entry[T] {
+	n := 0
+	size := int64(0)
+	for _, e := range b.entries {
+		if n > 0 && b.maxSize > 0 && size+e.bsize > b.maxSize {
+			break
+		}
+		n++
+		size += e.bsize
+	}
+
+	es := make([]*entry[T], n)
+	copy(es, b.entries)
+	clear(b.entries[:n])
+	b.entries = b.entries[n:]
+	for _, e := range es {
+		b.queued -= e.qsize
+		b.batched -= e.bsize
+	}
+	b.inflight[es[0].seq] = n
+	b.notify()
+	return es
+}
+
+// flush exports every item enqueued so far, and waits until they are. Then it
+// replays the stored batches, if any.
+func (b *batcher[T]) flush(ctx context.Context) error {
+	b.mu.Lock()
+	target := b.seq
+	b.flushTo = target
+	b.notify()
+	for !b.flushed(target) {
+		changed := b.changed
+		b.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		b.mu.Lock()
+	}
+	b.mu.Unlock()
+
+	if b.persistent != nil {
+		return b.persistent.replay(ctx)
+	}
+	return nil
+}
+
+// flushed reports if every item up to the target seq is exported. b.mu must
+// be held.
+func (b *batcher[T]) flushed(target uint64) bool {
+	if len(b.entries) > 0 && b.entries[0].seq <= target {
+		return false
+	}
+	for seq := range b.inflight {
+		if seq <= target {
+			return false
+		}
+	}
+	return true
+}
+
+// shutdown stops accepting items and waits until the queued ones are
+// exported. Then it calls f, unless ctx is done first.
+func (b *batcher[T]) shutdown(ctx context.Context, f func(ctx context.Context) error) error {
+	b.mu.Lock()
+	b.closed = true
+	b.notify()
+	b.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		b.consumers.Wait()
+		if b.persistent != nil {
+			if err := b.persistent.close(ctx); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- f(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pending returns the number of items queued or being exported.
+func (b *batcher[T]) Pending() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(b.entries)
+	for _, v := range b.inflight {
+		n += v
+	}
+	return int64(n)
+}
+
+type batchSpanProcessor struct {
+	*batcher[trace.ReadOnlySpan]
+	exporter trace.SpanExporter
+	once     sync.Once
+}
+
+func newBatchSpanProcessor(c QueueConfig, v trace.SpanExporter) (*batchSpanProcessor, error) {
+	b, err := newBatcher(c, spanBatcherDefaults, spanCodec, v.ExportSpans)
+	if err != nil {
+		return nil, err
+	}
+	return &batchSpanProcessor{batcher: b, exporter: v}, nil
+}
+
+func (p *batchSpanProcessor) OnStart(parent context.Context, s trace.ReadWriteSpan) {}
+
+func (p *batchSpanProcessor) OnEnd(s trace.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+	if err := p.enqueue(context.Background(), s); err != nil {
+		otel.Handle(err)
+	}
+}
+
+func (p *batchSpanProcessor) ForceFlush(ctx context.Context) error {
+	return p.flush(ctx)
+}
+
+func (p *batchSpanProcessor) Shutdown(ctx context.Context) error {
+	var err error
+	p.once.Do(func() {
+		err = p.shutdown(ctx, p.exporter.Shutdown)
+	})
+	return err
+}
+
+type batchLogProcessor struct {
+	*batcher[log.Record]
+	exporter log.Exporter
+	once     sync.Once
+}
+
+func newBatchLogProcessor(c QueueConfig, v log.Exporter) (*batchLogProcessor, error) {
+	b, err := newBatcher(c, logBatcherDefaults, logCodec, v.Export)
+	if err != nil {
+		return nil, err
+	}
+	return &batchLogProcessor{batcher: b, exporter: v}, nil
+}
+
+func (p *batchLogProcessor) Enabled(ctx context.Context, param log.EnabledParameters) bool {
+	return true
+}
+
+func (p *batchLogProcessor) OnEmit(ctx context.Context, r *log.Record) error {
+	// The record is reused once OnEmit returns.
+	return p.enqueue(ctx, r.Clone())
+}
+
+func (p *batchLogProcessor) ForceFlush(ctx context.Context) error {
+	if err := p.flush(ctx); err != nil {
+		return err
+	}
+	return p.exporter.ForceFlush(ctx)
+}
+
+func (p *batchLogProcessor) Shutdown(ctx context.Context) error {
+	var err error
+	p.once.Do(func() {
+		err = p.shutdown(ctx, p.exporter.Shutdown)
+	})
+	return err
+}
+
+// spanBytes estimates the encoded size of a span, leaving out its resource
+// and scope, which a batch shares.
+func spanBytes(s trace.ReadOnlySpan) int64 {
+	// Trace, span, and parent ids, timestamps, kind, and status code.
+	n := int64(16 + 8 + 8 + 8 + 8 + 4 + 4)
+	n += int64(len(s.Name()) + len(s.Status().Description))
+	n += attrsBytes(s.Attributes())
+	for _, e := range s.Events() {
+		n += 8 + int64(len(e.Name)) + attrsBytes(e.Attributes)
+	}
+	for _, l := range s.Links() {
+		n += 16 + 8 + attrsBytes(l.Attributes)
+	}
+	return n
+}
+
+func attrsBytes(kvs []attribute.KeyValue) int64 {
+	n := int64(0)
+	for _, kv := range kvs {
+		n += int64(len(kv.Key)) + attrValueBytes(kv.Value)
+	}
+	return n
+}
+
+func attrValueBytes(v attribute.Value) int64 {
+	switch v.Type() {
+	case attribute.BOOL:
+		return 1
+	case attribute.INT64, attribute.FLOAT64:
+		return 8
+	case attribute.STRING:
+		return int64(len(v.AsString()))
+	case attribute.BOOLSLICE:
+		return int64(len(v.AsBoolSlice()))
+	case attribute.INT64SLICE:
+		return 8 * int64(len(v.AsInt64Slice()))
+	case attribute.FLOAT64SLICE:
+		return 8 * int64(len(v.AsFloat64Slice()))
+	case attribute.STRINGSLICE:
+		n := int64(0)
+		for _, s := range v.AsStringSlice() {
+			n += int64(len(s))
+		}
+		return n
+	case attribute.BYTESLICE:
+		return int64(len(v.AsByteSlice()))
+	case attribute.SLICE:
+		n := int64(0)
+		for _, v := range v.AsSlice() {
+			n += attrValueBytes(v)
+		}
+		return n
+	default:
+		return 0
+	}
+}
+
+// recordBytes estimates the encoded size of a log record, leaving out its
+// resource and scope, which a batch shares.
+func recordBytes(r log.Record) int64 {
+	// Timestamps, trace and span ids, trace flags, and severity.
+	n := int64(8 + 8 + 16 + 8 + 1 + 4)
+	n += int64(len(r.EventName()) + len(r.SeverityText()))
+	n += logValueBytes(r.Body())
+	r.WalkAttributes(func(kv olog.KeyValue) bool {
+		n += int64(len(kv.Key)) + logValueBytes(kv.Value)
+		return true
+	})
+	return n
+}
+
+func logValueBytes(v olog.Value) int64 {
+	switch v.Kind() {
+	case olog.KindBool:
+		return 1
+	case olog.KindInt64, olog.KindFloat64:
+		return 8
+	case olog.KindString:
+		return int64(len(v.AsString()))
+	case olog.KindBytes:
+		return int64(len(v.AsBytes()))
+	case olog.KindSlice:
+		n := int64(0)
+		for _, v := range v.AsSlice() {
+			n += logValueBytes(v)
+		}
+		return n
+	case olog.KindMap:
+		n := int64(0)
+		for _, kv := range v.AsMap() {
+			n += int64(len(kv.Key)) + logValueBytes(kv.Value)
+		}
+		return n
+	default:
+		return 0
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/trace"
 )
 
@@ -11,8 +12,8 @@ import (
 // lifecycle component a Resolver manages: Shutdown drains the processor (which
 // flushes batched spans and then closes the exporter, for both the simple and
 // batch variants) instead of closing the exporter under the processor's feet,
-// and Start passes through so an unstarted exporter is started by
-// [Resolver.Start].
+// and Start passes through so an unstarted exporter and its processor are
+// started by [Resolver.Start].
 func SpanComponent(v trace.SpanExporter, p trace.SpanProcessor) trace.SpanExporter {
 	return spanComponent{v, p}
 }
@@ -23,15 +24,16 @@ type spanComponent struct {
 }
 
 func (c spanComponent) Start(ctx context.Context) error {
-	s, ok := c.SpanExporter.(interface{ Start(context.Context) error })
-	if !ok {
-		return nil
+	if err := startOf(ctx, c.SpanExporter); err != nil {
+		return err
 	}
-	return s.Start(ctx)
+	return startOf(ctx, c.p)
 }
 
 func (c spanComponent) Shutdown(ctx context.Context) error { return c.p.Shutdown(ctx) }
 
+func (c spanComponent) Pending() int64 { return pendingOf(c.p) }
+
 // LogComponent mirrors [SpanComponent] for the log pipeline: Shutdown drains
 // the processor so batched records are flushed before the exporter closes.
 func LogComponent(v log.Exporter, p log.Processor) log.Exporter {
@@ -43,4 +45,61 @@ type logComponent struct {
 	p log.Processor
 }
 
+func (c logComponent) Start(ctx context.Context) error {
+	if err := startOf(ctx, c.Exporter); err != nil {
+		return err
+	}
+	return startOf(ctx, c.p)
+}
+
 func (c logComponent) Shutdown(ctx context.Context) error { return c.p.Shutdown(ctx) }
+
+func (c logComponent) Pending() int64 { return pendingOf(c.p) }
+
+// MetricComponent mirrors [SpanComponent] for a metric reader pushing to v:
+// Shutdown shuts the reader down, which collects a last time and then closes
+// v, and Start passes through so an unstarted v is started by
+// [Resolver.Start].
+func MetricComponent(r metric.Reader, v metric.Exporter) metric.Reader {
+	return metricComponent{r, v}
+}
+
+type metricComponent struct {
+	metric.Reader
+	v metric.Exporter
+}
+
+func (c metricComponent) Start(ctx context.Context) error { return startOf(ctx, c.v) }
+
+// startOf starts v, if it needs to be started.
+func startOf(ctx context.Context, v any) error {
+	s, ok := v.(interface{ Start(context.Context) error })
+	if !ok {
+		return nil
+	}
+	return s.Start(ctx)
+}
+
+// pendingOf returns the number of items v holds that are not exported yet, or
+// -1 if v cannot tell.
+func pendingOf(v any) int64 {
+	p, ok := v.(interface{ Pending() int64 })
+	if !ok {
+		return -1
+	}
+	return p.Pending()
+}
+
+// storedOf reports if the processor of the component v writes its batches to
+// storage.
+func storedOf(v any) bool {
+	var p any
+	switch v := v.(type) {
+	case spanComponent:
+		p = v.p
+	case logComponent:
+		p = v.p
+	}
+	s, ok := p.(interface{ stored() bool })
+	return ok && s.stored()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/goccy/go-yaml"
 	"github.com/goccy/go-yaml/ast"
@@ -16,6 +17,29 @@ import (
 type Config struct {
 	Enabled *bool `yaml:",omitempty"`
 
+	// ShutdownTimeout bounds the shutdown of each component, so a stuck one
+	// cannot use up the deadline of the whole shutdown. Zero means no bound
+	// other than the context passed to [Resolver.Shutdown].
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout,omitempty"`
+
+	// Propagators lists the propagators [Resolver.InstallGlobals] registers,
+	// by the names of [Propagators].
+	Propagators []string `yaml:"propagators,omitempty"`
+
+	// Global makes [Resolver.Start] install the default providers and the
+	// propagators as the OpenTelemetry globals, as [Resolver.InstallGlobals]
+	// does.
+	Global bool `yaml:"global,omitempty"`
+
+	// Fallback resolves a provider the config does not define to its closest
+	// ancestor the config does, so "tracer/db/pg" falls back to "tracer/db"
+	// and then to "tracer". Providers that fall back to the same one share it.
+	Fallback bool `yaml:"fallback,omitempty"`
+
+	// Resource is the resource of every provider. A resource processor a
+	// provider lists is layered over it.
+	Resource *Resource `yaml:"resource,omitempty"`
+
 	ProcessorRegistry ProcessorRegistry `yaml:"-"`
 	ExporterRegistry  ExporterRegistry  `yaml:"-"`
 
@@ -39,26 +63,78 @@ func (c Config) IsEnabled() bool {
 	return c.Enabled == nil || *c.Enabled
 }
 
+// provider returns the id of the provider id resolves to, along with its config.
+func (c *Config) provider(id Id) (Id, *ProviderConfig, bool) {
+	for {
+		if p, ok := c.Providers[id]; ok {
+			return id, p, true
+		}
+		if !c.Fallback {
+			return id, nil, false
+		}
+
+		parent, ok := id.parent()
+		if !ok {
+			return id, nil, false
+		}
+		id = parent
+	}
+}
+
 type ProviderConfig struct {
 	Processors []Id `yaml:",omitempty"`
 	Exporters  []Id `yaml:",omitempty"`
+
+	// Include makes the provider fan out to the providers of the given ids,
+	// each with its own pipeline, instead of having a pipeline of its own.
+	Include []Id `yaml:",omitempty"`
 }
 
 type config struct {
 	Enabled *bool
 
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	Propagators     []string      `yaml:"propagators"`
+	Global          bool          `yaml:"global"`
+	Fallback        bool          `yaml:"fallback"`
+	Resource        *Resource     `yaml:"resource"`
+
 	Processors map[Id]ast.Node
 	Exporters  map[Id]ast.Node
 	Providers  map[Id]*ProviderConfig
 }
 
 func (c *Config) UnmarshalYAML(unmarshal func(any) error) error {
+	var root ast.Node
+	if err := unmarshal(&root); err != nil {
+		return err
+	}
+	if root == nil {
+		return nil
+	}
+
+	// References are expanded on the whole document before any component
+	// decodes its part, so every field (including opaque ones) sees the
+	// resolved value.
+	if err := expandNode(root); err != nil {
+		return z.Err(err, "expand")
+	}
+	raw, err := root.MarshalYAML()
+	if err != nil {
+		return fmt.Errorf("get raw: %w", err)
+	}
+
 	c_ := config{}
-	if err := unmarshal(&c_); err != nil {
+	if err := yaml.Unmarshal(raw, &c_); err != nil {
 		return err
 	}
 
 	c.Enabled = c_.Enabled
+	c.ShutdownTimeout = c_.ShutdownTimeout
+	c.Propagators = c_.Propagators
+	c.Global = c_.Global
+	c.Fallback = c_.Fallback
+	c.Resource = c_.Resource
 
 	reg_processor := c.ProcessorRegistry
 	if reg_processor == nil {
@@ -133,6 +209,34 @@ type LoggerProviderConfig interface {
 	LoggerOpts(ctx context.Context) ([]log.LoggerProviderOption, error)
 }
 
+// SpanProcessorConfig is implemented by a processor that wires every exporter
+// of a tracer provider into the provider, in place of the exporter's own
+// processor.
+type SpanProcessorConfig interface {
+	SpanProcessor(ctx context.Context, v trace.SpanExporter) (trace.SpanProcessor, error)
+}
+
+// SpanProcessorWrapperConfig is implemented by a processor that edits or
+// drops spans. The SDK hands every span processor the same read-only span, so
+// such a processor wraps the span processor of each exporter instead of being
+// installed beside them.
+type SpanProcessorWrapperConfig interface {
+	WrapSpanProcessor(ctx context.Context, p trace.SpanProcessor) (trace.SpanProcessor, error)
+}
+
+// LogProcessorWrapperConfig is the [SpanProcessorWrapperConfig] of a logger
+// provider. The SDK hands the same record to every log processor, so a
+// processor that edits or drops records wraps the log processor of each
+// exporter, and edits a clone of the record.
+type LogProcessorWrapperConfig interface {
+	WrapLogProcessor(ctx context.Context, p log.Processor) (log.Processor, error)
+}
+
+// LogProcessorConfig is the [SpanProcessorConfig] of a logger provider.
+type LogProcessorConfig interface {
+	LogProcessor(ctx context.Context, v log.Exporter) (log.Processor, error)
+}
+
 type ProcessorConfig interface {
 	TracerProviderConfig
 	MeterProviderConfig
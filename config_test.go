@@ -1,11 +1,15 @@
 package mkot_test
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/goccy/go-yaml"
 	"github.com/lesomnus/mkot"
 	"github.com/lesomnus/mkot/internal/x"
+	"github.com/lesomnus/mkot/opaque"
 	"go.opentelemetry.io/otel/attribute"
 )
 
@@ -97,3 +101,96 @@ providers:
 	// require.Equal([]mkot.Id{"resource"}, default_provider.Processors)
 	// require.Equal([]mkot.Id{"debug"}, default_provider.Exporters)
 }
+
+type headersExporterConfig struct {
+	mkot.UnimplementedExporterConfig `yaml:"-"`
+
+	Endpoint string         `yaml:"endpoint"`
+	Headers  opaque.MapList `yaml:"headers"`
+	Enabled  *bool          `yaml:"enabled"`
+}
+
+func TestConfigUnmarshalYAMLExpand(t *testing.T) {
+	_, x := x.New(t)
+
+	token := filepath.Join(t.TempDir(), "token")
+	x.NoError(os.WriteFile(token, []byte("s3cr3t\n"), 0600))
+
+	t.Setenv("MKOT_TEST_ENDPOINT", "collector:4317")
+	t.Setenv("MKOT_TEST_ENABLED", "false")
+	t.Setenv("MKOT_TEST_SERVICE", "scranton")
+	const Raw = `
+processors:
+  resource:
+    attributes:
+      - key: service.name
+        value: ${env:MKOT_TEST_SERVICE}
+      - key: service.namespace
+        value: dunder-${env:MKOT_TEST_UNSET:-mifflin}
+      - key: literal
+        value: $${env:MKOT_TEST_SERVICE}
+      - key: quoted
+        value: "${env:MKOT_TEST_ENABLED}"
+      - key: single_quoted
+        value: '${env:MKOT_TEST_UNSET}'
+exporters:
+  test:
+    endpoint: ${MKOT_TEST_ENDPOINT}
+    enabled: ${env:MKOT_TEST_ENABLED}
+    headers:
+      - name: authorization
+        value: Bearer ${file:` + "%s" + `}
+`
+
+	c := mkot.Config{
+		ExporterRegistry: mkot.ExporterRegistry{
+			"test": func() mkot.ExporterConfig { return &headersExporterConfig{} },
+		},
+	}
+	err := yaml.Unmarshal(fmt.Appendf(nil, Raw, token), &c)
+	x.NoError(err)
+
+	resource := mkot.Resource{}
+	x.TypeAs(c.Processors["resource"], &resource)
+	x.Eq(
+		[]mkot.Attr{
+			{Key: "service.name", Value: attribute.StringValue("scranton")},
+			{Key: "service.namespace", Value: attribute.StringValue("dunder-mifflin")},
+			{Key: "literal", Value: attribute.StringValue("${env:MKOT_TEST_SERVICE}")},
+			// Quoted references stay strings even if they expand to a boolean
+			// or nothing.
+			{Key: "quoted", Value: attribute.StringValue("false")},
+			{Key: "single_quoted", Value: attribute.StringValue("")},
+		},
+		resource.Attributes,
+	)
+
+	exporter := headersExporterConfig{}
+	x.TypeAs(c.Exporters["test"], &exporter)
+	x.Eq("collector:4317", exporter.Endpoint)
+	x.NotNil(exporter.Enabled)
+	x.Eq(false, *exporter.Enabled)
+
+	auth, ok := exporter.Headers.Get("authorization")
+	x.Eq(true, ok)
+	x.Eq("Bearer s3cr3t", string(auth))
+	x.Eq("[REDACTED]", fmt.Sprint(auth))
+}
+
+func TestConfigUnmarshalYAMLExpandError(t *testing.T) {
+	_, x := x.New(t)
+	const Raw = `
+processors:
+  resource:
+    attributes:
+      - key: service.name
+        value: ${file:/nonexistent/mkot}
+`
+
+	c := mkot.Config{}
+	err := yaml.Unmarshal([]byte(Raw), &c)
+	x.Contains(fmt.Sprint(err), "${file:/nonexistent/mkot}")
+
+	err = yaml.Unmarshal([]byte(`processors: { resource: { detectors: ["${vault:x}"] } }`), &c)
+	x.Contains(fmt.Sprint(err), `unknown scheme "vault"`)
+}
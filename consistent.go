@@ -0,0 +1,148 @@
+package mkot
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/sdk/trace"
+	otrace "go.opentelemetry.io/otel/trace"
+)
+
+// The OpenTelemetry consistent probability sampling uses 56 bits of
+// randomness: the "rv" value of the "ot" tracestate entry, or the last 7 bytes
+// of the trace id. A span is sampled if its randomness is at least the
+// threshold, which is recorded as the "th" value so the adjusted count of a
+// span can be computed downstream.
+const (
+	consistentBits = 56
+	consistentMax  = uint64(1) << consistentBits
+)
+
+// consistentSampler samples spans by the randomness of their trace, so every
+// sampler of a trace with the same or a lower threshold samples the same
+// spans.
+type consistentSampler struct {
+	ratio     float64
+	threshold uint64 // consistentMax rejects every span.
+}
+
+func newConsistentSampler(ratio float64) (*consistentSampler, error) {
+	if ratio < 0 || ratio > 1 {
+		return nil, errors.New("consistent_probability: ratio must be from 0 to 1")
+	}
+	t := consistentMax
+	if ratio > 0 {
+		t = min(uint64((1-ratio)*float64(consistentMax)), consistentMax)
+	}
+	return &consistentSampler{ratio: ratio, threshold: t}, nil
+}
+
+func (s *consistentSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	ts := otrace.SpanContextFromContext(p.ParentContext).TraceState()
+	ot := parseOtTraceState(ts.Get("ot"))
+
+	r, ok := ot.randomness()
+	if !ok {
+		r = binary.BigEndian.Uint64(p.TraceID[8:]) & (consistentMax - 1)
+	}
+
+	decision := trace.Drop
+	if s.threshold < consistentMax && r >= s.threshold {
+		decision = trace.RecordAndSample
+		ot.set("th", formatThreshold(s.threshold))
+	} else {
+		ot.remove("th")
+	}
+
+	if v := ot.String(); v == "" {
+		ts = ts.Delete("ot")
+	} else if ts_, err := ts.Insert("ot", v); err == nil {
+		ts = ts_
+	}
+	return trace.SamplingResult{Decision: decision, Tracestate: ts}
+}
+
+func (s *consistentSampler) Description() string {
+	return fmt.Sprintf("ConsistentProbability{%g}", s.ratio)
+}
+
+// formatThreshold returns the threshold in hex with its trailing zeros
+// removed.
+func formatThreshold(t uint64) string {
+	v := strings.TrimRight(fmt.Sprintf("%014x", t), "0")
+	if v == "" {
+		return "0"
+	}
+	return v
+}
+
+// otTraceState is the values of the "ot" tracestate entry, in order.
+type otTraceState [][2]string
+
+func parseOtTraceState(s string) otTraceState {
+	vs := otTraceState{}
+	if s == "" {
+		return vs
+	}
+	for _, kv := range strings.Split(s, ";") {
+		k, v, ok := strings.Cut(kv, ":")
+		if !ok {
+			continue
+		}
+		vs = append(vs, [2]string{k, v})
+	}
+	return vs
+}
+
+func (s otTraceState) get(key string) (string, bool) {
+	for _, kv := range s {
+		if kv[0] == key {
+			return kv[1], true
+		}
+	}
+	return "", false
+}
+
+func (s *otTraceState) set(key, value string) {
+	for i, kv := range *s {
+		if kv[0] == key {
+			(*s)[i][1] = value
+			return
+		}
+	}
+	*s = append(*s, [2]string{key, value})
+}
+
+func (s *otTraceState) remove(key string) {
+	vs := (*s)[:0]
+	for _, kv := range *s {
+		if kv[0] != key {
+			vs = append(vs, kv)
+		}
+	}
+	*s = vs
+}
+
+// randomness returns the "rv" value if it is valid.
+func (s otTraceState) randomness() (uint64, bool) {
+	v, ok := s.get("rv")
+	if !ok || len(v) != consistentBits/4 {
+		return 0, false
+	}
+	r, err := strconv.ParseUint(v, 16, 64)
+	if err != nil {
+		return 0, false
+	}
+	return r, true
+}
+
+func (s otTraceState) String() string {
+	vs := make([]string, len(s))
+	for i, kv := range s {
+		vs[i] = kv[0] + ":" + kv[1]
+	}
+	return strings.Join(vs, ";")
+}
@@ -0,0 +1,154 @@
+package mkot
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	olog "go.opentelemetry.io/otel/log"
+	logembedded "go.opentelemetry.io/otel/log/embedded"
+	otrace "go.opentelemetry.io/otel/trace"
+	traceembedded "go.opentelemetry.io/otel/trace/embedded"
+)
+
+// swappable holds a value that can be replaced while it is being used.
+type swappable[T any] struct {
+	p atomic.Pointer[T]
+}
+
+func (s *swappable[T]) Load() T {
+	return *s.p.Load()
+}
+
+func (s *swappable[T]) Store(v T) {
+	s.p.Store(&v)
+}
+
+// scopeKey identifies an instrumentation scope the way the SDK does, so a
+// delegating provider hands out the same delegate for the same scope.
+type scopeKey struct {
+	name    string
+	version string
+	schema  string
+	attrs   attribute.Distinct
+}
+
+func newScopeKey(name string, version string, schema string, attrs attribute.Set) scopeKey {
+	return scopeKey{name, version, schema, attrs.Equivalent()}
+}
+
+// tracerProviderDelegate is a stable [otrace.TracerProvider] whose underlying
+// provider can be swapped. Tracers it hands out follow the swap.
+type tracerProviderDelegate struct {
+	traceembedded.TracerProvider
+
+	mu       sync.Mutex
+	provider otrace.TracerProvider
+	tracers  map[scopeKey]*tracerDelegate
+}
+
+func newTracerProviderDelegate(v otrace.TracerProvider) *tracerProviderDelegate {
+	return &tracerProviderDelegate{
+		provider: v,
+		tracers:  map[scopeKey]*tracerDelegate{},
+	}
+}
+
+func (p *tracerProviderDelegate) Tracer(name string, opts ...otrace.TracerOption) otrace.Tracer {
+	c := otrace.NewTracerConfig(opts...)
+	k := newScopeKey(name, c.InstrumentationVersion(), c.SchemaURL(), c.InstrumentationAttributes())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if t, ok := p.tracers[k]; ok {
+		return t
+	}
+
+	t := &tracerDelegate{name: name, opts: opts}
+	t.v.Store(p.provider.Tracer(name, opts...))
+	p.tracers[k] = t
+	return t
+}
+
+func (p *tracerProviderDelegate) swap(v otrace.TracerProvider) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.provider = v
+	for _, t := range p.tracers {
+		t.v.Store(v.Tracer(t.name, t.opts...))
+	}
+}
+
+type tracerDelegate struct {
+	traceembedded.Tracer
+
+	name string
+	opts []otrace.TracerOption
+	v    swappable[otrace.Tracer]
+}
+
+func (t *tracerDelegate) Start(ctx context.Context, name string, opts ...otrace.SpanStartOption) (context.Context, otrace.Span) {
+	return t.v.Load().Start(ctx, name, opts...)
+}
+
+// loggerProviderDelegate mirrors [tracerProviderDelegate] for loggers.
+type loggerProviderDelegate struct {
+	logembedded.LoggerProvider
+
+	mu       sync.Mutex
+	provider olog.LoggerProvider
+	loggers  map[scopeKey]*loggerDelegate
+}
+
+func newLoggerProviderDelegate(v olog.LoggerProvider) *loggerProviderDelegate {
+	return &loggerProviderDelegate{
+		provider: v,
+		loggers:  map[scopeKey]*loggerDelegate{},
+	}
+}
+
+func (p *loggerProviderDelegate) Logger(name string, opts ...olog.LoggerOption) olog.Logger {
+	c := olog.NewLoggerConfig(opts...)
+	k := newScopeKey(name, c.InstrumentationVersion(), c.SchemaURL(), c.InstrumentationAttributes())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if l, ok := p.loggers[k]; ok {
+		return l
+	}
+
+	l := &loggerDelegate{name: name, opts: opts}
+	l.v.Store(p.provider.Logger(name, opts...))
+	p.loggers[k] = l
+	return l
+}
+
+func (p *loggerProviderDelegate) swap(v olog.LoggerProvider) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.provider = v
+	for _, l := range p.loggers {
+		l.v.Store(v.Logger(l.name, l.opts...))
+	}
+}
+
+type loggerDelegate struct {
+	logembedded.Logger
+
+	name string
+	opts []olog.LoggerOption
+	v    swappable[olog.Logger]
+}
+
+func (l *loggerDelegate) Emit(ctx context.Context, record olog.Record) {
+	l.v.Load().Emit(ctx, record)
+}
+
+func (l *loggerDelegate) Enabled(ctx context.Context, param olog.EnabledParameters) bool {
+	return l.v.Load().Enabled(ctx, param)
+}
@@ -0,0 +1,451 @@
+package mkot
+
+import (
+	"context"
+	"sync"
+
+	ometric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/embedded"
+)
+
+// meterProviderDelegate mirrors [tracerProviderDelegate] for meters. Unlike a
+// tracer or a logger, a meter hands out instruments and callback
+// registrations, so every one of them is a delegate that is rebuilt on the
+// swapped meter.
+type meterProviderDelegate struct {
+	embedded.MeterProvider
+
+	mu       sync.Mutex
+	provider ometric.MeterProvider
+	meters   map[scopeKey]*meterDelegate
+}
+
+func newMeterProviderDelegate(v ometric.MeterProvider) *meterProviderDelegate {
+	return &meterProviderDelegate{
+		provider: v,
+		meters:   map[scopeKey]*meterDelegate{},
+	}
+}
+
+func (p *meterProviderDelegate) Meter(name string, opts ...ometric.MeterOption) ometric.Meter {
+	c := ometric.NewMeterConfig(opts...)
+	k := newScopeKey(name, c.InstrumentationVersion(), c.SchemaURL(), c.InstrumentationAttributes())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if m, ok := p.meters[k]; ok {
+		return m
+	}
+
+	m := &meterDelegate{
+		name:          name,
+		opts:          opts,
+		meter:         p.provider.Meter(name, opts...),
+		instruments:   map[instrumentKey]rebuilder{},
+		registrations: map[*registrationDelegate]struct{}{},
+	}
+	p.meters[k] = m
+	return m
+}
+
+func (p *meterProviderDelegate) swap(v ometric.MeterProvider) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.provider = v
+	for _, m := range p.meters {
+		m.swap(v.Meter(m.name, m.opts...))
+	}
+}
+
+type instrumentKey struct {
+	kind string
+	name string
+}
+
+type rebuilder interface {
+	rebuild(m ometric.Meter)
+}
+
+type meterDelegate struct {
+	embedded.Meter
+
+	name string
+	opts []ometric.MeterOption
+
+	mu            sync.Mutex
+	meter         ometric.Meter
+	instruments   map[instrumentKey]rebuilder
+	registrations map[*registrationDelegate]struct{}
+}
+
+func (m *meterDelegate) swap(v ometric.Meter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.meter = v
+	for _, i := range m.instruments {
+		i.rebuild(v)
+	}
+	for r := range m.registrations {
+		// The registration on the previous meter goes away with its provider.
+		r.register(v)
+	}
+}
+
+// instrument is the swappable part every instrument delegate embeds.
+type instrument[T any] struct {
+	build func(ometric.Meter) (T, error)
+	v     swappable[T]
+}
+
+func (i *instrument[T]) rebuild(m ometric.Meter) {
+	// The SDK returns a usable instrument along with the error, and the error
+	// was already reported when the instrument was first created.
+	v, _ := i.build(m)
+	i.v.Store(v)
+}
+
+// newInstrument returns the delegate registered for the key, or builds d on the
+// current meter and registers it. A delegate that fails to build is returned
+// with the error but not registered, so the error is reported again on the
+// next call.
+func newInstrument[D rebuilder, T any](m *meterDelegate, k instrumentKey, d D, i *instrument[T], build func(ometric.Meter) (T, error)) (D, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if v, ok := m.instruments[k]; ok {
+		if v, ok := v.(D); ok {
+			return v, nil
+		}
+	}
+
+	i.build = build
+	v, err := build(m.meter)
+	i.v.Store(v)
+	if err != nil {
+		return d, err
+	}
+
+	m.instruments[k] = d
+	return d, nil
+}
+
+func (m *meterDelegate) Int64Counter(name string, options ...ometric.Int64CounterOption) (ometric.Int64Counter, error) {
+	d := &int64CounterDelegate{}
+	return newInstrument(m, instrumentKey{"Int64Counter", name}, d, &d.instrument, func(m ometric.Meter) (ometric.Int64Counter, error) {
+		return m.Int64Counter(name, options...)
+	})
+}
+
+func (m *meterDelegate) Int64UpDownCounter(name string, options ...ometric.Int64UpDownCounterOption) (ometric.Int64UpDownCounter, error) {
+	d := &int64UpDownCounterDelegate{}
+	return newInstrument(m, instrumentKey{"Int64UpDownCounter", name}, d, &d.instrument, func(m ometric.Meter) (ometric.Int64UpDownCounter, error) {
+		return m.Int64UpDownCounter(name, options...)
+	})
+}
+
+func (m *meterDelegate) Int64Histogram(name string, options ...ometric.Int64HistogramOption) (ometric.Int64Histogram, error) {
+	d := &int64HistogramDelegate{}
+	return newInstrument(m, instrumentKey{"Int64Histogram", name}, d, &d.instrument, func(m ometric.Meter) (ometric.Int64Histogram, error) {
+		return m.Int64Histogram(name, options...)
+	})
+}
+
+func (m *meterDelegate) Int64Gauge(name string, options ...ometric.Int64GaugeOption) (ometric.Int64Gauge, error) {
+	d := &int64GaugeDelegate{}
+	return newInstrument(m, instrumentKey{"Int64Gauge", name}, d, &d.instrument, func(m ometric.Meter) (ometric.Int64Gauge, error) {
+		return m.Int64Gauge(name, options...)
+	})
+}
+
+func (m *meterDelegate) Int64ObservableCounter(name string, options ...ometric.Int64ObservableCounterOption) (ometric.Int64ObservableCounter, error) {
+	d := &int64ObservableCounterDelegate{}
+	return newInstrument(m, instrumentKey{"Int64ObservableCounter", name}, d, &d.instrument, func(m ometric.Meter) (ometric.Int64ObservableCounter, error) {
+		return m.Int64ObservableCounter(name, options...)
+	})
+}
+
+func (m *meterDelegate) Int64ObservableUpDownCounter(name string, options ...ometric.Int64ObservableUpDownCounterOption) (ometric.Int64ObservableUpDownCounter, error) {
+	d := &int64ObservableUpDownCounterDelegate{}
+	return newInstrument(m, instrumentKey{"Int64ObservableUpDownCounter", name}, d, &d.instrument, func(m ometric.Meter) (ometric.Int64ObservableUpDownCounter, error) {
+		return m.Int64ObservableUpDownCounter(name, options...)
+	})
+}
+
+func (m *meterDelegate) Int64ObservableGauge(name string, options ...ometric.Int64ObservableGaugeOption) (ometric.Int64ObservableGauge, error) {
+	d := &int64ObservableGaugeDelegate{}
+	return newInstrument(m, instrumentKey{"Int64ObservableGauge", name}, d, &d.instrument, func(m ometric.Meter) (ometric.Int64ObservableGauge, error) {
+		return m.Int64ObservableGauge(name, options...)
+	})
+}
+
+func (m *meterDelegate) Float64Counter(name string, options ...ometric.Float64CounterOption) (ometric.Float64Counter, error) {
+	d := &float64CounterDelegate{}
+	return newInstrument(m, instrumentKey{"Float64Counter", name}, d, &d.instrument, func(m ometric.Meter) (ometric.Float64Counter, error) {
+		return m.Float64Counter(name, options...)
+	})
+}
+
+func (m *meterDelegate) Float64UpDownCounter(name string, options ...ometric.Float64UpDownCounterOption) (ometric.Float64UpDownCounter, error) {
+	d := &float64UpDownCounterDelegate{}
+	return newInstrument(m, instrumentKey{"Float64UpDownCounter", name}, d, &d.instrument, func(m ometric.Meter) (ometric.Float64UpDownCounter, error) {
+		return m.Float64UpDownCounter(name, options...)
+	})
+}
+
+func (m *meterDelegate) Float64Histogram(name string, options ...ometric.Float64HistogramOption) (ometric.Float64Histogram, error) {
+	d := &float64HistogramDelegate{}
+	return newInstrument(m, instrumentKey{"Float64Histogram", name}, d, &d.instrument, func(m ometric.Meter) (ometric.Float64Histogram, error) {
+		return m.Float64Histogram(name, options...)
+	})
+}
+
+func (m *meterDelegate) Float64Gauge(name string, options ...ometric.Float64GaugeOption) (ometric.Float64Gauge, error) {
+	d := &float64GaugeDelegate{}
+	return newInstrument(m, instrumentKey{"Float64Gauge", name}, d, &d.instrument, func(m ometric.Meter) (ometric.Float64Gauge, error) {
+		return m.Float64Gauge(name, options...)
+	})
+}
+
+func (m *meterDelegate) Float64ObservableCounter(name string, options ...ometric.Float64ObservableCounterOption) (ometric.Float64ObservableCounter, error) {
+	d := &float64ObservableCounterDelegate{}
+	return newInstrument(m, instrumentKey{"Float64ObservableCounter", name}, d, &d.instrument, func(m ometric.Meter) (ometric.Float64ObservableCounter, error) {
+		return m.Float64ObservableCounter(name, options...)
+	})
+}
+
+func (m *meterDelegate) Float64ObservableUpDownCounter(name string, options ...ometric.Float64ObservableUpDownCounterOption) (ometric.Float64ObservableUpDownCounter, error) {
+	d := &float64ObservableUpDownCounterDelegate{}
+	return newInstrument(m, instrumentKey{"Float64ObservableUpDownCounter", name}, d, &d.instrument, func(m ometric.Meter) (ometric.Float64ObservableUpDownCounter, error) {
+		return m.Float64ObservableUpDownCounter(name, options...)
+	})
+}
+
+func (m *meterDelegate) Float64ObservableGauge(name string, options ...ometric.Float64ObservableGaugeOption) (ometric.Float64ObservableGauge, error) {
+	d := &float64ObservableGaugeDelegate{}
+	return newInstrument(m, instrumentKey{"Float64ObservableGauge", name}, d, &d.instrument, func(m ometric.Meter) (ometric.Float64ObservableGauge, error) {
+		return m.Float64ObservableGauge(name, options...)
+	})
+}
+
+func (m *meterDelegate) RegisterCallback(f ometric.Callback, instruments ...ometric.Observable) (ometric.Registration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r := &registrationDelegate{m: m, f: f, instruments: instruments}
+	if err := r.register(m.meter); err != nil {
+		return nil, err
+	}
+
+	m.registrations[r] = struct{}{}
+	return r, nil
+}
+
+type registrationDelegate struct {
+	embedded.Registration
+
+	m           *meterDelegate
+	f           ometric.Callback
+	instruments []ometric.Observable
+	v           swappable[ometric.Registration]
+}
+
+func (r *registrationDelegate) register(m ometric.Meter) error {
+	instruments := make([]ometric.Observable, len(r.instruments))
+	for i, v := range r.instruments {
+		instruments[i] = unwrapObservable(v)
+	}
+
+	v, err := m.RegisterCallback(func(ctx context.Context, o ometric.Observer) error {
+		return r.f(ctx, observerDelegate{o: o})
+	}, instruments...)
+	if err != nil {
+		return err
+	}
+
+	r.v.Store(v)
+	return nil
+}
+
+func (r *registrationDelegate) Unregister() error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	delete(r.m.registrations, r)
+	return r.v.Load().Unregister()
+}
+
+// observerDelegate passes the current instruments of the delegates a callback
+// observes to the SDK observer.
+type observerDelegate struct {
+	embedded.Observer
+
+	o ometric.Observer
+}
+
+func (o observerDelegate) ObserveFloat64(obsrv ometric.Float64Observable, value float64, opts ...ometric.ObserveOption) {
+	o.o.ObserveFloat64(unwrapObservable(obsrv).(ometric.Float64Observable), value, opts...)
+}
+
+func (o observerDelegate) ObserveInt64(obsrv ometric.Int64Observable, value int64, opts ...ometric.ObserveOption) {
+	o.o.ObserveInt64(unwrapObservable(obsrv).(ometric.Int64Observable), value, opts...)
+}
+
+func unwrapObservable(v ometric.Observable) ometric.Observable {
+	if d, ok := v.(interface{ unwrap() ometric.Observable }); ok {
+		return d.unwrap()
+	}
+	return v
+}
+
+type int64CounterDelegate struct {
+	embedded.Int64Counter
+	instrument[ometric.Int64Counter]
+}
+
+func (i *int64CounterDelegate) Add(ctx context.Context, incr int64, options ...ometric.AddOption) {
+	i.v.Load().Add(ctx, incr, options...)
+}
+
+func (i *int64CounterDelegate) Enabled(ctx context.Context) bool {
+	return i.v.Load().Enabled(ctx)
+}
+
+type int64UpDownCounterDelegate struct {
+	embedded.Int64UpDownCounter
+	instrument[ometric.Int64UpDownCounter]
+}
+
+func (i *int64UpDownCounterDelegate) Add(ctx context.Context, incr int64, options ...ometric.AddOption) {
+	i.v.Load().Add(ctx, incr, options...)
+}
+
+func (i *int64UpDownCounterDelegate) Enabled(ctx context.Context) bool {
+	return i.v.Load().Enabled(ctx)
+}
+
+type int64HistogramDelegate struct {
+	embedded.Int64Histogram
+	instrument[ometric.Int64Histogram]
+}
+
+func (i *int64HistogramDelegate) Record(ctx context.Context, incr int64, options ...ometric.RecordOption) {
+	i.v.Load().Record(ctx, incr, options...)
+}
+
+func (i *int64HistogramDelegate) Enabled(ctx context.Context) bool {
+	return i.v.Load().Enabled(ctx)
+}
+
+type int64GaugeDelegate struct {
+	embedded.Int64Gauge
+	instrument[ometric.Int64Gauge]
+}
+
+func (i *int64GaugeDelegate) Record(ctx context.Context, value int64, options ...ometric.RecordOption) {
+	i.v.Load().Record(ctx, value, options...)
+}
+
+func (i *int64GaugeDelegate) Enabled(ctx context.Context) bool {
+	return i.v.Load().Enabled(ctx)
+}
+
+type float64CounterDelegate struct {
+	embedded.Float64Counter
+	instrument[ometric.Float64Counter]
+}
+
+func (i *float64CounterDelegate) Add(ctx context.Context, incr float64, options ...ometric.AddOption) {
+	i.v.Load().Add(ctx, incr, options...)
+}
+
+func (i *float64CounterDelegate) Enabled(ctx context.Context) bool {
+	return i.v.Load().Enabled(ctx)
+}
+
+type float64UpDownCounterDelegate struct {
+	embedded.Float64UpDownCounter
+	instrument[ometric.Float64UpDownCounter]
+}
+
+func (i *float64UpDownCounterDelegate) Add(ctx context.Context, incr float64, options ...ometric.AddOption) {
+	i.v.Load().Add(ctx, incr, options...)
+}
+
+func (i *float64UpDownCounterDelegate) Enabled(ctx context.Context) bool {
+	return i.v.Load().Enabled(ctx)
+}
+
+type float64HistogramDelegate struct {
+	embedded.Float64Histogram
+	instrument[ometric.Float64Histogram]
+}
+
+func (i *float64HistogramDelegate) Record(ctx context.Context, incr float64, options ...ometric.RecordOption) {
+	i.v.Load().Record(ctx, incr, options...)
+}
+
+func (i *float64HistogramDelegate) Enabled(ctx context.Context) bool {
+	return i.v.Load().Enabled(ctx)
+}
+
+type float64GaugeDelegate struct {
+	embedded.Float64Gauge
+	instrument[ometric.Float64Gauge]
+}
+
+func (i *float64GaugeDelegate) Record(ctx context.Context, value float64, options ...ometric.RecordOption) {
+	i.v.Load().Record(ctx, value, options...)
+}
+
+func (i *float64GaugeDelegate) Enabled(ctx context.Context) bool {
+	return i.v.Load().Enabled(ctx)
+}
+
+// Observable instruments carry unexported marker methods, so their delegates
+// embed the interface to satisfy it; only the delegate's own methods are ever
+// called.
+
+type int64ObservableCounterDelegate struct {
+	ometric.Int64ObservableCounter
+	instrument[ometric.Int64ObservableCounter]
+}
+
+func (i *int64ObservableCounterDelegate) unwrap() ometric.Observable { return i.v.Load() }
+
+type int64ObservableUpDownCounterDelegate struct {
+	ometric.Int64ObservableUpDownCounter
+	instrument[ometric.Int64ObservableUpDownCounter]
+}
+
+func (i *int64ObservableUpDownCounterDelegate) unwrap() ometric.Observable { return i.v.Load() }
+
+type int64ObservableGaugeDelegate struct {
+	ometric.Int64ObservableGauge
+	instrument[ometric.Int64ObservableGauge]
+}
+
+func (i *int64ObservableGaugeDelegate) unwrap() ometric.Observable { return i.v.Load() }
+
+type float64ObservableCounterDelegate struct {
+	ometric.Float64ObservableCounter
+	instrument[ometric.Float64ObservableCounter]
+}
+
+func (i *float64ObservableCounterDelegate) unwrap() ometric.Observable { return i.v.Load() }
+
+type float64ObservableUpDownCounterDelegate struct {
+	ometric.Float64ObservableUpDownCounter
+	instrument[ometric.Float64ObservableUpDownCounter]
+}
+
+func (i *float64ObservableUpDownCounterDelegate) unwrap() ometric.Observable { return i.v.Load() }
+
+type float64ObservableGaugeDelegate struct {
+	ometric.Float64ObservableGauge
+	instrument[ometric.Float64ObservableGauge]
+}
+
+func (i *float64ObservableGaugeDelegate) unwrap() ometric.Observable { return i.v.Load() }
@@ -0,0 +1,136 @@
+package mkot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+)
+
+// k8sDetector detects the pod, namespace, and node from the environment
+// variables a pod spec sets through the downward API:
+//
+//	env:
+//	  - name: K8S_POD_NAME
+//	    valueFrom: { fieldRef: { fieldPath: metadata.name } }
+//	  - name: K8S_NAMESPACE_NAME
+//	    valueFrom: { fieldRef: { fieldPath: metadata.namespace } }
+//	  - name: K8S_NODE_NAME
+//	    valueFrom: { fieldRef: { fieldPath: spec.nodeName } }
+//
+// Without them, the namespace is read from the service account and the pod
+// name is the hostname, which is the pod name unless the pod spec sets one.
+type k8sDetector struct{}
+
+const k8sNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+func (k8sDetector) Detect(ctx context.Context) (*resource.Resource, error) {
+	kvs := []attribute.KeyValue{}
+
+	_, in_cluster := os.LookupEnv("KUBERNETES_SERVICE_HOST")
+	if v := os.Getenv("K8S_POD_NAME"); v != "" {
+		kvs = append(kvs, semconv.K8SPodName(v))
+	} else if in_cluster {
+		if v, err := os.Hostname(); err == nil {
+			kvs = append(kvs, semconv.K8SPodName(v))
+		}
+	}
+	if v := os.Getenv("K8S_NAMESPACE_NAME"); v != "" {
+		kvs = append(kvs, semconv.K8SNamespaceName(v))
+	} else if data, err := os.ReadFile(k8sNamespaceFile); err == nil {
+		kvs = append(kvs, semconv.K8SNamespaceName(strings.TrimSpace(string(data))))
+	}
+	if v := os.Getenv("K8S_NODE_NAME"); v != "" {
+		kvs = append(kvs, semconv.K8SNodeName(v))
+	}
+
+	return resource.NewWithAttributes(semconv.SchemaURL, kvs...), nil
+}
+
+// machineIdDetector detects host.id from the machine id systemd and D-Bus
+// keep, on any platform, so a container sees the id of the host it is
+// mounted from.
+type machineIdDetector struct{}
+
+func (machineIdDetector) Detect(ctx context.Context) (*resource.Resource, error) {
+	errs := []error{}
+	for _, p := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if v := strings.TrimSpace(string(data)); v != "" {
+			return resource.NewWithAttributes(semconv.SchemaURL, semconv.HostID(v)), nil
+		}
+	}
+	return nil, fmt.Errorf("machine id: %w", errors.Join(errs...))
+}
+
+// serviceInstanceIdDetector sets a random UUID as service.instance.id. The
+// UUID is generated once per process, so it stays the same across reloads and
+// for every provider.
+type serviceInstanceIdDetector struct{}
+
+var serviceInstanceId = sync.OnceValues(uuid.NewRandom)
+
+func (serviceInstanceIdDetector) Detect(ctx context.Context) (*resource.Resource, error) {
+	v, err := serviceInstanceId()
+	if err != nil {
+		return nil, fmt.Errorf("generate service instance id: %w", err)
+	}
+	return resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceInstanceID(v.String())), nil
+}
+
+// fileDetector reads attributes from a file of `key=value` lines, such as the
+// labels or annotations file of a downward API volume. A value may be double
+// quoted, and blank lines and lines starting with `#` are skipped.
+type fileDetector struct {
+	path string
+}
+
+func (d fileDetector) Detect(ctx context.Context) (*resource.Resource, error) {
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		return nil, err
+	}
+
+	kvs := []attribute.KeyValue{}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for i := 1; s.Scan(); i++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: want key=value", d.path, i)
+		}
+		k = strings.TrimSpace(k)
+		v = strings.TrimSpace(v)
+		if strings.HasPrefix(v, `"`) {
+			v_, err := strconv.Unquote(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", d.path, i, err)
+			}
+			v = v_
+		}
+		kvs = append(kvs, attribute.String(k, v))
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return resource.NewSchemaless(kvs...), nil
+}
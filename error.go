@@ -5,4 +5,5 @@ import "errors"
 var (
 	ErrNotExist      = errors.New("not exist")
 	ErrUnimplemented = errors.New("unimplemented")
+	ErrClosed        = errors.New("closed")
 )
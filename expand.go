@@ -0,0 +1,169 @@
+package mkot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/token"
+)
+
+// Expansion follows the collector's config resolver: `${env:VAR}`,
+// `${env:VAR:-default}`, `${VAR}` (same as `${env:VAR}`) and `${file:/path}`
+// are replaced in scalar values, and `$$` escapes a literal `$`. Mapping keys
+// are never expanded.
+//
+// See https://opentelemetry.io/docs/collector/configuration/#environment-variables
+
+// expandNode expands references in every scalar value under the given node in
+// place. The result is meant to be re-marshaled and decoded, so an expanded
+// value is quoted to keep it a string unless the whole scalar was a single
+// unquoted reference that yields a boolean or an empty value, which is left
+// plain to decode as the typed value (e.g. `enabled: ${env:ENABLED}`).
+func expandNode(node ast.Node) error {
+	v := &expander{}
+	ast.Walk(v, node)
+	return errors.Join(v.errs...)
+}
+
+type expander struct {
+	errs []error
+}
+
+func (e *expander) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.MappingValueNode:
+		if n.Value != nil {
+			ast.Walk(e, n.Value)
+		}
+		return nil
+
+	case *ast.LiteralNode:
+		if n.Value == nil {
+			return nil
+		}
+		v, _, err := expand(n.Value.Value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: %w", n.GetPath(), err))
+			return nil
+		}
+		n.Value.Value = v
+		return nil
+
+	case *ast.StringNode:
+		v, whole, err := expand(n.Value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: %w", n.GetPath(), err))
+			return nil
+		}
+		if v == n.Value {
+			return nil
+		}
+
+		n.Value = v
+		switch n.Token.Type {
+		case token.SingleQuoteType, token.DoubleQuoteType:
+			// A quoted reference stays a string whatever it expands to.
+		default:
+			if whole && (v == "" || v == "true" || v == "false") {
+				n.Token.Type = token.StringType
+			} else {
+				n.Token.Type = token.DoubleQuoteType
+			}
+		}
+		return nil
+	}
+
+	return e
+}
+
+// expand resolves every reference in s. whole reports whether s consisted of
+// exactly one reference.
+func expand(s string) (v string, whole bool, err error) {
+	if !strings.Contains(s, "$") {
+		return s, false, nil
+	}
+
+	whole = strings.HasPrefix(s, "${") && strings.IndexByte(s, '}') == len(s)-1
+
+	b := strings.Builder{}
+	rest := s
+	for {
+		i := strings.IndexByte(rest, '$')
+		if i < 0 || i == len(rest)-1 {
+			b.WriteString(rest)
+			break
+		}
+
+		b.WriteString(rest[:i])
+		rest = rest[i:]
+		switch rest[1] {
+		case '$':
+			b.WriteByte('$')
+			rest = rest[2:]
+			continue
+		case '{':
+		default:
+			b.WriteByte('$')
+			rest = rest[1:]
+			continue
+		}
+
+		end := strings.IndexByte(rest, '}')
+		if end < 0 {
+			return "", false, fmt.Errorf("unterminated reference %q", rest)
+		}
+
+		ref := rest[2:end]
+		v, err := resolveRef(ref)
+		if err != nil {
+			return "", false, fmt.Errorf("${%s}: %w", ref, err)
+		}
+
+		b.WriteString(v)
+		rest = rest[end+1:]
+	}
+
+	return b.String(), whole, nil
+}
+
+func resolveRef(ref string) (string, error) {
+	scheme, body, ok := strings.Cut(ref, ":")
+	if !ok || strings.HasPrefix(body, "-") {
+		// `${VAR}` and `${VAR:-default}` use the env scheme.
+		scheme, body = "env", ref
+	}
+
+	switch scheme {
+	case "env":
+		name, def, has_def := strings.Cut(body, ":-")
+		if name == "" {
+			return "", errors.New("empty variable name")
+		}
+		if v, ok := os.LookupEnv(name); ok && (v != "" || !has_def) {
+			return v, nil
+		}
+		return def, nil
+
+	case "file":
+		if body == "" {
+			return "", errors.New("empty file path")
+		}
+		data, err := os.ReadFile(body)
+		if err != nil {
+			return "", err
+		}
+
+		// Files holding a secret usually end with a newline the value does not
+		// include.
+		v := string(data)
+		v = strings.TrimSuffix(v, "\n")
+		v = strings.TrimSuffix(v, "\r")
+		return v, nil
+
+	default:
+		return "", fmt.Errorf("unknown scheme %q (want env or file)", scheme)
+	}
+}
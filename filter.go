@@ -0,0 +1,242 @@
+package mkot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Filter drops the spans, log records, and metric streams that are not
+// included or are excluded, like the collector's filter processor. Only the
+// providers of the signals it has a section for can list it.
+//
+// The numbers of items dropped so far are reported by [Filter.Dropped].
+type Filter struct {
+	UnimplementedProcessorConfig `yaml:"-"`
+
+	Spans   *FilterConfig       `yaml:"spans,omitempty"`
+	Logs    *FilterConfig       `yaml:"logs,omitempty"`
+	Metrics *MetricFilterConfig `yaml:"metrics,omitempty"`
+
+	dropped struct {
+		spans   atomic.Int64
+		logs    atomic.Int64
+		metrics atomic.Int64
+	}
+}
+
+// FilterConfig keeps the items that match Include, if given, and do not match
+// Exclude.
+type FilterConfig struct {
+	Include *MatchConfig `yaml:"include,omitempty"`
+	Exclude *MatchConfig `yaml:"exclude,omitempty"`
+}
+
+// MetricFilterConfig keeps the instruments that match Include, if given, and
+// do not match Exclude. The others are dropped by a view, unless another view
+// matches them too.
+type MetricFilterConfig struct {
+	Include *MetricMatchConfig `yaml:"include,omitempty"`
+	Exclude *MetricMatchConfig `yaml:"exclude,omitempty"`
+}
+
+type MetricMatchConfig struct {
+	// MatchType is how the names are compared: "strict" (default) or
+	// "regexp".
+	MatchType string `yaml:"match_type,omitempty"`
+
+	MetricNames []string `yaml:"metric_names"`
+}
+
+// FilterDropped is the number of items a [Filter] dropped. Spans and logs are
+// counted for each exporter they are dropped for, and metrics for each
+// instrument a meter provider creates.
+type FilterDropped struct {
+	Spans   int64
+	Logs    int64
+	Metrics int64
+}
+
+// Dropped returns the number of items dropped by every pipeline the filter is
+// in.
+func (c *Filter) Dropped() FilterDropped {
+	return FilterDropped{
+		Spans:   c.dropped.spans.Load(),
+		Logs:    c.dropped.logs.Load(),
+		Metrics: c.dropped.metrics.Load(),
+	}
+}
+
+func (c *Filter) TracerOpts(ctx context.Context) ([]trace.TracerProviderOption, error) {
+	if c.Spans == nil {
+		return nil, nil
+	}
+	// Spans are dropped by WrapSpanProcessor.
+	if _, err := c.Spans.selector("traces"); err != nil {
+		return nil, fmt.Errorf("spans: %w", err)
+	}
+	return []trace.TracerProviderOption{}, nil
+}
+
+func (c *Filter) MeterOpts(ctx context.Context) ([]metric.Option, error) {
+	if c.Metrics == nil {
+		return nil, nil
+	}
+	include, err := c.Metrics.Include.compile()
+	if err != nil {
+		return nil, fmt.Errorf("metrics: include: %w", err)
+	}
+	exclude, err := c.Metrics.Exclude.compile()
+	if err != nil {
+		return nil, fmt.Errorf("metrics: exclude: %w", err)
+	}
+
+	view := func(i metric.Instrument) (metric.Stream, bool) {
+		if (include == nil || include(i.Name)) && (exclude == nil || !exclude(i.Name)) {
+			return metric.Stream{}, false
+		}
+		c.dropped.metrics.Add(1)
+		return metric.Stream{Name: i.Name, Aggregation: metric.AggregationDrop{}}, true
+	}
+	return []metric.Option{metric.WithView(view)}, nil
+}
+
+func (c *Filter) LoggerOpts(ctx context.Context) ([]log.LoggerProviderOption, error) {
+	if c.Logs == nil {
+		return nil, nil
+	}
+	// Records are dropped by WrapLogProcessor.
+	if _, err := c.Logs.selector("logs"); err != nil {
+		return nil, fmt.Errorf("logs: %w", err)
+	}
+	return []log.LoggerProviderOption{}, nil
+}
+
+func (c *Filter) WrapSpanProcessor(ctx context.Context, p trace.SpanProcessor) (trace.SpanProcessor, error) {
+	if c.Spans == nil {
+		return p, nil
+	}
+	s, err := c.Spans.selector("traces")
+	if err != nil {
+		return nil, fmt.Errorf("spans: %w", err)
+	}
+	return filterSpanProcessor{p, s, &c.dropped.spans}, nil
+}
+
+func (c *Filter) WrapLogProcessor(ctx context.Context, p log.Processor) (log.Processor, error) {
+	if c.Logs == nil {
+		return p, nil
+	}
+	s, err := c.Logs.selector("logs")
+	if err != nil {
+		return nil, fmt.Errorf("logs: %w", err)
+	}
+	return filterLogProcessor{p, s, &c.dropped.logs}, nil
+}
+
+func (c *FilterConfig) selector(signal string) (selector, error) {
+	if c.Include == nil && c.Exclude == nil {
+		return selector{}, errors.New("include or exclude is required")
+	}
+	return newSelector(c.Include, c.Exclude, signal)
+}
+
+// compile returns the function that reports if a name matches c, or nil if c
+// is nil.
+func (c *MetricMatchConfig) compile() (func(string) bool, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if len(c.MetricNames) == 0 {
+		return nil, errors.New("metric_names is required")
+	}
+
+	fs := []func(string) bool{}
+	for i, v := range c.MetricNames {
+		switch c.MatchType {
+		case "", "strict":
+			fs = append(fs, func(s string) bool { return s == v })
+		case "regexp":
+			re, err := regexp.Compile(v)
+			if err != nil {
+				return nil, fmt.Errorf("metric_names[%d]: %w", i, err)
+			}
+			fs = append(fs, re.MatchString)
+		default:
+			return nil, fmt.Errorf("unknown match_type %q (want strict or regexp)", c.MatchType)
+		}
+	}
+	return func(s string) bool { return matchAny(fs, s) }, nil
+}
+
+type filterSpanProcessor struct {
+	next    trace.SpanProcessor
+	s       selector
+	dropped *atomic.Int64
+}
+
+func (p filterSpanProcessor) OnStart(parent context.Context, s trace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p filterSpanProcessor) OnEnd(s trace.ReadOnlySpan) {
+	if !p.s.selects(spanItem(s)) {
+		p.dropped.Add(1)
+		return
+	}
+	p.next.OnEnd(s)
+}
+
+func (p filterSpanProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p filterSpanProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+func (p filterSpanProcessor) Pending() int64 {
+	return pendingOf(p.next)
+}
+
+type filterLogProcessor struct {
+	next    log.Processor
+	s       selector
+	dropped *atomic.Int64
+}
+
+func (p filterLogProcessor) Enabled(ctx context.Context, param log.EnabledParameters) bool {
+	return p.next.Enabled(ctx, param)
+}
+
+func (p filterLogProcessor) OnEmit(ctx context.Context, r *log.Record) error {
+	if !p.s.selects(recordItem(r)) {
+		p.dropped.Add(1)
+		return nil
+	}
+	return p.next.OnEmit(ctx, r)
+}
+
+func (p filterLogProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p filterLogProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+func (p filterLogProcessor) Pending() int64 {
+	return pendingOf(p.next)
+}
+
+func init() {
+	DefaultProcessorRegistry.Set("filter", func() ProcessorConfig {
+		return &Filter{}
+	})
+}
@@ -0,0 +1,181 @@
+package mkot_test
+
+import (
+	"testing"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lesomnus/mkot"
+	"github.com/lesomnus/mkot/internal/x"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	olog "go.opentelemetry.io/otel/log"
+	otrace "go.opentelemetry.io/otel/trace"
+)
+
+func TestFilter(t *testing.T) {
+	ctx, x := x.New(t)
+
+	e := &componentExporterConfig{}
+	reader := &manualReaderConfig{}
+	c := mkot.NewConfig()
+	err := yaml.Unmarshal([]byte(`
+processors:
+  filter:
+    spans:
+      exclude:
+        match_type: regexp
+        span_names: ["^GET /health"]
+        span_kinds: [server]
+    logs:
+      include:
+        severity_number:
+          min: INFO
+      exclude:
+        libraries:
+          - name: noisy
+    metrics:
+      exclude:
+        match_type: regexp
+        metric_names: ["^debug\\."]
+`), c)
+	x.NoError(err)
+	c.Exporters["e"] = e
+	c.Exporters["reader"] = reader
+	c.Providers = map[mkot.Id]*mkot.ProviderConfig{
+		"tracer": {Processors: []mkot.Id{"filter"}, Exporters: []mkot.Id{"e"}},
+		"meter":  {Processors: []mkot.Id{"filter"}, Exporters: []mkot.Id{"reader"}},
+		"logger": {Processors: []mkot.Id{"filter"}, Exporters: []mkot.Id{"e"}},
+	}
+	x.NoError(c.Validate(ctx))
+
+	r := mkot.Make(ctx, c)
+	tp, err := r.Tracer(ctx, "")
+	x.NoError(err)
+	mp, err := r.Meter(ctx, "")
+	x.NoError(err)
+	lp, err := r.Logger(ctx, "")
+	x.NoError(err)
+
+	_, span := tp.Tracer("t").Start(ctx, "GET /healthz", otrace.WithSpanKind(otrace.SpanKindServer))
+	span.End()
+	_, span = tp.Tracer("t").Start(ctx, "GET /healthz", otrace.WithSpanKind(otrace.SpanKindClient))
+	span.End()
+	_, span = tp.Tracer("t").Start(ctx, "GET /paper", otrace.WithSpanKind(otrace.SpanKindServer))
+	span.SetStatus(codes.Error, "out of paper")
+	span.End()
+
+	emit := func(scope string, severity olog.Severity) {
+		rec := olog.Record{}
+		rec.SetSeverity(severity)
+		lp.Logger(scope).Emit(ctx, rec)
+	}
+	emit("app", olog.SeverityDebug)
+	emit("app", olog.SeverityWarn)
+	emit("noisy", olog.SeverityError)
+
+	m := mp.Meter("m")
+	counter, err := m.Int64Counter("requests")
+	x.NoError(err)
+	counter.Add(ctx, 1)
+	debug, err := m.Int64Counter("debug.requests")
+	x.NoError(err)
+	debug.Add(ctx, 10)
+
+	spans := e.spans.GetSpans()
+	x.Eq(2, len(spans))
+	x.Eq(otrace.SpanKindClient, spans[0].SpanKind)
+	x.Eq("GET /paper", spans[1].Name)
+
+	x.Eq(1, len(e.records.records))
+	x.Eq(olog.SeverityWarn, e.records.records[0].Severity())
+
+	x.Eq(int64(1), reader.sum(ctx, t))
+
+	f := c.Processors["filter"].(*mkot.Filter)
+	x.Eq(mkot.FilterDropped{Spans: 1, Logs: 2, Metrics: 1}, f.Dropped())
+	x.NoError(r.Shutdown(ctx))
+}
+
+func TestFilterInvalid(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := mkot.NewConfig()
+	c.Processors["filter"] = &mkot.Filter{
+		Spans: &mkot.FilterConfig{Exclude: &mkot.MatchConfig{SpanKinds: []string{"sideways"}}},
+	}
+	c.Processors["filter/logs"] = &mkot.Filter{
+		Logs: &mkot.FilterConfig{Include: &mkot.MatchConfig{SeverityNumber: &mkot.SeverityMatch{Min: "LOUD"}}},
+	}
+	c.Processors["filter/metrics"] = &mkot.Filter{
+		Metrics: &mkot.MetricFilterConfig{Exclude: &mkot.MetricMatchConfig{}},
+	}
+	c.Exporters["e"] = &componentExporterConfig{}
+	c.Exporters["reader"] = &manualReaderConfig{}
+	c.Providers["tracer"] = &mkot.ProviderConfig{Processors: []mkot.Id{"filter"}, Exporters: []mkot.Id{"e"}}
+	c.Providers["tracer/logs"] = &mkot.ProviderConfig{Processors: []mkot.Id{"filter/logs"}, Exporters: []mkot.Id{"e"}}
+	c.Providers["logger"] = &mkot.ProviderConfig{Processors: []mkot.Id{"filter/logs"}, Exporters: []mkot.Id{"e"}}
+	c.Providers["meter"] = &mkot.ProviderConfig{Processors: []mkot.Id{"filter/metrics"}, Exporters: []mkot.Id{"reader"}}
+
+	err := c.Validate(ctx)
+	x.Contains(err.Error(), `processor "filter": spans: exclude: span_kinds[0]: unknown span kind "sideways"`)
+	x.Contains(err.Error(), `processor "filter/logs": not for the tracer`)
+	x.Contains(err.Error(), `processor "filter/logs": logs: include: severity_number: unknown severity "LOUD"`)
+	x.Contains(err.Error(), `processor "filter/metrics": metrics: exclude: metric_names is required`)
+}
+
+func TestFilterOrder(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := mkot.NewConfig()
+	err := yaml.Unmarshal([]byte(`
+processors:
+  filter:
+    spans:
+      exclude:
+        attributes:
+          - key: secret
+    logs:
+      exclude:
+        attributes:
+          - key: secret
+  attributes:
+    actions:
+      - key: secret
+        action: delete
+`), c)
+	x.NoError(err)
+
+	// The filter sees the attribute only if it is listed before the
+	// attributes processor deletes it, for spans and logs alike.
+	for _, tc := range []struct {
+		processors []mkot.Id
+		exported   int
+	}{
+		{[]mkot.Id{"filter", "attributes"}, 0},
+		{[]mkot.Id{"attributes", "filter"}, 1},
+	} {
+		e := &componentExporterConfig{}
+		c.Exporters = map[mkot.Id]mkot.ExporterConfig{"e": e}
+		c.Providers = map[mkot.Id]*mkot.ProviderConfig{
+			"tracer": {Processors: tc.processors, Exporters: []mkot.Id{"e"}},
+			"logger": {Processors: tc.processors, Exporters: []mkot.Id{"e"}},
+		}
+		x.NoError(c.Validate(ctx))
+
+		r := mkot.Make(ctx, c)
+		tp, err := r.Tracer(ctx, "")
+		x.NoError(err)
+		lp, err := r.Logger(ctx, "")
+		x.NoError(err)
+
+		_, span := tp.Tracer("t").Start(ctx, "s", otrace.WithAttributes(attribute.String("secret", "s")))
+		span.End()
+		rec := olog.Record{}
+		rec.AddAttributes(olog.String("secret", "s"))
+		lp.Logger("l").Emit(ctx, rec)
+
+		x.Eq(tc.exported, len(e.spans.GetSpans()))
+		x.Eq(tc.exported, len(e.records.records))
+		x.NoError(r.Shutdown(ctx))
+	}
+}
@@ -56,6 +56,17 @@ func (id Id) WithName(name string) Id {
 	return Id(v + "/" + name)
 }
 
+// parent returns the id without the last segment of its name, so
+// "tracer/db/pg" becomes "tracer/db" and "tracer/db" becomes "tracer". An id
+// without a name has no parent.
+func (id Id) parent() (Id, bool) {
+	i := strings.LastIndex(string(id), typeAndNameSeparator)
+	if i < 0 {
+		return id, false
+	}
+	return id[:i], true
+}
+
 func (id Id) MarshalText() (text []byte, err error) {
 	return []byte(id), nil
 }
@@ -0,0 +1,343 @@
+package mkot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// jaegerRemoteSampler samples by the strategy of its service, fetched from a
+// Jaeger sampling endpoint or read from a Jaeger strategies file. Like
+// [certReloader], it refreshes the strategy on use once the polling interval
+// has elapsed, in the background, and keeps the last good one on errors. The
+// endpoint is first fetched on the first use, so building the sampler sends
+// no request. Polls stop once ctx is done, which the provider's shutdown does.
+type jaegerRemoteSampler struct {
+	ctx      context.Context
+	service  string
+	interval time.Duration
+	timeout  time.Duration // Of each fetch.
+	fetch    func(ctx context.Context) ([]byte, error)
+
+	current  atomic.Pointer[trace.Sampler]
+	polling  atomic.Bool
+	due      atomic.Int64 // Unix nanoseconds of the next poll.
+	mu       sync.Mutex   // Serializes updates.
+	strategy []byte       // The strategy current is built from.
+}
+
+func (c *Sampler) buildJaegerRemote(ctx context.Context) (trace.Sampler, error) {
+	service := c.ServiceName
+	if service == "" {
+		service = os.Getenv("OTEL_SERVICE_NAME")
+	}
+	if service == "" {
+		return nil, errors.New("jaeger_remote: service_name is required")
+	}
+	if (c.Endpoint == "") == (c.File == "") {
+		return nil, errors.New("jaeger_remote: either endpoint or file is required")
+	}
+	if c.PollingInterval < 0 {
+		return nil, errors.New("jaeger_remote: polling_interval must not be negative")
+	}
+
+	initial := trace.TraceIDRatioBased(0.001)
+	if c.InitialSampler != nil {
+		v, err := c.InitialSampler.build(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("jaeger_remote: initial_sampler: %w", err)
+		}
+		initial = v
+	}
+
+	s := &jaegerRemoteSampler{
+		ctx:      ctx,
+		service:  service,
+		interval: c.PollingInterval,
+	}
+	if s.interval == 0 {
+		s.interval = time.Minute
+	}
+	s.timeout = min(s.interval, 10*time.Second)
+	s.current.Store(&initial)
+
+	if c.File != "" {
+		s.fetch = s.readFile(c.File)
+		// The file is there for offline use, so it is read up front.
+		if err := s.update(); err != nil {
+			return nil, fmt.Errorf("jaeger_remote: %w", err)
+		}
+		return s, nil
+	}
+
+	u, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("jaeger_remote: endpoint: %w", err)
+	}
+	q := u.Query()
+	q.Set("service", service)
+	u.RawQuery = q.Encode()
+	s.fetch = s.get(u.String())
+	return s, nil
+}
+
+func (s *jaegerRemoteSampler) get(u string) func(ctx context.Context) ([]byte, error) {
+	client := &http.Client{}
+	return func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+
+		b, err := io.ReadAll(res.Body)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %s: %s", res.Status, bytes.TrimSpace(b))
+		}
+		return b, nil
+	}
+}
+
+func (s *jaegerRemoteSampler) readFile(p string) func(ctx context.Context) ([]byte, error) {
+	return func(ctx context.Context) ([]byte, error) {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		f := jaegerStrategiesFile{}
+		if err := json.Unmarshal(b, &f); err != nil {
+			return nil, fmt.Errorf("file: %w", err)
+		}
+		v, err := f.strategy(s.service)
+		if err != nil {
+			return nil, fmt.Errorf("file: %w", err)
+		}
+		return json.Marshal(v)
+	}
+}
+
+// poll updates the strategy in the background if it is due, no update is
+// running, and the sampler is not stopped.
+func (s *jaegerRemoteSampler) poll() {
+	if time.Now().UnixNano() < s.due.Load() || s.ctx.Err() != nil || !s.polling.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer s.polling.Store(false)
+		if err := s.update(); err != nil && s.ctx.Err() == nil {
+			otel.Handle(fmt.Errorf("jaeger_remote: %w", err))
+		}
+	}()
+}
+
+// update fetches the strategy, giving up after the timeout or once the
+// sampler is stopped.
+func (s *jaegerRemoteSampler) update() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.due.Store(time.Now().Add(s.interval).UnixNano())
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.timeout)
+	defer cancel()
+	b, err := s.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	// An unchanged strategy keeps the state of its rate limiters.
+	if bytes.Equal(b, s.strategy) {
+		return nil
+	}
+
+	v := jaegerStrategy{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fmt.Errorf("strategy: %w", err)
+	}
+	sampler, err := v.sampler()
+	if err != nil {
+		return fmt.Errorf("strategy: %w", err)
+	}
+	s.current.Store(&sampler)
+	s.strategy = b
+	return nil
+}
+
+func (s *jaegerRemoteSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	s.poll()
+	return (*s.current.Load()).ShouldSample(p)
+}
+
+func (s *jaegerRemoteSampler) Description() string {
+	return fmt.Sprintf("JaegerRemote{%s}", (*s.current.Load()).Description())
+}
+
+// jaegerStrategy is the response of a Jaeger sampling endpoint.
+type jaegerStrategy struct {
+	// StrategyType is "PROBABILISTIC" or "RATE_LIMITING", or 0 or 1 in the
+	// older encoding.
+	StrategyType          any                          `json:"strategyType,omitempty"`
+	ProbabilisticSampling *jaegerProbabilisticSampling `json:"probabilisticSampling,omitempty"`
+	RateLimitingSampling  *jaegerRateLimitingSampling  `json:"rateLimitingSampling,omitempty"`
+	OperationSampling     *jaegerOperationSampling     `json:"operationSampling,omitempty"`
+}
+
+type jaegerProbabilisticSampling struct {
+	SamplingRate float64 `json:"samplingRate"`
+}
+
+type jaegerRateLimitingSampling struct {
+	MaxTracesPerSecond float64 `json:"maxTracesPerSecond"`
+}
+
+type jaegerOperationSampling struct {
+	DefaultSamplingProbability       float64                   `json:"defaultSamplingProbability"`
+	DefaultLowerBoundTracesPerSecond float64                   `json:"defaultLowerBoundTracesPerSecond"`
+	PerOperationStrategies           []jaegerOperationStrategy `json:"perOperationStrategies"`
+}
+
+type jaegerOperationStrategy struct {
+	Operation             string                      `json:"operation"`
+	ProbabilisticSampling jaegerProbabilisticSampling `json:"probabilisticSampling"`
+}
+
+func (v *jaegerStrategy) sampler() (trace.Sampler, error) {
+	if o := v.OperationSampling; o != nil {
+		s := &jaegerOperationSampler{
+			operations: map[string]trace.Sampler{},
+			fallback:   newGuaranteedThroughputSampler(o.DefaultSamplingProbability, o.DefaultLowerBoundTracesPerSecond),
+		}
+		for _, op := range o.PerOperationStrategies {
+			s.operations[op.Operation] = newGuaranteedThroughputSampler(op.ProbabilisticSampling.SamplingRate, o.DefaultLowerBoundTracesPerSecond)
+		}
+		return s, nil
+	}
+
+	rate_limiting := false
+	switch t := v.StrategyType.(type) {
+	case string:
+		rate_limiting = t == "RATE_LIMITING"
+	case float64:
+		rate_limiting = t == 1
+	}
+	if rate_limiting || v.ProbabilisticSampling == nil {
+		if v.RateLimitingSampling == nil {
+			return nil, errors.New("no sampling strategy")
+		}
+		return newRateLimitingSampler(v.RateLimitingSampling.MaxTracesPerSecond), nil
+	}
+	return trace.TraceIDRatioBased(v.ProbabilisticSampling.SamplingRate), nil
+}
+
+// jaegerOperationSampler samples by the sampler of the span's name.
+type jaegerOperationSampler struct {
+	operations map[string]trace.Sampler
+	fallback   trace.Sampler
+}
+
+func (s *jaegerOperationSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	if v, ok := s.operations[p.Name]; ok {
+		return v.ShouldSample(p)
+	}
+	return s.fallback.ShouldSample(p)
+}
+
+func (s *jaegerOperationSampler) Description() string {
+	return fmt.Sprintf("PerOperation{operations:%d}", len(s.operations))
+}
+
+// guaranteedThroughputSampler samples by a probability, but at least at the
+// lower bound rate.
+type guaranteedThroughputSampler struct {
+	probability trace.Sampler
+	lower_bound *rateLimitingSampler
+}
+
+func newGuaranteedThroughputSampler(probability float64, lower_bound float64) trace.Sampler {
+	s := &guaranteedThroughputSampler{probability: trace.TraceIDRatioBased(probability)}
+	if lower_bound > 0 {
+		s.lower_bound = newRateLimitingSampler(lower_bound)
+	}
+	return s
+}
+
+func (s *guaranteedThroughputSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	r := s.probability.ShouldSample(p)
+	if r.Decision == trace.Drop && s.lower_bound != nil {
+		return s.lower_bound.ShouldSample(p)
+	}
+	return r
+}
+
+func (s *guaranteedThroughputSampler) Description() string {
+	return fmt.Sprintf("GuaranteedThroughput{%s}", s.probability.Description())
+}
+
+// jaegerStrategiesFile is the strategies file of the Jaeger collector.
+type jaegerStrategiesFile struct {
+	ServiceStrategies []jaegerFileStrategy `json:"service_strategies"`
+	DefaultStrategy   *jaegerFileStrategy  `json:"default_strategy"`
+}
+
+type jaegerFileStrategy struct {
+	Service             string                        `json:"service"`
+	Type                string                        `json:"type"`
+	Param               float64                       `json:"param"`
+	OperationStrategies []jaegerFileOperationStrategy `json:"operation_strategies"`
+}
+
+type jaegerFileOperationStrategy struct {
+	Operation string  `json:"operation"`
+	Type      string  `json:"type"`
+	Param     float64 `json:"param"`
+}
+
+// strategy returns the strategy of the service, or the default one.
+func (f *jaegerStrategiesFile) strategy(service string) (*jaegerStrategy, error) {
+	s := f.DefaultStrategy
+	for i, v := range f.ServiceStrategies {
+		if v.Service == service {
+			s = &f.ServiceStrategies[i]
+			break
+		}
+	}
+	if s == nil {
+		return nil, fmt.Errorf("no strategy for service %q", service)
+	}
+
+	switch s.Type {
+	case "probabilistic":
+		if len(s.OperationStrategies) == 0 {
+			return &jaegerStrategy{ProbabilisticSampling: &jaegerProbabilisticSampling{s.Param}}, nil
+		}
+		o := &jaegerOperationSampling{DefaultSamplingProbability: s.Param}
+		for _, op := range s.OperationStrategies {
+			if op.Type != "probabilistic" {
+				return nil, fmt.Errorf("operation %q: unsupported type %q", op.Operation, op.Type)
+			}
+			o.PerOperationStrategies = append(o.PerOperationStrategies, jaegerOperationStrategy{op.Operation, jaegerProbabilisticSampling{op.Param}})
+		}
+		return &jaegerStrategy{OperationSampling: o}, nil
+	case "ratelimiting", "rate_limiting":
+		return &jaegerStrategy{RateLimitingSampling: &jaegerRateLimitingSampling{s.Param}}, nil
+	default:
+		return nil, fmt.Errorf("unknown strategy type %q", s.Type)
+	}
+}
@@ -0,0 +1,327 @@
+package mkot_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lesomnus/mkot"
+	"github.com/lesomnus/mkot/internal/x"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// strategyServer serves the strategy set to the services queried.
+type strategyServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	strategy string
+	services []string
+	ready    chan struct{} // Blocks the responses until closed, if given.
+}
+
+func newStrategyServer(t *testing.T, strategy string) *strategyServer {
+	s := &strategyServer{strategy: strategy}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.services = append(s.services, r.URL.Query().Get("service"))
+		ready := s.ready
+		s.mu.Unlock()
+		if ready != nil {
+			<-ready
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(s.strategy))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *strategyServer) set(strategy string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.strategy = strategy
+}
+
+func TestSamplerJaegerRemote(t *testing.T) {
+	ctx, x := x.New(t)
+
+	srv := newStrategyServer(t, `{"strategyType":"PROBABILISTIC","probabilisticSampling":{"samplingRate":0}}`)
+	srv.ready = make(chan struct{})
+
+	c := mkot.NewConfig()
+	err := yaml.Unmarshal([]byte(`
+processors:
+  sampler:
+    type: jaeger_remote
+    endpoint: `+srv.URL+`/sampling
+    service_name: foo
+    polling_interval: 10ms
+    initial_sampler:
+      type: always_on
+`), c)
+	x.NoError(err)
+	opts, err := c.Processors["sampler"].TracerOpts(ctx)
+	x.NoError(err)
+	tracer := trace.NewTracerProvider(opts...).Tracer("t")
+
+	sampled := func(name string) bool {
+		_, span := tracer.Start(ctx, name)
+		defer span.End()
+		return span.SpanContext().IsSampled()
+	}
+	eventually := func(name string, want bool) {
+		t.Helper()
+		for range 200 {
+			if sampled(name) == want {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("span %q is not sampled as %v", name, want)
+	}
+
+	// The initial sampler is used until the first fetch.
+	x.Eq(true, sampled("s"))
+	close(srv.ready)
+	eventually("s", false)
+	srv.mu.Lock()
+	x.Eq("foo", srv.services[0])
+	srv.mu.Unlock()
+
+	// Changes are picked up on the next poll.
+	srv.set(`{"strategyType":"PROBABILISTIC","probabilisticSampling":{"samplingRate":1}}`)
+	eventually("s", true)
+
+	srv.set(`{
+		"strategyType": "PROBABILISTIC",
+		"operationSampling": {
+			"defaultSamplingProbability": 0,
+			"perOperationStrategies": [
+				{"operation": "op", "probabilisticSampling": {"samplingRate": 1}}
+			]
+		}
+	}`)
+	eventually("s", false)
+	x.Eq(true, sampled("op"))
+}
+
+func TestSamplerJaegerRemoteFetchOnUse(t *testing.T) {
+	ctx, x := x.New(t)
+
+	srv := newStrategyServer(t, `{"strategyType":"PROBABILISTIC","probabilisticSampling":{"samplingRate":0}}`)
+	requests := func() int {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		return len(srv.services)
+	}
+
+	c := mkot.NewConfig()
+	c.Processors["sampler"] = &mkot.Sampler{
+		Type:            "jaeger_remote",
+		Endpoint:        srv.URL,
+		ServiceName:     "foo",
+		PollingInterval: time.Hour,
+		InitialSampler:  &mkot.Sampler{Type: "always_on"},
+	}
+	c.Exporters["span"] = &spanOnlyExporterConfig{}
+	c.Providers["tracer"] = &mkot.ProviderConfig{
+		Processors: []mkot.Id{"sampler"},
+		Exporters:  []mkot.Id{"span"},
+	}
+	x.NoError(c.Validate(ctx))
+
+	opts, err := c.Processors["sampler"].TracerOpts(ctx)
+	x.NoError(err)
+	tracer := trace.NewTracerProvider(opts...).Tracer("t")
+
+	// Neither validating nor building the sampler fetches the strategy.
+	time.Sleep(20 * time.Millisecond)
+	x.Eq(0, requests())
+
+	_, span := tracer.Start(ctx, "s")
+	span.End()
+	x.Eq(true, span.SpanContext().IsSampled())
+	for range 200 {
+		if requests() > 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	x.Eq(1, requests())
+}
+
+func TestSamplerJaegerRemoteRateLimiting(t *testing.T) {
+	ctx, x := x.New(t)
+
+	srv := newStrategyServer(t, `{"strategyType":1,"rateLimitingSampling":{"maxTracesPerSecond":2}}`)
+	s := &mkot.Sampler{
+		Type:            "jaeger_remote",
+		Endpoint:        srv.URL,
+		ServiceName:     "foo",
+		PollingInterval: time.Hour,
+		InitialSampler:  &mkot.Sampler{Type: "always_off"},
+	}
+	opts, err := s.TracerOpts(ctx)
+	x.NoError(err)
+	tracer := trace.NewTracerProvider(opts...).Tracer("t")
+
+	sampled := func() bool {
+		_, span := tracer.Start(ctx, "s")
+		defer span.End()
+		return span.SpanContext().IsSampled()
+	}
+	for range 200 {
+		if sampled() {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// One was sampled above; the bucket holds a second's worth.
+	n := 1
+	for range 10 {
+		if sampled() {
+			n++
+		}
+	}
+	x.Eq(2, n)
+}
+
+func TestSamplerJaegerRemoteFetchError(t *testing.T) {
+	ctx, x := x.New(t)
+
+	n := atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	s := &mkot.Sampler{
+		Type:            "jaeger_remote",
+		Endpoint:        srv.URL,
+		ServiceName:     "foo",
+		PollingInterval: 5 * time.Millisecond,
+		InitialSampler:  &mkot.Sampler{Type: "always_on"},
+	}
+	opts, err := s.TracerOpts(ctx)
+	x.NoError(err)
+	tracer := trace.NewTracerProvider(opts...).Tracer("t")
+
+	// The initial sampler is kept while the endpoint fails.
+	for n.Load() < 3 {
+		_, span := tracer.Start(ctx, "s")
+		span.End()
+		x.Eq(true, span.SpanContext().IsSampled())
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSamplerJaegerRemoteShutdown(t *testing.T) {
+	ctx, x := x.New(t)
+
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	defer srv.Close()
+
+	s := &mkot.Sampler{
+		Type:            "jaeger_remote",
+		Endpoint:        srv.URL,
+		ServiceName:     "foo",
+		PollingInterval: time.Hour,
+	}
+	opts, err := s.TracerOpts(ctx)
+	x.NoError(err)
+	tp := trace.NewTracerProvider(opts...)
+	_, span := tp.Tracer("t").Start(ctx, "s")
+	span.End()
+	<-started
+
+	// Shutting the provider down cancels the fetch in flight.
+	x.NoError(tp.Shutdown(ctx))
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fetch is not cancelled")
+	}
+}
+
+func TestSamplerJaegerRemoteFile(t *testing.T) {
+	ctx, x := x.New(t)
+
+	p := filepath.Join(t.TempDir(), "strategies.json")
+	x.NoError(os.WriteFile(p, []byte(`{
+		"service_strategies": [
+			{
+				"service": "foo",
+				"type": "probabilistic",
+				"param": 0,
+				"operation_strategies": [
+					{"operation": "op", "type": "probabilistic", "param": 1}
+				]
+			}
+		],
+		"default_strategy": {"type": "probabilistic", "param": 1}
+	}`), 0o644))
+
+	sampled := func(service string, name string) bool {
+		s := &mkot.Sampler{
+			Type:           "jaeger_remote",
+			File:           p,
+			ServiceName:    service,
+			InitialSampler: &mkot.Sampler{Type: "always_off"},
+		}
+		opts, err := s.TracerOpts(ctx)
+		x.NoError(err)
+		_, span := trace.NewTracerProvider(opts...).Tracer("t").Start(ctx, name)
+		defer span.End()
+		return span.SpanContext().IsSampled()
+	}
+
+	// The file is read before the first span.
+	x.Eq(false, sampled("foo", "s"))
+	x.Eq(true, sampled("foo", "op"))
+	x.Eq(true, sampled("bar", "s"))
+}
+
+func TestSamplerJaegerRemoteInvalid(t *testing.T) {
+	ctx, x := x.New(t)
+	t.Setenv("OTEL_SERVICE_NAME", "")
+
+	_, err := (&mkot.Sampler{Type: "jaeger_remote", Endpoint: "http://localhost"}).TracerOpts(ctx)
+	x.Contains(err.Error(), "jaeger_remote: service_name is required")
+
+	_, err = (&mkot.Sampler{Type: "jaeger_remote", ServiceName: "foo"}).TracerOpts(ctx)
+	x.Contains(err.Error(), "jaeger_remote: either endpoint or file is required")
+
+	_, err = (&mkot.Sampler{Type: "jaeger_remote", ServiceName: "foo", Endpoint: "http://localhost", File: "s.json"}).TracerOpts(ctx)
+	x.Contains(err.Error(), "jaeger_remote: either endpoint or file is required")
+
+	_, err = (&mkot.Sampler{
+		Type:           "jaeger_remote",
+		ServiceName:    "foo",
+		Endpoint:       "http://localhost",
+		InitialSampler: &mkot.Sampler{Type: "rate_limiting"},
+	}).TracerOpts(ctx)
+	x.Contains(err.Error(), "jaeger_remote: initial_sampler: rate_limiting: traces_per_second must be positive")
+
+	p := filepath.Join(t.TempDir(), "strategies.json")
+	x.NoError(os.WriteFile(p, []byte(`{"service_strategies":[{"service":"bar","type":"probabilistic","param":1}]}`), 0o644))
+	_, err = (&mkot.Sampler{Type: "jaeger_remote", ServiceName: "foo", File: p}).TracerOpts(ctx)
+	x.Contains(err.Error(), `jaeger_remote: file: no strategy for service "foo"`)
+}
@@ -0,0 +1,88 @@
+package mkot
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/goccy/go-yaml"
+)
+
+// LoadConfig reads the YAML documents at the given paths and merges them into
+// a new [Config] as [Config.MergeYAML] does, like the collector's repeated
+// `--config` flags.
+func LoadConfig(paths ...string) (*Config, error) {
+	docs := make([][]byte, 0, len(paths))
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("read %q: %w", p, err)
+		}
+		docs = append(docs, data)
+	}
+
+	c := NewConfig()
+	if err := c.MergeYAML(docs...); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// MergeYAML merges the given YAML documents in order and decodes the result
+// into c using its registries. A later document overrides an earlier one:
+// mappings are merged deeply, while lists and scalars are replaced as a whole,
+// and a null value leaves the earlier value as is. A processor, exporter, or
+// provider set to `false` is removed, so a later document can disable a
+// component an earlier one defines.
+//
+// Merging happens before any component decodes its config, so the config of a
+// single component can be spread across documents.
+func (c *Config) MergeYAML(docs ...[]byte) error {
+	var merged any
+	for i, doc := range docs {
+		var v any
+		if err := yaml.Unmarshal(doc, &v); err != nil {
+			return fmt.Errorf("document[%d]: %w", i, err)
+		}
+		merged = mergeValue(merged, v)
+	}
+
+	if m, ok := merged.(map[string]any); ok {
+		for _, k := range []string{"processors", "exporters", "providers"} {
+			section, ok := m[k].(map[string]any)
+			if !ok {
+				continue
+			}
+			for id, v := range section {
+				if v == false {
+					delete(section, id)
+				}
+			}
+		}
+	}
+
+	raw, err := yaml.Marshal(merged)
+	if err != nil {
+		return fmt.Errorf("marshal merged: %w", err)
+	}
+	return yaml.Unmarshal(raw, c)
+}
+
+func mergeValue(dst any, src any) any {
+	if src == nil {
+		return dst
+	}
+
+	dst_, ok := dst.(map[string]any)
+	if !ok {
+		return src
+	}
+	src_, ok := src.(map[string]any)
+	if !ok {
+		return src
+	}
+
+	for k, v := range src_ {
+		dst_[k] = mergeValue(dst_[k], v)
+	}
+	return dst_
+}
@@ -0,0 +1,100 @@
+package mkot_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lesomnus/mkot"
+	"github.com/lesomnus/mkot/internal/x"
+)
+
+func TestLoadConfig(t *testing.T) {
+	_, x := x.New(t)
+
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	x.NoError(os.WriteFile(base, []byte(`
+processors:
+  sampler:
+    type: trace_id_ratio
+    ratio: 0.5
+  resource:
+    detectors: [os]
+providers:
+  tracer:
+    processors: [sampler, resource]
+  meter:
+    processors: [resource]
+`), 0644))
+
+	override := filepath.Join(dir, "override.yaml")
+	x.NoError(os.WriteFile(override, []byte(`
+processors:
+  sampler:
+    ratio: 0.1
+  resource: false
+providers:
+  tracer:
+    processors: [sampler]
+  meter: false
+`), 0644))
+
+	c, err := mkot.LoadConfig(base, override)
+	x.NoError(err)
+
+	sampler := mkot.Sampler{}
+	x.TypeAs(c.Processors["sampler"], &sampler)
+	x.Eq("trace_id_ratio", sampler.Type)
+	x.Eq(0.1, sampler.Ratio)
+
+	_, ok := c.Processors["resource"]
+	x.Eq(false, ok)
+	_, ok = c.Providers["meter"]
+	x.Eq(false, ok)
+	x.Eq([]mkot.Id{"sampler"}, c.Providers["tracer"].Processors)
+}
+
+func TestConfigMergeYAML(t *testing.T) {
+	_, x := x.New(t)
+
+	t.Setenv("MKOT_TEST_ENABLED", "false")
+
+	c := mkot.NewConfig()
+	c.ExporterRegistry = mkot.ExporterRegistry{
+		"test": func() mkot.ExporterConfig { return &headersExporterConfig{} },
+	}
+	err := c.MergeYAML(
+		[]byte(`
+exporters:
+  test:
+    endpoint: collector:4317
+    headers:
+      - { name: a, value: "1" }
+`),
+		[]byte(`
+exporters:
+  test:
+    enabled: ${env:MKOT_TEST_ENABLED}
+    headers:
+      - { name: b, value: "${env:MKOT_TEST_ENABLED}" }
+`),
+		[]byte(`
+exporters:
+  test:
+`),
+	)
+	x.NoError(err)
+
+	exporter := headersExporterConfig{}
+	x.TypeAs(c.Exporters["test"], &exporter)
+	x.Eq("collector:4317", exporter.Endpoint)
+	x.NotNil(exporter.Enabled)
+	x.Eq(false, *exporter.Enabled)
+
+	// Lists are replaced, not appended.
+	x.Eq(1, len(exporter.Headers))
+	v, ok := exporter.Headers.Get("b")
+	x.Eq(true, ok)
+	x.Eq("false", string(v))
+}
@@ -7,6 +7,9 @@ import (
 	"go.opentelemetry.io/otel/log/embedded"
 )
 
+// multiLoggerProvider fans out to several logger providers, each with its own
+// pipeline. A record is emitted only to the loggers enabled for it, and a
+// logger is enabled if any of them is.
 type multiLoggerProvider struct {
 	embedded.LoggerProvider
 	providers []log.LoggerProvider
@@ -26,8 +29,14 @@ type multiLogger struct {
 }
 
 func (l multiLogger) Emit(ctx context.Context, record log.Record) {
+	param := log.EnabledParameters{
+		Severity:  record.Severity(),
+		EventName: record.EventName(),
+	}
 	for _, l := range l.loggers {
-		l.Emit(ctx, record)
+		if l.Enabled(ctx, param) {
+			l.Emit(ctx, record)
+		}
 	}
 }
 
@@ -0,0 +1,74 @@
+package mkot_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lesomnus/mkot"
+	"github.com/lesomnus/mkot/internal/x"
+	olog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/log"
+)
+
+// severityProcessor records the records at or above its minimum severity.
+type severityProcessor struct {
+	min     olog.Severity
+	records atomic.Int32
+}
+
+func (p *severityProcessor) Enabled(ctx context.Context, param log.EnabledParameters) bool {
+	return param.Severity >= p.min
+}
+
+func (p *severityProcessor) OnEmit(ctx context.Context, record *log.Record) error {
+	p.records.Add(1)
+	return nil
+}
+
+func (p *severityProcessor) Shutdown(context.Context) error   { return nil }
+func (p *severityProcessor) ForceFlush(context.Context) error { return nil }
+
+type severityExporterConfig struct {
+	mkot.UnimplementedExporterConfig `yaml:"-"`
+
+	processor *severityProcessor
+}
+
+func (c *severityExporterConfig) LogExporter(ctx context.Context) (log.Exporter, []log.LoggerProviderOption, error) {
+	return nopLogExporter{}, []log.LoggerProviderOption{log.WithProcessor(c.processor)}, nil
+}
+
+func TestResolverIncludeLogger(t *testing.T) {
+	ctx, x := x.New(t)
+
+	all := &severityExporterConfig{processor: &severityProcessor{}}
+	siem := &severityExporterConfig{processor: &severityProcessor{min: olog.SeverityWarn}}
+	c := mkot.NewConfig()
+	c.Exporters["all"] = all
+	c.Exporters["siem"] = siem
+	c.Providers["logger/default"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"all"}}
+	c.Providers["logger/siem"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"siem"}}
+	c.Providers["logger/audit"] = &mkot.ProviderConfig{Include: []mkot.Id{"logger/default", "logger/siem"}}
+	x.NoError(c.Validate(ctx))
+
+	r := mkot.Make(ctx, c)
+	lp, err := r.Logger(ctx, "audit")
+	x.NoError(err)
+
+	l := lp.Logger("l")
+	x.Eq(true, l.Enabled(ctx, olog.EnabledParameters{Severity: olog.SeverityInfo}))
+
+	info := olog.Record{}
+	info.SetSeverity(olog.SeverityInfo)
+	l.Emit(ctx, info)
+
+	warn := olog.Record{}
+	warn.SetSeverity(olog.SeverityWarn)
+	l.Emit(ctx, warn)
+
+	// Each pipeline only gets the records it is enabled for.
+	x.Eq(int32(2), all.processor.records.Load())
+	x.Eq(int32(1), siem.processor.records.Load())
+	x.NoError(r.Shutdown(ctx))
+}
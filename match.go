@@ -0,0 +1,381 @@
+package mkot
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	olog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// MatchConfig selects the spans or log records a processor applies to, like
+// the include and exclude properties of the collector processors. An item
+// matches if it matches every property given, and it matches a property if
+// it matches any of its entries.
+type MatchConfig struct {
+	// MatchType is how names and attribute values are compared: "strict"
+	// (default) or "regexp".
+	MatchType string `yaml:"match_type,omitempty"`
+
+	// SpanNames matches the name of a span. It does not apply to logs.
+	SpanNames []string `yaml:"span_names,omitempty"`
+
+	// Libraries matches the instrumentation scope.
+	Libraries []LibraryMatch `yaml:"libraries,omitempty"`
+
+	// Attributes matches if every attribute listed is present, with the
+	// value given, if any.
+	Attributes []AttributeMatch `yaml:"attributes,omitempty"`
+
+	// SpanKinds matches the kind of a span: "internal", "server", "client",
+	// "producer", or "consumer". It does not apply to logs.
+	SpanKinds []string `yaml:"span_kinds,omitempty"`
+
+	// SpanStatuses matches the status code of a span: "unset", "ok", or
+	// "error". It does not apply to logs.
+	SpanStatuses []string `yaml:"span_statuses,omitempty"`
+
+	// SeverityNumber matches log records of the given severity or above. It
+	// does not apply to spans.
+	SeverityNumber *SeverityMatch `yaml:"severity_number,omitempty"`
+
+	// SeverityTexts matches the severity text of a log record. It does not
+	// apply to spans.
+	SeverityTexts []string `yaml:"severity_texts,omitempty"`
+
+	// LogBodies matches the body of a log record, formatted as a string. It
+	// does not apply to spans.
+	LogBodies []string `yaml:"log_bodies,omitempty"`
+}
+
+type LibraryMatch struct {
+	Name    string  `yaml:"name"`
+	Version *string `yaml:"version,omitempty"`
+}
+
+type AttributeMatch struct {
+	Key   string `yaml:"key"`
+	Value any    `yaml:"value,omitempty"`
+}
+
+type SeverityMatch struct {
+	// Min is the name of a severity, such as "INFO" or "WARN2", or its number.
+	Min string `yaml:"min"`
+
+	// MatchUndefined matches the records with no severity as well.
+	MatchUndefined bool `yaml:"match_undefined,omitempty"`
+}
+
+func (c *SeverityMatch) severity() (olog.Severity, error) {
+	if n, err := strconv.Atoi(c.Min); err == nil {
+		if n < int(olog.SeverityTrace1) || n > int(olog.SeverityFatal4) {
+			return 0, fmt.Errorf("severity %d out of range", n)
+		}
+		return olog.Severity(n), nil
+	}
+	for v := olog.SeverityTrace1; v <= olog.SeverityFatal4; v++ {
+		if strings.EqualFold(v.String(), c.Min) {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity %q", c.Min)
+}
+
+// matchItem is what a [matcher] looks at. attr returns the value of an
+// attribute formatted as a string.
+type matchItem struct {
+	span  bool
+	name  string
+	scope instrumentation.Scope
+	attr  func(key string) (string, bool)
+
+	kind   string
+	status string
+
+	severity     olog.Severity
+	severityText string
+	body         func() string
+}
+
+func spanItem(s trace.ReadOnlySpan) matchItem {
+	return matchItem{
+		span:   true,
+		name:   s.Name(),
+		scope:  s.InstrumentationScope(),
+		kind:   s.SpanKind().String(),
+		status: strings.ToLower(s.Status().Code.String()),
+		attr: func(key string) (string, bool) {
+			for _, kv := range s.Attributes() {
+				if string(kv.Key) == key {
+					return kv.Value.Emit(), true
+				}
+			}
+			return "", false
+		},
+	}
+}
+
+func recordItem(r *log.Record) matchItem {
+	return matchItem{
+		scope:        r.InstrumentationScope(),
+		severity:     r.Severity(),
+		severityText: r.SeverityText(),
+		body:         func() string { return r.Body().String() },
+		attr: func(key string) (string, bool) {
+			v, ok := "", false
+			r.WalkAttributes(func(kv olog.KeyValue) bool {
+				if kv.Key != key {
+					return true
+				}
+				v, ok = kv.Value.String(), true
+				return false
+			})
+			return v, ok
+		},
+	}
+}
+
+type matcher struct {
+	names      []func(string) bool
+	libraries  []libraryMatcher
+	attributes []attributeMatcher
+
+	kinds    []string
+	statuses []string
+
+	severity      *olog.Severity
+	undefined     bool
+	severityTexts []func(string) bool
+	bodies        []func(string) bool
+}
+
+type libraryMatcher struct {
+	name    func(string) bool
+	version func(string) bool
+}
+
+type attributeMatcher struct {
+	key   string
+	value func(string) bool
+}
+
+// compile returns the matcher of c. A nil config matches nothing.
+func (c *MatchConfig) compile(signal string) (*matcher, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if len(c.SpanNames) == 0 && len(c.Libraries) == 0 && len(c.Attributes) == 0 &&
+		len(c.SpanKinds) == 0 && len(c.SpanStatuses) == 0 &&
+		c.SeverityNumber == nil && len(c.SeverityTexts) == 0 && len(c.LogBodies) == 0 {
+		return nil, errors.New("no properties to match")
+	}
+	if signal == "logs" {
+		for _, v := range []struct {
+			name string
+			set  bool
+		}{
+			{"span_names", len(c.SpanNames) > 0},
+			{"span_kinds", len(c.SpanKinds) > 0},
+			{"span_statuses", len(c.SpanStatuses) > 0},
+		} {
+			if v.set {
+				return nil, fmt.Errorf("%s does not apply to logs", v.name)
+			}
+		}
+	}
+	if signal == "traces" {
+		for _, v := range []struct {
+			name string
+			set  bool
+		}{
+			{"severity_number", c.SeverityNumber != nil},
+			{"severity_texts", len(c.SeverityTexts) > 0},
+			{"log_bodies", len(c.LogBodies) > 0},
+		} {
+			if v.set {
+				return nil, fmt.Errorf("%s does not apply to traces", v.name)
+			}
+		}
+	}
+
+	var match func(string) (func(string) bool, error)
+	switch c.MatchType {
+	case "", "strict":
+		match = func(v string) (func(string) bool, error) {
+			return func(s string) bool { return s == v }, nil
+		}
+	case "regexp":
+		match = func(v string) (func(string) bool, error) {
+			re, err := regexp.Compile(v)
+			if err != nil {
+				return nil, err
+			}
+			return re.MatchString, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown match_type %q (want strict or regexp)", c.MatchType)
+	}
+
+	m := &matcher{}
+	for i, v := range c.SpanNames {
+		f, err := match(v)
+		if err != nil {
+			return nil, fmt.Errorf("span_names[%d]: %w", i, err)
+		}
+		m.names = append(m.names, f)
+	}
+	for i, v := range c.Libraries {
+		l := libraryMatcher{}
+		var err error
+		if l.name, err = match(v.Name); err != nil {
+			return nil, fmt.Errorf("libraries[%d]: %w", i, err)
+		}
+		if v.Version != nil {
+			if l.version, err = match(*v.Version); err != nil {
+				return nil, fmt.Errorf("libraries[%d]: %w", i, err)
+			}
+		}
+		m.libraries = append(m.libraries, l)
+	}
+	for i, v := range c.Attributes {
+		if v.Key == "" {
+			return nil, fmt.Errorf("attributes[%d]: key is required", i)
+		}
+		a := attributeMatcher{key: v.Key}
+		if v.Value != nil {
+			f, err := match(fmt.Sprint(v.Value))
+			if err != nil {
+				return nil, fmt.Errorf("attributes[%d]: %w", i, err)
+			}
+			a.value = f
+		}
+		m.attributes = append(m.attributes, a)
+	}
+	for i, v := range c.SpanKinds {
+		v = strings.ToLower(v)
+		if !slices.Contains([]string{"internal", "server", "client", "producer", "consumer"}, v) {
+			return nil, fmt.Errorf("span_kinds[%d]: unknown span kind %q", i, v)
+		}
+		m.kinds = append(m.kinds, v)
+	}
+	for i, v := range c.SpanStatuses {
+		v = strings.ToLower(v)
+		if !slices.Contains([]string{"unset", "ok", "error"}, v) {
+			return nil, fmt.Errorf("span_statuses[%d]: unknown status %q", i, v)
+		}
+		m.statuses = append(m.statuses, v)
+	}
+	if c.SeverityNumber != nil {
+		v, err := c.SeverityNumber.severity()
+		if err != nil {
+			return nil, fmt.Errorf("severity_number: %w", err)
+		}
+		m.severity = &v
+		m.undefined = c.SeverityNumber.MatchUndefined
+	}
+	for i, v := range c.SeverityTexts {
+		f, err := match(v)
+		if err != nil {
+			return nil, fmt.Errorf("severity_texts[%d]: %w", i, err)
+		}
+		m.severityTexts = append(m.severityTexts, f)
+	}
+	for i, v := range c.LogBodies {
+		f, err := match(v)
+		if err != nil {
+			return nil, fmt.Errorf("log_bodies[%d]: %w", i, err)
+		}
+		m.bodies = append(m.bodies, f)
+	}
+	return m, nil
+}
+
+func (m *matcher) match(v matchItem) bool {
+	if len(m.names) > 0 && !(v.span && matchAny(m.names, v.name)) {
+		return false
+	}
+	if len(m.libraries) > 0 && !m.matchLibrary(v.scope) {
+		return false
+	}
+	for _, a := range m.attributes {
+		s, ok := v.attr(a.key)
+		if !ok || (a.value != nil && !a.value(s)) {
+			return false
+		}
+	}
+	if len(m.kinds) > 0 && !slices.Contains(m.kinds, v.kind) {
+		return false
+	}
+	if len(m.statuses) > 0 && !slices.Contains(m.statuses, v.status) {
+		return false
+	}
+	if m.severity != nil {
+		if v.severity == olog.SeverityUndefined {
+			if !m.undefined {
+				return false
+			}
+		} else if v.severity < *m.severity {
+			return false
+		}
+	}
+	if len(m.severityTexts) > 0 && !matchAny(m.severityTexts, v.severityText) {
+		return false
+	}
+	if len(m.bodies) > 0 && !matchAny(m.bodies, v.body()) {
+		return false
+	}
+	return true
+}
+
+func (m *matcher) matchLibrary(v instrumentation.Scope) bool {
+	for _, l := range m.libraries {
+		if l.name(v.Name) && (l.version == nil || l.version(v.Version)) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(fs []func(string) bool, s string) bool {
+	for _, f := range fs {
+		if f(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// selector is the include and exclude matchers of a processor.
+type selector struct {
+	include *matcher
+	exclude *matcher
+}
+
+func newSelector(include, exclude *MatchConfig, signal string) (selector, error) {
+	i, err := include.compile(signal)
+	if err != nil {
+		return selector{}, fmt.Errorf("include: %w", err)
+	}
+	e, err := exclude.compile(signal)
+	if err != nil {
+		return selector{}, fmt.Errorf("exclude: %w", err)
+	}
+	return selector{i, e}, nil
+}
+
+// selects reports if the item is included and not excluded.
+func (s selector) selects(v matchItem) bool {
+	if s.include != nil && !s.include.match(v) {
+		return false
+	}
+	if s.exclude != nil && s.exclude.match(v) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,374 @@
+package mkot
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/embedded"
+)
+
+// multiMeterProvider mirrors [multiLoggerProvider] for meters. Every
+// instrument is created in each provider and a measurement is recorded in all
+// of them.
+type multiMeterProvider struct {
+	embedded.MeterProvider
+	providers []metric.MeterProvider
+}
+
+func (m multiMeterProvider) Meter(name string, opts ...metric.MeterOption) metric.Meter {
+	meters := make([]metric.Meter, len(m.providers))
+	for i, p := range m.providers {
+		meters[i] = p.Meter(name, opts...)
+	}
+	return &multiMeter{meters: meters}
+}
+
+type multiMeter struct {
+	embedded.Meter
+	meters []metric.Meter
+}
+
+// newMulti builds an instrument in every meter. The SDK returns a usable
+// instrument along with an error, so every instrument is kept either way.
+func newMulti[T any](meters []metric.Meter, build func(metric.Meter) (T, error)) ([]T, error) {
+	vs := make([]T, len(meters))
+	errs := []error{}
+	for i, m := range meters {
+		v, err := build(m)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		vs[i] = v
+	}
+	return vs, errors.Join(errs...)
+}
+
+func (m *multiMeter) Int64Counter(name string, options ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	vs, err := newMulti(m.meters, func(m metric.Meter) (metric.Int64Counter, error) {
+		return m.Int64Counter(name, options...)
+	})
+	return multiInt64Counter{vs: vs}, err
+}
+
+func (m *multiMeter) Int64UpDownCounter(name string, options ...metric.Int64UpDownCounterOption) (metric.Int64UpDownCounter, error) {
+	vs, err := newMulti(m.meters, func(m metric.Meter) (metric.Int64UpDownCounter, error) {
+		return m.Int64UpDownCounter(name, options...)
+	})
+	return multiInt64UpDownCounter{vs: vs}, err
+}
+
+func (m *multiMeter) Int64Histogram(name string, options ...metric.Int64HistogramOption) (metric.Int64Histogram, error) {
+	vs, err := newMulti(m.meters, func(m metric.Meter) (metric.Int64Histogram, error) {
+		return m.Int64Histogram(name, options...)
+	})
+	return multiInt64Histogram{vs: vs}, err
+}
+
+func (m *multiMeter) Int64Gauge(name string, options ...metric.Int64GaugeOption) (metric.Int64Gauge, error) {
+	vs, err := newMulti(m.meters, func(m metric.Meter) (metric.Int64Gauge, error) {
+		return m.Int64Gauge(name, options...)
+	})
+	return multiInt64Gauge{vs: vs}, err
+}
+
+func (m *multiMeter) Int64ObservableCounter(name string, options ...metric.Int64ObservableCounterOption) (metric.Int64ObservableCounter, error) {
+	vs, err := newMulti(m.meters, func(m metric.Meter) (metric.Int64ObservableCounter, error) {
+		return m.Int64ObservableCounter(name, options...)
+	})
+	return &multiInt64ObservableCounter{multiObservable: multiObservable[metric.Int64ObservableCounter]{vs}}, err
+}
+
+func (m *multiMeter) Int64ObservableUpDownCounter(name string, options ...metric.Int64ObservableUpDownCounterOption) (metric.Int64ObservableUpDownCounter, error) {
+	vs, err := newMulti(m.meters, func(m metric.Meter) (metric.Int64ObservableUpDownCounter, error) {
+		return m.Int64ObservableUpDownCounter(name, options...)
+	})
+	return &multiInt64ObservableUpDownCounter{multiObservable: multiObservable[metric.Int64ObservableUpDownCounter]{vs}}, err
+}
+
+func (m *multiMeter) Int64ObservableGauge(name string, options ...metric.Int64ObservableGaugeOption) (metric.Int64ObservableGauge, error) {
+	vs, err := newMulti(m.meters, func(m metric.Meter) (metric.Int64ObservableGauge, error) {
+		return m.Int64ObservableGauge(name, options...)
+	})
+	return &multiInt64ObservableGauge{multiObservable: multiObservable[metric.Int64ObservableGauge]{vs}}, err
+}
+
+func (m *multiMeter) Float64Counter(name string, options ...metric.Float64CounterOption) (metric.Float64Counter, error) {
+	vs, err := newMulti(m.meters, func(m metric.Meter) (metric.Float64Counter, error) {
+		return m.Float64Counter(name, options...)
+	})
+	return multiFloat64Counter{vs: vs}, err
+}
+
+func (m *multiMeter) Float64UpDownCounter(name string, options ...metric.Float64UpDownCounterOption) (metric.Float64UpDownCounter, error) {
+	vs, err := newMulti(m.meters, func(m metric.Meter) (metric.Float64UpDownCounter, error) {
+		return m.Float64UpDownCounter(name, options...)
+	})
+	return multiFloat64UpDownCounter{vs: vs}, err
+}
+
+func (m *multiMeter) Float64Histogram(name string, options ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	vs, err := newMulti(m.meters, func(m metric.Meter) (metric.Float64Histogram, error) {
+		return m.Float64Histogram(name, options...)
+	})
+	return multiFloat64Histogram{vs: vs}, err
+}
+
+func (m *multiMeter) Float64Gauge(name string, options ...metric.Float64GaugeOption) (metric.Float64Gauge, error) {
+	vs, err := newMulti(m.meters, func(m metric.Meter) (metric.Float64Gauge, error) {
+		return m.Float64Gauge(name, options...)
+	})
+	return multiFloat64Gauge{vs: vs}, err
+}
+
+func (m *multiMeter) Float64ObservableCounter(name string, options ...metric.Float64ObservableCounterOption) (metric.Float64ObservableCounter, error) {
+	vs, err := newMulti(m.meters, func(m metric.Meter) (metric.Float64ObservableCounter, error) {
+		return m.Float64ObservableCounter(name, options...)
+	})
+	return &multiFloat64ObservableCounter{multiObservable: multiObservable[metric.Float64ObservableCounter]{vs}}, err
+}
+
+func (m *multiMeter) Float64ObservableUpDownCounter(name string, options ...metric.Float64ObservableUpDownCounterOption) (metric.Float64ObservableUpDownCounter, error) {
+	vs, err := newMulti(m.meters, func(m metric.Meter) (metric.Float64ObservableUpDownCounter, error) {
+		return m.Float64ObservableUpDownCounter(name, options...)
+	})
+	return &multiFloat64ObservableUpDownCounter{multiObservable: multiObservable[metric.Float64ObservableUpDownCounter]{vs}}, err
+}
+
+func (m *multiMeter) Float64ObservableGauge(name string, options ...metric.Float64ObservableGaugeOption) (metric.Float64ObservableGauge, error) {
+	vs, err := newMulti(m.meters, func(m metric.Meter) (metric.Float64ObservableGauge, error) {
+		return m.Float64ObservableGauge(name, options...)
+	})
+	return &multiFloat64ObservableGauge{multiObservable: multiObservable[metric.Float64ObservableGauge]{vs}}, err
+}
+
+// RegisterCallback registers f with every meter, each time observing the
+// instruments of that meter.
+func (m *multiMeter) RegisterCallback(f metric.Callback, instruments ...metric.Observable) (metric.Registration, error) {
+	vs := make([]metric.Registration, 0, len(m.meters))
+	for i, meter := range m.meters {
+		instruments_ := make([]metric.Observable, len(instruments))
+		for j, v := range instruments {
+			instruments_[j] = memberObservable(v, i)
+		}
+
+		v, err := meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+			return f(ctx, multiObserver{o: o, i: i})
+		}, instruments_...)
+		if err != nil {
+			// Nothing is registered unless everything is.
+			for _, v := range vs {
+				v.Unregister()
+			}
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+	return multiRegistration{vs: vs}, nil
+}
+
+type multiRegistration struct {
+	embedded.Registration
+	vs []metric.Registration
+}
+
+func (r multiRegistration) Unregister() error {
+	errs := []error{}
+	for _, v := range r.vs {
+		if err := v.Unregister(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// multiObserver passes the instruments of the i-th meter to its observer.
+type multiObserver struct {
+	embedded.Observer
+
+	o metric.Observer
+	i int
+}
+
+func (o multiObserver) ObserveFloat64(obsrv metric.Float64Observable, value float64, opts ...metric.ObserveOption) {
+	o.o.ObserveFloat64(memberObservable(obsrv, o.i).(metric.Float64Observable), value, opts...)
+}
+
+func (o multiObserver) ObserveInt64(obsrv metric.Int64Observable, value int64, opts ...metric.ObserveOption) {
+	o.o.ObserveInt64(memberObservable(obsrv, o.i).(metric.Int64Observable), value, opts...)
+}
+
+func memberObservable(v metric.Observable, i int) metric.Observable {
+	if m, ok := v.(interface{ member(i int) metric.Observable }); ok {
+		return m.member(i)
+	}
+	return v
+}
+
+type multiInt64Counter struct {
+	embedded.Int64Counter
+	vs []metric.Int64Counter
+}
+
+func (i multiInt64Counter) Add(ctx context.Context, incr int64, options ...metric.AddOption) {
+	for _, v := range i.vs {
+		v.Add(ctx, incr, options...)
+	}
+}
+
+func (i multiInt64Counter) Enabled(ctx context.Context) bool {
+	return anyEnabled(ctx, i.vs)
+}
+
+type multiInt64UpDownCounter struct {
+	embedded.Int64UpDownCounter
+	vs []metric.Int64UpDownCounter
+}
+
+func (i multiInt64UpDownCounter) Add(ctx context.Context, incr int64, options ...metric.AddOption) {
+	for _, v := range i.vs {
+		v.Add(ctx, incr, options...)
+	}
+}
+
+func (i multiInt64UpDownCounter) Enabled(ctx context.Context) bool {
+	return anyEnabled(ctx, i.vs)
+}
+
+type multiInt64Histogram struct {
+	embedded.Int64Histogram
+	vs []metric.Int64Histogram
+}
+
+func (i multiInt64Histogram) Record(ctx context.Context, incr int64, options ...metric.RecordOption) {
+	for _, v := range i.vs {
+		v.Record(ctx, incr, options...)
+	}
+}
+
+func (i multiInt64Histogram) Enabled(ctx context.Context) bool {
+	return anyEnabled(ctx, i.vs)
+}
+
+type multiInt64Gauge struct {
+	embedded.Int64Gauge
+	vs []metric.Int64Gauge
+}
+
+func (i multiInt64Gauge) Record(ctx context.Context, value int64, options ...metric.RecordOption) {
+	for _, v := range i.vs {
+		v.Record(ctx, value, options...)
+	}
+}
+
+func (i multiInt64Gauge) Enabled(ctx context.Context) bool {
+	return anyEnabled(ctx, i.vs)
+}
+
+type multiFloat64Counter struct {
+	embedded.Float64Counter
+	vs []metric.Float64Counter
+}
+
+func (i multiFloat64Counter) Add(ctx context.Context, incr float64, options ...metric.AddOption) {
+	for _, v := range i.vs {
+		v.Add(ctx, incr, options...)
+	}
+}
+
+func (i multiFloat64Counter) Enabled(ctx context.Context) bool {
+	return anyEnabled(ctx, i.vs)
+}
+
+type multiFloat64UpDownCounter struct {
+	embedded.Float64UpDownCounter
+	vs []metric.Float64UpDownCounter
+}
+
+func (i multiFloat64UpDownCounter) Add(ctx context.Context, incr float64, options ...metric.AddOption) {
+	for _, v := range i.vs {
+		v.Add(ctx, incr, options...)
+	}
+}
+
+func (i multiFloat64UpDownCounter) Enabled(ctx context.Context) bool {
+	return anyEnabled(ctx, i.vs)
+}
+
+type multiFloat64Histogram struct {
+	embedded.Float64Histogram
+	vs []metric.Float64Histogram
+}
+
+func (i multiFloat64Histogram) Record(ctx context.Context, incr float64, options ...metric.RecordOption) {
+	for _, v := range i.vs {
+		v.Record(ctx, incr, options...)
+	}
+}
+
+func (i multiFloat64Histogram) Enabled(ctx context.Context) bool {
+	return anyEnabled(ctx, i.vs)
+}
+
+type multiFloat64Gauge struct {
+	embedded.Float64Gauge
+	vs []metric.Float64Gauge
+}
+
+func (i multiFloat64Gauge) Record(ctx context.Context, value float64, options ...metric.RecordOption) {
+	for _, v := range i.vs {
+		v.Record(ctx, value, options...)
+	}
+}
+
+func (i multiFloat64Gauge) Enabled(ctx context.Context) bool {
+	return anyEnabled(ctx, i.vs)
+}
+
+func anyEnabled[T interface{ Enabled(context.Context) bool }](ctx context.Context, vs []T) bool {
+	for _, v := range vs {
+		if v.Enabled(ctx) {
+			return true
+		}
+	}
+	return false
+}
+
+// multiObservable holds an observable instrument of every meter. As with the
+// delegates, the observable types embed the interface to satisfy its
+// unexported marker methods.
+type multiObservable[T metric.Observable] struct {
+	vs []T
+}
+
+func (o multiObservable[T]) member(i int) metric.Observable { return o.vs[i] }
+
+type multiInt64ObservableCounter struct {
+	metric.Int64ObservableCounter
+	multiObservable[metric.Int64ObservableCounter]
+}
+
+type multiInt64ObservableUpDownCounter struct {
+	metric.Int64ObservableUpDownCounter
+	multiObservable[metric.Int64ObservableUpDownCounter]
+}
+
+type multiInt64ObservableGauge struct {
+	metric.Int64ObservableGauge
+	multiObservable[metric.Int64ObservableGauge]
+}
+
+type multiFloat64ObservableCounter struct {
+	metric.Float64ObservableCounter
+	multiObservable[metric.Float64ObservableCounter]
+}
+
+type multiFloat64ObservableUpDownCounter struct {
+	metric.Float64ObservableUpDownCounter
+	multiObservable[metric.Float64ObservableUpDownCounter]
+}
+
+type multiFloat64ObservableGauge struct {
+	metric.Float64ObservableGauge
+	multiObservable[metric.Float64ObservableGauge]
+}
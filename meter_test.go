@@ -0,0 +1,46 @@
+package mkot_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lesomnus/mkot"
+	"github.com/lesomnus/mkot/internal/x"
+	otelmetric "go.opentelemetry.io/otel/metric"
+)
+
+func TestResolverIncludeMeter(t *testing.T) {
+	ctx, x := x.New(t)
+
+	a := &manualReaderConfig{}
+	b := &manualReaderConfig{}
+	c := mkot.NewConfig()
+	c.Exporters["a"] = a
+	c.Exporters["b"] = b
+	c.Providers["meter/a"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"a"}}
+	c.Providers["meter/b"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"b"}}
+	c.Providers["meter"] = &mkot.ProviderConfig{Include: []mkot.Id{"meter/a", "meter/b"}}
+	x.NoError(c.Validate(ctx))
+
+	r := mkot.Make(ctx, c)
+	mp, err := r.Meter(ctx, "")
+	x.NoError(err)
+
+	m := mp.Meter("m")
+	counter, err := m.Int64Counter("counter")
+	x.NoError(err)
+	counter.Add(ctx, 3)
+	x.Eq(true, counter.Enabled(ctx))
+
+	observable, err := m.Int64ObservableCounter("observable")
+	x.NoError(err)
+	_, err = m.RegisterCallback(func(ctx context.Context, o otelmetric.Observer) error {
+		o.ObserveInt64(observable, 5)
+		return nil
+	}, observable)
+	x.NoError(err)
+
+	x.Eq(int64(8), a.sum(ctx, t))
+	x.Eq(int64(8), b.sum(ctx, t))
+	x.NoError(r.Shutdown(ctx))
+}
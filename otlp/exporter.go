@@ -189,6 +189,10 @@ func (e ExporterConfig) MetricExporter(ctx context.Context) (metric.Exporter, []
 	if err != nil {
 		return nil, nil, err
 	}
+	v, err = e.Queue.BuildMetricExporter(v)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	mopts, err := e.meterProviderOpts()
 	if err != nil {
@@ -205,6 +209,11 @@ func (e ExporterConfig) MetricReader(ctx context.Context) (metric.Reader, []metr
 	if err != nil {
 		return nil, nil, err
 	}
+	// Metrics bypass the sending queue; only its storage applies to them.
+	v, err = e.Queue.BuildMetricExporter(v)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	ropts := []metric.PeriodicReaderOption{}
 	if e.Interval > 0 {
@@ -221,7 +230,7 @@ func (e ExporterConfig) MetricReader(ctx context.Context) (metric.Reader, []metr
 		return nil, nil, err
 	}
 	r := metric.NewPeriodicReader(v, ropts...)
-	return r, append([]metric.Option{metric.WithReader(r)}, mopts...), nil
+	return mkot.MetricComponent(r, v), append([]metric.Option{metric.WithReader(r)}, mopts...), nil
 }
 
 func (e ExporterConfig) metricOpts() ([]otlpmetricgrpc.Option, error) {
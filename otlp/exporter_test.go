@@ -451,6 +451,69 @@ providers:
 	x.Eq(true, sink.seen("mkot.test.count"))
 }
 
+// With storage, a metric push the collector missed is kept on disk and
+// replayed by the next process using the same directory.
+func TestMetricPushStored(t *testing.T) {
+	ctx, x := x.New(t)
+	dir := t.TempDir()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	x.NoError(err)
+	sink := &metricSink{}
+	srv := grpc.NewServer()
+	collectormetricspb.RegisterMetricsServiceServer(srv, sink)
+
+	src := `
+exporters:
+  otlp:
+    endpoint: "` + lis.Addr().String() + `"
+    tls: { insecure: true }
+    timeout: 500ms
+    retry_on_failure: { enabled: false }
+    interval: 1h
+    sending_queue:
+      storage: { directory: "` + dir + `" }
+providers:
+  meter:
+    exporters: [otlp]
+`
+	resolve := func() mkot.Resolver {
+		var c mkot.Config
+		x.NoError(yaml.Unmarshal([]byte(src), &c))
+		return mkot.Make(ctx, &c)
+	}
+
+	// Nothing serves the endpoint yet, so the push fails.
+	r := resolve()
+	mp, err := r.Meter(ctx, "")
+	x.NoError(err)
+	x.NoError(r.Start(ctx))
+	ctr, err := mp.Meter("test").Int64Counter("mkot.test.stored")
+	x.NoError(err)
+	ctr.Add(ctx, 42)
+	if err := r.Shutdown(context.Background()); err == nil {
+		t.Fatal("push to an endpoint nothing serves must fail")
+	}
+	x.Eq(false, sink.seen("mkot.test.stored"))
+
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	r = resolve()
+	_, err = r.Meter(ctx, "")
+	x.NoError(err)
+	x.NoError(r.Start(ctx))
+	defer r.Shutdown(context.Background())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !sink.seen("mkot.test.stored") {
+		if time.Now().After(deadline) {
+			t.Fatal("stored metrics were not replayed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 // traceSink records span names pushed over OTLP/gRPC.
 type traceSink struct {
 	collectortracepb.UnimplementedTraceServiceServer
@@ -0,0 +1,248 @@
+package mkot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+func (c *Config) tracerOpts(ctx context.Context, id Id) ([]trace.TracerProviderOption, error) {
+	v, ok := c.Processors[id]
+	if !ok {
+		return nil, fmt.Errorf("not found")
+	}
+
+	v_, ok := v.(TracerProviderConfig)
+	if !ok {
+		return nil, fmt.Errorf("not for the tracer")
+	}
+
+	opts, err := v_.TracerOpts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		return nil, fmt.Errorf("not for the tracer")
+	}
+	return opts, nil
+}
+
+func (c *Config) meterOpts(ctx context.Context, id Id) ([]metric.Option, error) {
+	v, ok := c.Processors[id]
+	if !ok {
+		return nil, fmt.Errorf("not found")
+	}
+
+	v_, ok := v.(MeterProviderConfig)
+	if !ok {
+		return nil, fmt.Errorf("not for the meter")
+	}
+
+	opts, err := v_.MeterOpts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		return nil, fmt.Errorf("not for the meter")
+	}
+	return opts, nil
+}
+
+func (c *Config) loggerOpts(ctx context.Context, id Id) ([]log.LoggerProviderOption, error) {
+	v, ok := c.Processors[id]
+	if !ok {
+		return nil, fmt.Errorf("not found")
+	}
+
+	v_, ok := v.(LoggerProviderConfig)
+	if !ok {
+		return nil, fmt.Errorf("not for the logger")
+	}
+
+	opts, err := v_.LoggerOpts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		return nil, fmt.Errorf("not for the logger")
+	}
+	return opts, nil
+}
+
+func (c *Config) spanExporter(ctx context.Context, id Id) (any, []trace.TracerProviderOption, error) {
+	v, ok := c.Exporters[id]
+	if !ok {
+		return nil, nil, fmt.Errorf("not found")
+	}
+
+	v_, ok := v.(SpanExporterConfig)
+	if !ok {
+		return nil, nil, fmt.Errorf("not a span exporter")
+	}
+
+	return v_.SpanExporter(ctx)
+}
+
+func (c *Config) metricExporter(ctx context.Context, id Id) (any, []metric.Option, error) {
+	v, ok := c.Exporters[id]
+	if !ok {
+		return nil, nil, fmt.Errorf("not found")
+	}
+
+	// Prefer the reader: it is the lifecycle component. Its Shutdown
+	// drives the final Collect+Export and it honors the configured push
+	// interval. The bare-exporter path cannot flush on Shutdown because
+	// the resolver tracks the returned value as the shutdown component,
+	// and shutting down an exporter does not collect from its reader.
+	if r, opts, err := v.MetricReader(ctx); err == nil {
+		return r, opts, nil
+	} else if !errors.Is(err, ErrUnimplemented) {
+		return nil, nil, err
+	}
+
+	if e, opts, err := v.MetricExporter(ctx); err == nil {
+		return e, opts, nil
+	} else if !errors.Is(err, ErrUnimplemented) {
+		return nil, nil, err
+	}
+
+	return nil, nil, ErrUnimplemented
+}
+
+func (c *Config) logExporter(ctx context.Context, id Id) (any, []log.LoggerProviderOption, error) {
+	v, ok := c.Exporters[id]
+	if !ok {
+		return nil, nil, fmt.Errorf("not found")
+	}
+
+	v_, ok := v.(LogExporterConfig)
+	if !ok {
+		return nil, nil, fmt.Errorf("not a log exporter")
+	}
+
+	return v_.LogExporter(ctx)
+}
+
+// spanProcessor returns the processor among the given ones that wires the
+// exporters of a tracer provider, or nil if there is none.
+func (c *Config) spanProcessor(ids []Id) (SpanProcessorConfig, error) {
+	var v SpanProcessorConfig
+	for _, id := range ids {
+		p, ok := c.Processors[id].(SpanProcessorConfig)
+		if !ok {
+			continue
+		}
+		if v != nil {
+			return nil, fmt.Errorf("processor %q: only one processor can wire the exporters", id.String())
+		}
+		v = p
+	}
+	return v, nil
+}
+
+// spanWrappers returns the processors among the given ones that wrap the span
+// processor of each exporter, in order.
+func (c *Config) spanWrappers(ids []Id) []SpanProcessorWrapperConfig {
+	vs := []SpanProcessorWrapperConfig{}
+	for _, id := range ids {
+		if p, ok := c.Processors[id].(SpanProcessorWrapperConfig); ok {
+			vs = append(vs, p)
+		}
+	}
+	return vs
+}
+
+// logProcessor mirrors [Config.spanProcessor] for a logger provider.
+func (c *Config) logProcessor(ids []Id) (LogProcessorConfig, error) {
+	var v LogProcessorConfig
+	for _, id := range ids {
+		p, ok := c.Processors[id].(LogProcessorConfig)
+		if !ok {
+			continue
+		}
+		if v != nil {
+			return nil, fmt.Errorf("processor %q: only one processor can wire the exporters", id.String())
+		}
+		v = p
+	}
+	return v, nil
+}
+
+// logWrappers mirrors [Config.spanWrappers] for a logger provider.
+func (c *Config) logWrappers(ids []Id) []LogProcessorWrapperConfig {
+	vs := []LogProcessorWrapperConfig{}
+	for _, id := range ids {
+		if p, ok := c.Processors[id].(LogProcessorWrapperConfig); ok {
+			vs = append(vs, p)
+		}
+	}
+	return vs
+}
+
+// includes returns the ids of the providers the provider of the given id fans
+// out to, each resolved as [Config.Fallback] describes. It fails if one is not
+// defined or not of the same type, or if the provider includes itself.
+func (c *Config) includes(id Id) ([]Id, error) {
+	if err := c.checkIncludeCycle(id); err != nil {
+		return nil, err
+	}
+
+	p := c.Providers[id]
+	ids := make([]Id, len(p.Include))
+	for i, v := range p.Include {
+		if v.Type() != id.Type() {
+			return nil, fmt.Errorf("include %q: not a %s", v.String(), id.Type())
+		}
+		v_, _, ok := c.provider(v)
+		if !ok {
+			return nil, fmt.Errorf("include %q: %w", v.String(), ErrNotExist)
+		}
+		ids[i] = v_
+	}
+	return ids, nil
+}
+
+// checkIncludeCycle fails if the provider of the given id includes itself,
+// directly or through other providers.
+func (c *Config) checkIncludeCycle(id Id) error {
+	path := c.includeCycle([]Id{id})
+	if path == nil {
+		return nil
+	}
+
+	ids := make([]string, len(path))
+	for i, v := range path {
+		ids[i] = v.String()
+	}
+	return fmt.Errorf("include cycle: %s", strings.Join(ids, " -> "))
+}
+
+func (c *Config) includeCycle(path []Id) []Id {
+	p := c.Providers[path[len(path)-1]]
+	if p == nil {
+		return nil
+	}
+	for _, v := range p.Include {
+		v_, _, ok := c.provider(v)
+		if !ok {
+			continue
+		}
+		if v_ == path[0] {
+			return slices.Concat(path, []Id{v_})
+		}
+		if slices.Contains(path, v_) {
+			// A cycle the provider is not part of; its own providers report it.
+			continue
+		}
+		if cycle := c.includeCycle(slices.Concat(path, []Id{v_})); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
@@ -116,7 +116,10 @@ func (r *reader) Shutdown(ctx context.Context) error {
 
 	r.closed = true
 	r.cancel()
-	<-r.done
+	if r.started {
+		// Only a started reader has a server loop to wait for.
+		<-r.done
+	}
 	return nil
 }
 
@@ -0,0 +1,133 @@
+package mkot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel"
+	olog "go.opentelemetry.io/otel/log"
+	logglobal "go.opentelemetry.io/otel/log/global"
+	ometric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	otrace "go.opentelemetry.io/otel/trace"
+)
+
+// Propagators are the propagators `propagators` can list, by the names the
+// `OTEL_PROPAGATORS` environment variable uses.
+var Propagators = map[string]func() propagation.TextMapPropagator{
+	"tracecontext": func() propagation.TextMapPropagator { return propagation.TraceContext{} },
+	"baggage":      func() propagation.TextMapPropagator { return propagation.Baggage{} },
+	"b3":           func() propagation.TextMapPropagator { return b3.New() },
+	"b3multi": func() propagation.TextMapPropagator {
+		return b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader))
+	},
+	"jaeger": func() propagation.TextMapPropagator { return jaeger.Jaeger{} },
+}
+
+// Propagator returns the composite of the propagators the config lists, in
+// order. If it lists none, it is tracecontext and baggage, as in the SDK.
+func (c *Config) Propagator() (propagation.TextMapPropagator, error) {
+	names := c.Propagators
+	if len(names) == 0 {
+		names = []string{"tracecontext", "baggage"}
+	}
+
+	vs := []propagation.TextMapPropagator{}
+	errs := []error{}
+	for i, name := range names {
+		f, ok := Propagators[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("[%d]: unknown propagator %q", i, name))
+			continue
+		}
+		vs = append(vs, f())
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return propagation.NewCompositeTextMapPropagator(vs...), nil
+}
+
+// propagatorDelegate is a stable [propagation.TextMapPropagator] whose
+// underlying propagator can be swapped.
+type propagatorDelegate struct {
+	v swappable[propagation.TextMapPropagator]
+}
+
+func newPropagatorDelegate(v propagation.TextMapPropagator) *propagatorDelegate {
+	d := &propagatorDelegate{}
+	d.v.Store(v)
+	return d
+}
+
+func (d *propagatorDelegate) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	d.v.Load().Inject(ctx, carrier)
+}
+
+func (d *propagatorDelegate) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return d.v.Load().Extract(ctx, carrier)
+}
+
+func (d *propagatorDelegate) Fields() []string {
+	return d.v.Load().Fields()
+}
+
+// installGlobals registers the providers and the propagator as the
+// OpenTelemetry globals and returns a func that puts the previous ones back. A
+// nil provider leaves its global as is.
+func installGlobals(tp otrace.TracerProvider, mp ometric.MeterProvider, lp olog.LoggerProvider, p propagation.TextMapPropagator) func() {
+	restores := []func(){}
+	if tp != nil {
+		prev := otel.GetTracerProvider()
+		otel.SetTracerProvider(tp)
+		restores = append(restores, func() { otel.SetTracerProvider(prev) })
+	}
+	if mp != nil {
+		prev := otel.GetMeterProvider()
+		otel.SetMeterProvider(mp)
+		restores = append(restores, func() { otel.SetMeterProvider(prev) })
+	}
+	if lp != nil {
+		prev := logglobal.GetLoggerProvider()
+		logglobal.SetLoggerProvider(lp)
+		restores = append(restores, func() { logglobal.SetLoggerProvider(prev) })
+	}
+	if p != nil {
+		prev := otel.GetTextMapPropagator()
+		otel.SetTextMapPropagator(p)
+		restores = append(restores, func() { otel.SetTextMapPropagator(prev) })
+	}
+
+	return func() {
+		for _, f := range restores {
+			f()
+		}
+	}
+}
+
+// resolveDefaults resolves the default provider of each signal, leaving out
+// those the config does not define.
+func resolveDefaults(ctx context.Context, r Resolver) (otrace.TracerProvider, ometric.MeterProvider, olog.LoggerProvider, error) {
+	tp, err := r.Tracer(ctx, "")
+	if errors.Is(err, ErrNotExist) {
+		tp = nil
+	} else if err != nil {
+		return nil, nil, nil, fmt.Errorf("tracer: %w", err)
+	}
+	mp, err := r.Meter(ctx, "")
+	if errors.Is(err, ErrNotExist) {
+		mp = nil
+	} else if err != nil {
+		return nil, nil, nil, fmt.Errorf("meter: %w", err)
+	}
+	lp, err := r.Logger(ctx, "")
+	if errors.Is(err, ErrNotExist) {
+		lp = nil
+	} else if err != nil {
+		return nil, nil, nil, fmt.Errorf("logger: %w", err)
+	}
+	return tp, mp, lp, nil
+}
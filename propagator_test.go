@@ -0,0 +1,102 @@
+package mkot_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lesomnus/mkot"
+	"github.com/lesomnus/mkot/internal/x"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	otrace "go.opentelemetry.io/otel/trace"
+)
+
+// sorted sorts the fields of a propagator, whose order is not stable.
+func sorted(fields []string) []string {
+	return slices.Sorted(slices.Values(fields))
+}
+
+func TestConfigPropagator(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		_, x := x.New(t)
+
+		p, err := mkot.NewConfig().Propagator()
+		x.NoError(err)
+		x.Eq(sorted([]string{"traceparent", "tracestate", "baggage"}), sorted(p.Fields()))
+	})
+	t.Run("listed", func(t *testing.T) {
+		ctx, x := x.New(t)
+
+		c := mkot.NewConfig()
+		err := yaml.Unmarshal([]byte(`propagators: [b3multi, jaeger]`), c)
+		x.NoError(err)
+
+		p, err := c.Propagator()
+		x.NoError(err)
+
+		sc := otrace.NewSpanContext(otrace.SpanContextConfig{
+			TraceID:    otrace.TraceID{1},
+			SpanID:     otrace.SpanID{2},
+			TraceFlags: otrace.FlagsSampled,
+		})
+		carrier := propagation.MapCarrier{}
+		p.Inject(otrace.ContextWithSpanContext(ctx, sc), carrier)
+		x.Eq("01000000000000000000000000000000", carrier.Get("x-b3-traceid"))
+		x.Eq("01000000000000000000000000000000:0200000000000000:0:1", carrier.Get("uber-trace-id"))
+	})
+	t.Run("unknown", func(t *testing.T) {
+		_, x := x.New(t)
+
+		c := mkot.NewConfig()
+		c.Propagators = []string{"xray"}
+		_, err := c.Propagator()
+		x.Contains(err.Error(), `unknown propagator "xray"`)
+	})
+}
+
+func TestResolverInstallGlobals(t *testing.T) {
+	ctx, x := x.New(t)
+
+	prev_tp := otel.GetTracerProvider()
+	prev_p := otel.GetTextMapPropagator()
+
+	c := mkot.NewConfig()
+	c.Global = true
+	c.Propagators = []string{"b3"}
+	c.Exporters["counting"] = &countingExporterConfig{}
+	c.Providers["tracer"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"counting"}}
+	r := mkot.Make(ctx, c)
+	x.NoError(r.Start(ctx))
+
+	tp, err := r.Tracer(ctx, "")
+	x.NoError(err)
+	x.Eq(tp, otel.GetTracerProvider())
+	x.Eq(sorted([]string{"x-b3-traceid", "x-b3-spanid", "x-b3-sampled", "x-b3-flags"}), sorted(otel.GetTextMapPropagator().Fields()))
+
+	x.NoError(r.Shutdown(ctx))
+	x.Eq(prev_tp, otel.GetTracerProvider())
+	x.Eq(sorted(prev_p.Fields()), sorted(otel.GetTextMapPropagator().Fields()))
+}
+
+func TestReloaderInstallGlobals(t *testing.T) {
+	ctx, x := x.New(t)
+
+	prev_tp := otel.GetTracerProvider()
+
+	r := mkot.MakeReloader(ctx, mkot.NewConfig())
+	x.NoError(r.InstallGlobals(ctx))
+
+	// The delegate is installed even though no tracer is configured yet.
+	tp, _ := r.Tracer(ctx, "")
+	x.Eq(tp, otel.GetTracerProvider())
+	x.Eq(sorted([]string{"traceparent", "tracestate", "baggage"}), sorted(otel.GetTextMapPropagator().Fields()))
+
+	c := mkot.NewConfig()
+	c.Propagators = []string{"jaeger"}
+	x.NoError(r.Reload(ctx, c))
+	x.Eq(sorted([]string{"uber-trace-id"}), sorted(otel.GetTextMapPropagator().Fields()))
+
+	x.NoError(r.Shutdown(ctx))
+	x.Eq(prev_tp, otel.GetTracerProvider())
+}
@@ -2,11 +2,16 @@ package mkot_test
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/lesomnus/mkot"
 	"github.com/lesomnus/mkot/internal/x"
+	olog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/log"
 	"go.opentelemetry.io/otel/sdk/trace"
 )
 
@@ -56,29 +61,196 @@ func TestBuildSpanProcessorDisabledIsSynchronous(t *testing.T) {
 	x.Eq(1, rec.count()) // simple processor exports on End, no flush needed
 }
 
-// block_on_overflow maps to a blocking span processor; the knobs the SDK cannot
-// express are rejected rather than silently dropped.
-func TestBuildProcessorQueueKnobs(t *testing.T) {
+func TestBuildProcessorQueueInvalid(t *testing.T) {
 	_, x := x.New(t)
 	rec := &recordingSpanExporter{}
 
-	// block_on_overflow is expressible for spans (trace.WithBlocking).
-	_, err := mkot.QueueConfig{BlockOnOverflow: true}.BuildSpanProcessor(rec)
+	for _, tc := range []struct {
+		c   mkot.QueueConfig
+		err string
+	}{
+		{mkot.QueueConfig{Sizer: "requests"}, `sending_queue: unknown sizer "requests"`},
+		{mkot.QueueConfig{Batch: mkot.BatchConfig{Sizer: "requests"}}, `sending_queue: batch: unknown sizer "requests"`},
+		{mkot.QueueConfig{Sizer: "bytes"}, "sending_queue: queue_size is required with sizer bytes"},
+		{mkot.QueueConfig{Batch: mkot.BatchConfig{MinSize: 10, MaxSize: 5}}, "sending_queue: batch.min_size must not exceed batch.max_size"},
+	} {
+		_, err := tc.c.BuildSpanProcessor(rec)
+		x.Contains(err.Error(), tc.err)
+		_, err = tc.c.BuildLogProcessor(&batchesExporter{})
+		x.Contains(err.Error(), tc.err)
+	}
+}
+
+// batchesExporter sends the size of each batch it exports to batches, if
+// set, and blocks until release is closed, if set.
+type batchesExporter struct {
+	batches chan int
+	release chan struct{}
+	err     error
+}
+
+func (e *batchesExporter) Export(ctx context.Context, records []log.Record) error {
+	if e.batches != nil {
+		e.batches <- len(records)
+	}
+	if e.release != nil {
+		<-e.release
+	}
+	return e.err
+}
+
+func (e *batchesExporter) Shutdown(context.Context) error   { return nil }
+func (e *batchesExporter) ForceFlush(context.Context) error { return nil }
+
+func emit(ctx context.Context, p log.Processor, body string) error {
+	r := log.Record{}
+	r.SetBody(olog.StringValue(body))
+	return p.OnEmit(ctx, &r)
+}
+
+func TestQueueMinSize(t *testing.T) {
+	ctx, x := x.New(t)
+	e := &batchesExporter{batches: make(chan int, 8)}
+	p, err := mkot.QueueConfig{
+		Batch: mkot.BatchConfig{FlushTimeout: time.Hour, MinSize: 3, MaxSize: 4},
+	}.BuildLogProcessor(e)
 	x.NoError(err)
+	defer p.Shutdown(ctx)
 
-	// Inexpressible span knobs must error.
-	for _, c := range []mkot.QueueConfig{
-		{NumConsumers: 4},
-		{WaitForResult: true},
-		{Batch: mkot.BatchConfig{MinSize: 100}},
-	} {
-		if _, err := c.BuildSpanProcessor(rec); err == nil {
-			t.Fatalf("expected an error for %+v", c)
-		}
+	x.NoError(emit(ctx, p, "a"))
+	x.NoError(emit(ctx, p, "b"))
+	select {
+	case n := <-e.batches:
+		t.Fatalf("exported a batch of %d below the min size", n)
+	case <-time.After(50 * time.Millisecond):
 	}
 
-	// Logs cannot block on overflow, so that too must error.
-	if _, err := (mkot.QueueConfig{BlockOnOverflow: true}).BuildLogProcessor(nil); err == nil {
-		t.Fatal("block_on_overflow must error on the log path")
+	x.NoError(emit(ctx, p, "c"))
+	x.Eq(3, <-e.batches)
+}
+
+func TestQueueFlushTimeout(t *testing.T) {
+	ctx, x := x.New(t)
+	e := &batchesExporter{batches: make(chan int, 8)}
+	p, err := mkot.QueueConfig{
+		Batch: mkot.BatchConfig{FlushTimeout: 10 * time.Millisecond, MinSize: 100},
+	}.BuildLogProcessor(e)
+	x.NoError(err)
+	defer p.Shutdown(ctx)
+
+	x.NoError(emit(ctx, p, "a"))
+	x.Eq(1, <-e.batches)
+}
+
+func TestQueueWaitForResult(t *testing.T) {
+	ctx, x := x.New(t)
+	e := &batchesExporter{err: errors.New("unavailable")}
+	p, err := mkot.QueueConfig{
+		WaitForResult: true,
+		Batch:         mkot.BatchConfig{FlushTimeout: time.Millisecond},
+	}.BuildLogProcessor(e)
+	x.NoError(err)
+	defer p.Shutdown(ctx)
+
+	err = emit(ctx, p, "a")
+	x.ErrorIs(err, e.err)
+
+	rec := &recordingSpanExporter{}
+	sp, err := mkot.QueueConfig{
+		WaitForResult: true,
+		Batch:         mkot.BatchConfig{FlushTimeout: time.Millisecond},
+	}.BuildSpanProcessor(rec)
+	x.NoError(err)
+	defer sp.Shutdown(ctx)
+
+	tp := trace.NewTracerProvider(trace.WithSpanProcessor(sp))
+	_, span := tp.Tracer("t").Start(ctx, "s")
+	span.End()
+	x.Eq(1, rec.count()) // exported before End returns, no flush needed
+}
+
+func TestQueueNumConsumers(t *testing.T) {
+	ctx, x := x.New(t)
+	e := &batchesExporter{batches: make(chan int, 8), release: make(chan struct{})}
+	p, err := mkot.QueueConfig{
+		NumConsumers: 2,
+		Batch:        mkot.BatchConfig{MaxSize: 1},
+	}.BuildLogProcessor(e)
+	x.NoError(err)
+	defer p.Shutdown(ctx)
+
+	x.NoError(emit(ctx, p, "a"))
+	x.NoError(emit(ctx, p, "b"))
+
+	// Both batches are being exported at once.
+	x.Eq(1, <-e.batches)
+	x.Eq(1, <-e.batches)
+	close(e.release)
+}
+
+func TestQueueBlockOnOverflow(t *testing.T) {
+	ctx, x := x.New(t)
+
+	for _, block := range []bool{false, true} {
+		e := &batchesExporter{batches: make(chan int, 8), release: make(chan struct{})}
+		p, err := mkot.QueueConfig{
+			BlockOnOverflow: block,
+			QueueSize:       1,
+			Batch:           mkot.BatchConfig{MaxSize: 1},
+		}.BuildLogProcessor(e)
+		x.NoError(err)
+
+		// "a" is being exported and "b" fills the queue.
+		x.NoError(emit(ctx, p, "a"))
+		x.Eq(1, <-e.batches)
+		x.NoError(emit(ctx, p, "b"))
+
+		emitted := make(chan struct{})
+		go func() {
+			emit(ctx, p, "c")
+			close(emitted)
+		}()
+		select {
+		case <-emitted:
+			x.Eq(false, block)
+		case <-time.After(50 * time.Millisecond):
+			x.Eq(true, block)
+		}
+
+		close(e.release)
+		<-emitted
+		x.NoError(p.Shutdown(ctx))
+
+		// "c" is exported only if the producer waited for space.
+		close(e.batches)
+		n := 1
+		for v := range e.batches {
+			n += v
+		}
+		if block {
+			x.Eq(3, n)
+		} else {
+			x.Eq(2, n)
+		}
 	}
 }
+
+func TestQueueSizerBytes(t *testing.T) {
+	ctx, x := x.New(t)
+	e := &batchesExporter{batches: make(chan int, 8)}
+	p, err := mkot.QueueConfig{
+		Sizer:     "bytes",
+		QueueSize: 1 << 20,
+		Batch:     mkot.BatchConfig{FlushTimeout: time.Hour, MaxSize: 300},
+	}.BuildLogProcessor(e)
+	x.NoError(err)
+
+	// Each record is larger than half a batch.
+	body := strings.Repeat("x", 200)
+	x.NoError(emit(ctx, p, body))
+	x.NoError(emit(ctx, p, body))
+	x.NoError(p.ForceFlush(ctx))
+	x.Eq(1, <-e.batches)
+	x.Eq(1, <-e.batches)
+	x.NoError(p.Shutdown(ctx))
+}
@@ -0,0 +1,227 @@
+package mkot
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Redaction removes the attributes of spans and log records that are not
+// allowed and masks the parts of their string values that are blocked, like
+// the collector's redaction processor. It is wired as [Attributes] is.
+type Redaction struct {
+	UnimplementedProcessorConfig `yaml:"-"`
+
+	// AllowAllKeys keeps every attribute instead of only the allowed ones.
+	AllowAllKeys bool `yaml:"allow_all_keys,omitempty"`
+
+	// AllowedKeys are the attributes kept. The others are removed unless
+	// AllowAllKeys is set.
+	AllowedKeys []string `yaml:"allowed_keys,omitempty"`
+
+	// IgnoredKeys are the attributes left as they are.
+	IgnoredKeys []string `yaml:"ignored_keys,omitempty"`
+
+	// BlockedValues are patterns of the values to mask in the attributes
+	// kept, in strings and in each string of slices and maps.
+	BlockedValues []string `yaml:"blocked_values,omitempty"`
+
+	// Summary is what is added about the redaction: "debug" adds the keys
+	// removed or masked and their counts, "info" only the counts, and
+	// "silent" (default) nothing.
+	Summary string `yaml:"summary,omitempty"`
+}
+
+const redactionMask = "****"
+
+func (c *Redaction) TracerOpts(ctx context.Context) ([]trace.TracerProviderOption, error) {
+	// The attributes are redacted by WrapSpanProcessor.
+	if _, err := c.redactor(); err != nil {
+		return nil, err
+	}
+	return []trace.TracerProviderOption{}, nil
+}
+
+func (c *Redaction) LoggerOpts(ctx context.Context) ([]log.LoggerProviderOption, error) {
+	// The attributes are redacted by WrapLogProcessor.
+	if _, err := c.redactor(); err != nil {
+		return nil, err
+	}
+	return []log.LoggerProviderOption{}, nil
+}
+
+func (c *Redaction) WrapSpanProcessor(ctx context.Context, p trace.SpanProcessor) (trace.SpanProcessor, error) {
+	r, err := c.redactor()
+	if err != nil {
+		return nil, err
+	}
+	return redactionSpanProcessor{p, r}, nil
+}
+
+func (c *Redaction) WrapLogProcessor(ctx context.Context, p log.Processor) (log.Processor, error) {
+	r, err := c.redactor()
+	if err != nil {
+		return nil, err
+	}
+	return redactionLogProcessor{p, r}, nil
+}
+
+type redactor struct {
+	allow_all bool
+	allowed   map[string]bool
+	ignored   map[string]bool
+	blocked   []*regexp.Regexp
+	summary   string
+}
+
+func (c *Redaction) redactor() (*redactor, error) {
+	r := &redactor{
+		allow_all: c.AllowAllKeys,
+		allowed:   map[string]bool{},
+		ignored:   map[string]bool{},
+		summary:   c.Summary,
+	}
+	switch c.Summary {
+	case "":
+		r.summary = "silent"
+	case "debug", "info", "silent":
+	default:
+		return nil, fmt.Errorf("unknown summary %q (want debug, info, or silent)", c.Summary)
+	}
+	for _, k := range c.AllowedKeys {
+		r.allowed[k] = true
+	}
+	for _, k := range c.IgnoredKeys {
+		r.ignored[k] = true
+	}
+	for i, v := range c.BlockedValues {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, fmt.Errorf("blocked_values[%d]: %w", i, err)
+		}
+		r.blocked = append(r.blocked, re)
+	}
+	return r, nil
+}
+
+// redact returns the attributes kept, with their values masked, followed by the
+// summary. Every string of a value is masked, including those of slices and
+// maps.
+func redact[V any](r *redactor, k valueKind[V], kvs []keyValue[V]) []keyValue[V] {
+	vs := []keyValue[V]{}
+	redacted := []string{}
+	masked := []string{}
+	ignored := 0
+	for _, kv := range kvs {
+		if r.ignored[kv.key] {
+			ignored++
+			vs = append(vs, kv)
+			continue
+		}
+		if !r.allow_all && !r.allowed[kv.key] {
+			redacted = append(redacted, kv.key)
+			continue
+		}
+		if len(r.blocked) > 0 {
+			changed := false
+			v := k.strings(kv.value, func(s string) string {
+				v := s
+				for _, re := range r.blocked {
+					v = re.ReplaceAllLiteralString(v, redactionMask)
+				}
+				changed = changed || v != s
+				return v
+			})
+			if changed {
+				masked = append(masked, kv.key)
+				kv.value = v
+			}
+		}
+		vs = append(vs, kv)
+	}
+
+	if r.summary == "silent" {
+		return vs
+	}
+	summarize := func(name string, keys []string) {
+		if len(keys) == 0 {
+			return
+		}
+		if r.summary == "debug" {
+			slices.Sort(keys)
+			vs = append(vs, keyValue[V]{"redaction." + name + ".keys", k.of(strings.Join(keys, ","))})
+		}
+		vs = append(vs, keyValue[V]{"redaction." + name + ".count", k.int(int64(len(keys)))})
+	}
+	summarize("redacted", redacted)
+	summarize("masked", masked)
+	if ignored > 0 {
+		vs = append(vs, keyValue[V]{"redaction.ignored.count", k.int(int64(ignored))})
+	}
+	return vs
+}
+
+type redactionSpanProcessor struct {
+	next trace.SpanProcessor
+	r    *redactor
+}
+
+func (p redactionSpanProcessor) OnStart(parent context.Context, s trace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p redactionSpanProcessor) OnEnd(s trace.ReadOnlySpan) {
+	kvs := redact(p.r, spanValues, spanKeyValues(s))
+	p.next.OnEnd(editedSpan{s, spanAttrs(kvs)})
+}
+
+func (p redactionSpanProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p redactionSpanProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+func (p redactionSpanProcessor) Pending() int64 {
+	return pendingOf(p.next)
+}
+
+type redactionLogProcessor struct {
+	next log.Processor
+	r    *redactor
+}
+
+func (p redactionLogProcessor) Enabled(ctx context.Context, param log.EnabledParameters) bool {
+	return p.next.Enabled(ctx, param)
+}
+
+func (p redactionLogProcessor) OnEmit(ctx context.Context, r *log.Record) error {
+	// The record is shared with the processors of the other exporters.
+	r_ := r.Clone()
+	setRecordKeyValues(&r_, redact(p.r, logValues, recordKeyValues(&r_)))
+	return p.next.OnEmit(ctx, &r_)
+}
+
+func (p redactionLogProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p redactionLogProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+func (p redactionLogProcessor) Pending() int64 {
+	return pendingOf(p.next)
+}
+
+func init() {
+	DefaultProcessorRegistry.Set("redaction", func() ProcessorConfig {
+		return &Redaction{}
+	})
+}
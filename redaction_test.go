@@ -0,0 +1,151 @@
+package mkot_test
+
+import (
+	"testing"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lesomnus/mkot"
+	"github.com/lesomnus/mkot/internal/x"
+	"go.opentelemetry.io/otel/attribute"
+	olog "go.opentelemetry.io/otel/log"
+	otrace "go.opentelemetry.io/otel/trace"
+)
+
+func TestRedaction(t *testing.T) {
+	ctx, x := x.New(t)
+
+	e := &componentExporterConfig{}
+	c := mkot.NewConfig()
+	err := yaml.Unmarshal([]byte(`
+processors:
+  redaction:
+    allowed_keys: [description, card]
+    ignored_keys: [safe]
+    blocked_values:
+      - "4[0-9]{12}(?:[0-9]{3})?"
+      - "[a-z.]+@[a-z.]+"
+    summary: debug
+`), c)
+	x.NoError(err)
+	c.Exporters["e"] = e
+	c.Providers = map[mkot.Id]*mkot.ProviderConfig{
+		"tracer": {Processors: []mkot.Id{"redaction"}, Exporters: []mkot.Id{"e"}},
+		"logger": {Processors: []mkot.Id{"redaction"}, Exporters: []mkot.Id{"e"}},
+	}
+	x.NoError(c.Validate(ctx))
+
+	r := mkot.Make(ctx, c)
+	tp, err := r.Tracer(ctx, "")
+	x.NoError(err)
+	lp, err := r.Logger(ctx, "")
+	x.NoError(err)
+
+	_, span := tp.Tracer("t").Start(ctx, "s", otrace.WithAttributes(
+		attribute.String("description", "mail dwight@dunder.com"),
+		attribute.String("card", "4111111111111111"),
+		attribute.String("token", "eyJhbGciOi"),
+		attribute.String("safe", "jim@dunder.com"),
+	))
+	span.End()
+
+	rec := olog.Record{}
+	rec.AddAttributes(olog.String("card", "4111111111111111"), olog.String("password", "hunter2"))
+	lp.Logger("l").Emit(ctx, rec)
+
+	spans := e.spans.GetSpans()
+	x.Eq(1, len(spans))
+	x.Eq([]attribute.KeyValue{
+		attribute.String("description", "mail ****"),
+		attribute.String("card", "****"),
+		attribute.String("safe", "jim@dunder.com"),
+		attribute.String("redaction.redacted.keys", "token"),
+		attribute.Int64("redaction.redacted.count", 1),
+		attribute.String("redaction.masked.keys", "card,description"),
+		attribute.Int64("redaction.masked.count", 2),
+		attribute.Int64("redaction.ignored.count", 1),
+	}, spans[0].Attributes)
+
+	x.Eq(1, len(e.records.records))
+	attrs := map[string]string{}
+	e.records.records[0].WalkAttributes(func(kv olog.KeyValue) bool {
+		attrs[kv.Key] = kv.Value.String()
+		return true
+	})
+	x.Eq(map[string]string{
+		"card":                     "****",
+		"redaction.redacted.keys":  "password",
+		"redaction.redacted.count": "1",
+		"redaction.masked.keys":    "card",
+		"redaction.masked.count":   "1",
+	}, attrs)
+	x.NoError(r.Shutdown(ctx))
+}
+
+func TestRedactionInvalid(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := mkot.NewConfig()
+	c.Processors["redaction"] = &mkot.Redaction{BlockedValues: []string{"("}, Summary: "loud"}
+	c.Exporters["e"] = &componentExporterConfig{}
+	c.Providers["tracer"] = &mkot.ProviderConfig{Processors: []mkot.Id{"redaction"}, Exporters: []mkot.Id{"e"}}
+
+	err := c.Validate(ctx)
+	x.Contains(err.Error(), `processor "redaction": unknown summary "loud"`)
+}
+
+func TestRedactionSlices(t *testing.T) {
+	ctx, x := x.New(t)
+
+	e := &componentExporterConfig{}
+	c := mkot.NewConfig()
+	c.Processors["redaction"] = &mkot.Redaction{
+		AllowAllKeys:  true,
+		BlockedValues: []string{"[a-z.]+@[a-z.]+"},
+		Summary:       "info",
+	}
+	c.Exporters["e"] = e
+	c.Providers = map[mkot.Id]*mkot.ProviderConfig{
+		"tracer": {Processors: []mkot.Id{"redaction"}, Exporters: []mkot.Id{"e"}},
+		"logger": {Processors: []mkot.Id{"redaction"}, Exporters: []mkot.Id{"e"}},
+	}
+	x.NoError(c.Validate(ctx))
+
+	r := mkot.Make(ctx, c)
+	tp, err := r.Tracer(ctx, "")
+	x.NoError(err)
+	lp, err := r.Logger(ctx, "")
+	x.NoError(err)
+
+	_, span := tp.Tracer("t").Start(ctx, "s", otrace.WithAttributes(
+		attribute.StringSlice("to", []string{"jim@dunder.com", "everyone"}),
+		attribute.StringSlice("cc", []string{"nobody"}),
+	))
+	span.End()
+
+	rec := olog.Record{}
+	rec.AddAttributes(
+		olog.Slice("to", olog.StringValue("jim@dunder.com"), olog.StringValue("everyone")),
+		olog.Map("from", olog.String("name", "Pam"), olog.String("mail", "pam@dunder.com")),
+	)
+	lp.Logger("l").Emit(ctx, rec)
+
+	spans := e.spans.GetSpans()
+	x.Eq(1, len(spans))
+	x.Eq([]attribute.KeyValue{
+		attribute.StringSlice("to", []string{"****", "everyone"}),
+		attribute.StringSlice("cc", []string{"nobody"}),
+		attribute.Int64("redaction.masked.count", 1),
+	}, spans[0].Attributes)
+
+	x.Eq(1, len(e.records.records))
+	attrs := map[string]olog.Value{}
+	e.records.records[0].WalkAttributes(func(kv olog.KeyValue) bool {
+		attrs[kv.Key] = kv.Value
+		return true
+	})
+	x.Eq(3, len(attrs))
+	x.Eq(true, olog.SliceValue(olog.StringValue("****"), olog.StringValue("everyone")).Equal(attrs["to"]))
+	x.Eq(true, olog.MapValue(olog.String("name", "Pam"), olog.String("mail", "****")).Equal(attrs["from"]))
+	x.Eq(int64(2), attrs["redaction.masked.count"].AsInt64())
+	x.NoError(r.Shutdown(ctx))
+}
@@ -0,0 +1,371 @@
+package mkot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	olog "go.opentelemetry.io/otel/log"
+	nooplogger "go.opentelemetry.io/otel/log/noop"
+	ometric "go.opentelemetry.io/otel/metric"
+	noopmeter "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+	otrace "go.opentelemetry.io/otel/trace"
+	nooptracer "go.opentelemetry.io/otel/trace/noop"
+)
+
+// Reloader is a [Resolver] whose pipelines can be replaced while they are in
+// use. The providers it returns are stable delegates that follow every
+// [Reloader.Reload].
+type Reloader interface {
+	Resolver
+
+	// Reload validates c, builds the pipelines of every provider resolved so
+	// far from it, and starts them if the Reloader was started. Only then are
+	// the delegates switched to the new pipelines and the previous ones shut
+	// down, which drains them. On any error before the switch the previous
+	// pipelines stay in place.
+	//
+	// A provider the new config does not define becomes a noop until a later
+	// reload defines it again.
+	//
+	// Once globals are installed, the globals are the delegates, so they
+	// follow every reload as well, propagators included. Whether they are
+	// installed on [Resolver.Start] is up to the config the Reloader was
+	// made with.
+	Reload(ctx context.Context, c *Config) error
+}
+
+// MakeReloader returns a [Reloader] that initially resolves providers from c.
+func MakeReloader(ctx context.Context, c *Config) Reloader {
+	return &reloader{
+		config:  orDefault(c),
+		current: newResolver(c),
+		tracers: map[string]*reloadable[*tracerProviderDelegate, trace.TracerProviderOption]{},
+		meters:  map[string]*reloadable[*meterProviderDelegate, metric.Option]{},
+		loggers: map[string]*reloadable[*loggerProviderDelegate, log.LoggerProviderOption]{},
+	}
+}
+
+type reloader struct {
+	mu      sync.Mutex
+	config  *Config
+	current Resolver
+	started bool
+	closed  bool
+
+	propagator *propagatorDelegate
+	restore    func()
+
+	tracers map[string]*reloadable[*tracerProviderDelegate, trace.TracerProviderOption]
+	meters  map[string]*reloadable[*meterProviderDelegate, metric.Option]
+	loggers map[string]*reloadable[*loggerProviderDelegate, log.LoggerProviderOption]
+}
+
+// reloadable is a delegate along with the options it was first resolved with,
+// which are used again to resolve it from a reloaded config.
+type reloadable[D any, O any] struct {
+	d    D
+	opts []O
+}
+
+func (r *reloader) Tracer(ctx context.Context, name string, opts ...trace.TracerProviderOption) (otrace.TracerProvider, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if v, ok := r.tracers[name]; ok {
+		return v.d, nil
+	}
+
+	v, err := resolveTracer(ctx, r.current, name, opts)
+	if err != nil && !errors.Is(err, ErrNotExist) {
+		return nooptracer.NewTracerProvider(), err
+	}
+
+	d := newTracerProviderDelegate(v)
+	r.tracers[name] = &reloadable[*tracerProviderDelegate, trace.TracerProviderOption]{d, opts}
+	return d, err
+}
+
+func (r *reloader) Meter(ctx context.Context, name string, opts ...metric.Option) (ometric.MeterProvider, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if v, ok := r.meters[name]; ok {
+		return v.d, nil
+	}
+
+	v, err := resolveMeter(ctx, r.current, name, opts)
+	if err != nil && !errors.Is(err, ErrNotExist) {
+		return noopmeter.NewMeterProvider(), err
+	}
+
+	d := newMeterProviderDelegate(v)
+	r.meters[name] = &reloadable[*meterProviderDelegate, metric.Option]{d, opts}
+	return d, err
+}
+
+func (r *reloader) Logger(ctx context.Context, name string, opts ...log.LoggerProviderOption) (olog.LoggerProvider, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if v, ok := r.loggers[name]; ok {
+		return v.d, nil
+	}
+
+	v, err := resolveLogger(ctx, r.current, name, opts)
+	if err != nil && !errors.Is(err, ErrNotExist) {
+		return nooplogger.NewLoggerProvider(), err
+	}
+
+	d := newLoggerProviderDelegate(v)
+	r.loggers[name] = &reloadable[*loggerProviderDelegate, log.LoggerProviderOption]{d, opts}
+	return d, err
+}
+
+// resolveTracer resolves a provider to delegate to. A provider the config does
+// not define is still delegated, to a noop along with [ErrNotExist], so a
+// later reload can define it.
+func resolveTracer(ctx context.Context, r Resolver, name string, opts []trace.TracerProviderOption) (otrace.TracerProvider, error) {
+	v, err := r.Tracer(ctx, name, opts...)
+	if errors.Is(err, ErrNotExist) {
+		return nooptracer.NewTracerProvider(), err
+	}
+	return v, err
+}
+
+func resolveMeter(ctx context.Context, r Resolver, name string, opts []metric.Option) (ometric.MeterProvider, error) {
+	v, err := r.Meter(ctx, name, opts...)
+	if errors.Is(err, ErrNotExist) {
+		return noopmeter.NewMeterProvider(), err
+	}
+	return v, err
+}
+
+func resolveLogger(ctx context.Context, r Resolver, name string, opts []log.LoggerProviderOption) (olog.LoggerProvider, error) {
+	v, err := r.Logger(ctx, name, opts...)
+	if errors.Is(err, ErrNotExist) {
+		return nooplogger.NewLoggerProvider(), err
+	}
+	return v, err
+}
+
+func (r *reloader) Reload(ctx context.Context, c *Config) error {
+	if c != nil {
+		if err := c.Validate(ctx); err != nil {
+			return fmt.Errorf("validate: %w", err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return errors.New("reloader is shut down")
+	}
+
+	c = orDefault(c)
+	next := newResolver(c)
+	swaps, err := r.resolve(ctx, next)
+	if err != nil {
+		next.Shutdown(ctx)
+		return err
+	}
+	if r.propagator != nil {
+		p, err := c.Propagator()
+		if err != nil {
+			next.Shutdown(ctx)
+			return fmt.Errorf("propagators: %w", err)
+		}
+		swaps = append(swaps, func() { r.propagator.v.Store(p) })
+	}
+	if r.started {
+		if err := next.Start(ctx); err != nil {
+			next.Shutdown(ctx)
+			return fmt.Errorf("start: %w", err)
+		}
+	}
+
+	for _, swap := range swaps {
+		swap()
+	}
+
+	prev := r.current
+	r.config = c
+	r.current = next
+	if err := prev.Shutdown(ctx); err != nil {
+		return fmt.Errorf("shutdown previous: %w", err)
+	}
+	return nil
+}
+
+// resolve resolves every delegated provider from next and returns the swaps
+// that switch the delegates over to them.
+func (r *reloader) resolve(ctx context.Context, next Resolver) ([]func(), error) {
+	swaps := []func(){}
+	for name, v := range r.tracers {
+		p, err := resolveTracer(ctx, next, name, v.opts)
+		if err != nil && !errors.Is(err, ErrNotExist) {
+			return nil, fmt.Errorf("tracer %q: %w", name, err)
+		}
+		swaps = append(swaps, func() { v.d.swap(p) })
+	}
+	for name, v := range r.meters {
+		p, err := resolveMeter(ctx, next, name, v.opts)
+		if err != nil && !errors.Is(err, ErrNotExist) {
+			return nil, fmt.Errorf("meter %q: %w", name, err)
+		}
+		swaps = append(swaps, func() { v.d.swap(p) })
+	}
+	for name, v := range r.loggers {
+		p, err := resolveLogger(ctx, next, name, v.opts)
+		if err != nil && !errors.Is(err, ErrNotExist) {
+			return nil, fmt.Errorf("logger %q: %w", name, err)
+		}
+		swaps = append(swaps, func() { v.d.swap(p) })
+	}
+
+	return swaps, nil
+}
+
+func (r *reloader) Start(ctx context.Context) error {
+	r.mu.Lock()
+	err := r.current.Start(ctx)
+	if err == nil {
+		r.started = true
+	}
+	global := r.config.Global
+	r.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	if global {
+		if err := r.InstallGlobals(ctx); err != nil {
+			return fmt.Errorf("install globals: %w", err)
+		}
+	}
+	return nil
+}
+
+// InstallGlobals installs the delegates, so a provider the config does not
+// define is installed as well, as a noop until a reload defines it.
+func (r *reloader) InstallGlobals(ctx context.Context) error {
+	tp, err := r.Tracer(ctx, "")
+	if err != nil && !errors.Is(err, ErrNotExist) {
+		return fmt.Errorf("tracer: %w", err)
+	}
+	mp, err := r.Meter(ctx, "")
+	if err != nil && !errors.Is(err, ErrNotExist) {
+		return fmt.Errorf("meter: %w", err)
+	}
+	lp, err := r.Logger(ctx, "")
+	if err != nil && !errors.Is(err, ErrNotExist) {
+		return fmt.Errorf("logger: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrClosed
+	}
+	if r.restore != nil {
+		return nil
+	}
+
+	p, err := r.config.Propagator()
+	if err != nil {
+		return fmt.Errorf("propagators: %w", err)
+	}
+	r.propagator = newPropagatorDelegate(p)
+	r.restore = installGlobals(tp, mp, lp, r.propagator)
+	return nil
+}
+
+func (r *reloader) ForceFlush(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.current.ForceFlush(ctx)
+}
+
+func (r *reloader) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	if r.restore != nil {
+		r.restore()
+		r.restore = nil
+	}
+	return r.current.Shutdown(ctx)
+}
+
+// WatchConfig polls the files at paths every interval and reloads r with the
+// config [LoadConfig] builds from them whenever any of them changes and then
+// stays the same for an interval. It blocks until ctx is done. An error loading
+// or reloading the config is passed to onError, if it is not nil, and the
+// running pipelines are kept.
+func WatchConfig(ctx context.Context, r Reloader, interval time.Duration, onError func(error), paths ...string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	watchConfig(ctx, r, func() bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			return true
+		}
+	}, onError, paths...)
+}
+
+// watchConfig is [WatchConfig] polling each time wait returns true, until it
+// returns false.
+func watchConfig(ctx context.Context, r Reloader, wait func() bool, onError func(error), paths ...string) {
+	stat := func() string {
+		s := ""
+		for _, p := range paths {
+			info, err := os.Stat(p)
+			if err != nil {
+				s += fmt.Sprintf("%s:%v;", p, err)
+				continue
+			}
+			s += fmt.Sprintf("%s:%d:%d;", p, info.ModTime().UnixNano(), info.Size())
+		}
+		return s
+	}
+
+	last := stat()
+	changed := false
+	for wait() {
+		// A change is reloaded once the files are unchanged for a whole
+		// interval, so a file still being written is not loaded half done.
+		curr := stat()
+		if curr != last {
+			last = curr
+			changed = true
+			continue
+		}
+		if !changed {
+			continue
+		}
+		changed = false
+
+		err := func() error {
+			c, err := LoadConfig(paths...)
+			if err != nil {
+				return fmt.Errorf("load: %w", err)
+			}
+			return r.Reload(ctx, c)
+		}()
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package mkot_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lesomnus/mkot"
+	"github.com/lesomnus/mkot/internal/x"
+	otelmetric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+type manualReaderConfig struct {
+	mkot.UnimplementedExporterConfig `yaml:"-"`
+
+	reader *metric.ManualReader
+}
+
+func (c *manualReaderConfig) MetricReader(ctx context.Context) (metric.Reader, []metric.Option, error) {
+	c.reader = metric.NewManualReader()
+	return c.reader, []metric.Option{metric.WithReader(c.reader)}, nil
+}
+
+func (c *manualReaderConfig) sum(ctx context.Context, t *testing.T) int64 {
+	rm := metricdata.ResourceMetrics{}
+	if err := c.reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+
+	v := int64(0)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if s, ok := m.Data.(metricdata.Sum[int64]); ok {
+				for _, p := range s.DataPoints {
+					v += p.Value
+				}
+			}
+		}
+	}
+	return v
+}
+
+func TestReloader(t *testing.T) {
+	ctx, x := x.New(t)
+
+	newConfig := func(span *spanOnlyExporterConfig, reader *manualReaderConfig) *mkot.Config {
+		c := mkot.NewConfig()
+		c.Exporters["span"] = span
+		c.Exporters["reader"] = reader
+		c.Providers["tracer"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"span"}}
+		c.Providers["meter"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"reader"}}
+		return c
+	}
+
+	span_a, reader_a := &spanOnlyExporterConfig{}, &manualReaderConfig{}
+	r := mkot.MakeReloader(ctx, newConfig(span_a, reader_a))
+	defer r.Shutdown(ctx)
+
+	tp, err := r.Tracer(ctx, "")
+	x.NoError(err)
+	mp, err := r.Meter(ctx, "")
+	x.NoError(err)
+	x.NoError(r.Start(ctx))
+
+	tracer := tp.Tracer("t")
+	counter, err := mp.Meter("m").Int64Counter("c")
+	x.NoError(err)
+
+	_, span := tracer.Start(ctx, "a")
+	span.End()
+	counter.Add(ctx, 1)
+	x.Eq(1, span_a.exporter.count())
+	x.Eq(int64(1), reader_a.sum(ctx, t))
+
+	// An invalid config keeps the running pipelines.
+	invalid := newConfig(&spanOnlyExporterConfig{}, &manualReaderConfig{})
+	invalid.Providers["tracer"].Exporters = []mkot.Id{"span", "nope"}
+	if err := r.Reload(ctx, invalid); err == nil {
+		t.Fatal("expected a validation error")
+	}
+
+	_, span = tracer.Start(ctx, "b")
+	span.End()
+	x.Eq(2, span_a.exporter.count())
+
+	// The same tracer and counter follow the reload.
+	span_b, reader_b := &spanOnlyExporterConfig{}, &manualReaderConfig{}
+	x.NoError(r.Reload(ctx, newConfig(span_b, reader_b)))
+
+	_, span = tracer.Start(ctx, "c")
+	span.End()
+	counter.Add(ctx, 2)
+	x.Eq(2, span_a.exporter.count())
+	x.Eq(1, span_b.exporter.count())
+	x.Eq(int64(2), reader_b.sum(ctx, t))
+
+	// A provider the new config does not define becomes a noop.
+	c := newConfig(span_b, reader_b)
+	delete(c.Providers, "tracer")
+	delete(c.Exporters, "span")
+	x.NoError(r.Reload(ctx, c))
+
+	_, span = tracer.Start(ctx, "d")
+	span.End()
+	x.Eq(false, span.SpanContext().IsValid())
+}
+
+func TestReloaderObservable(t *testing.T) {
+	ctx, x := x.New(t)
+
+	newConfig := func(reader *manualReaderConfig) *mkot.Config {
+		c := mkot.NewConfig()
+		c.Exporters["reader"] = reader
+		c.Providers["meter"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"reader"}}
+		return c
+	}
+
+	reader_a := &manualReaderConfig{}
+	r := mkot.MakeReloader(ctx, newConfig(reader_a))
+	defer r.Shutdown(ctx)
+
+	mp, err := r.Meter(ctx, "")
+	x.NoError(err)
+
+	meter := mp.Meter("m")
+	counter, err := meter.Int64ObservableCounter("c")
+	x.NoError(err)
+	_, err = meter.RegisterCallback(func(ctx context.Context, o otelmetric.Observer) error {
+		o.ObserveInt64(counter, 42)
+		return nil
+	}, counter)
+	x.NoError(err)
+	x.Eq(int64(42), reader_a.sum(ctx, t))
+
+	reader_b := &manualReaderConfig{}
+	x.NoError(r.Reload(ctx, newConfig(reader_b)))
+	x.Eq(int64(42), reader_b.sum(ctx, t))
+}
+
+func TestWatchConfig(t *testing.T) {
+	ctx, x := x.New(t)
+
+	p := filepath.Join(t.TempDir(), "config.yaml")
+	x.NoError(os.WriteFile(p, []byte(`
+processors:
+  sampler: { type: always_off }
+providers:
+  tracer: { processors: [sampler] }
+`), 0644))
+
+	c, err := mkot.LoadConfig(p)
+	x.NoError(err)
+	r := mkot.MakeReloader(ctx, c)
+	defer r.Shutdown(ctx)
+
+	tp, err := r.Tracer(ctx, "")
+	x.NoError(err)
+	sampled := func() bool {
+		_, span := tp.Tracer("t").Start(ctx, "s")
+		defer span.End()
+		return span.SpanContext().IsSampled()
+	}
+	x.Eq(false, sampled())
+
+	ctx_watch, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	defer func() {
+		cancel()
+		<-done
+	}()
+	go func() {
+		defer close(done)
+		mkot.WatchConfig(ctx_watch, r, 10*time.Millisecond, func(err error) { t.Error(err) }, p)
+	}()
+
+	// Let the watcher take its baseline, then replace the file at once so the
+	// watcher never sees it half-written.
+	time.Sleep(50 * time.Millisecond)
+	next := p + ".next"
+	x.NoError(os.WriteFile(next, []byte(`
+processors:
+  sampler: { type: always_on }
+providers:
+  tracer: { processors: [sampler] }
+`), 0644))
+	x.NoError(os.Rename(next, p))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !sampled() {
+		if time.Now().After(deadline) {
+			t.Fatal("config was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,78 @@
+package mkot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lesomnus/mkot/internal/x"
+)
+
+func TestWatchConfigWaitsForWrites(t *testing.T) {
+	ctx, x := x.New(t)
+
+	p := filepath.Join(t.TempDir(), "config.yaml")
+	x.NoError(os.WriteFile(p, []byte(`
+processors:
+  sampler: { type: always_off }
+providers:
+  tracer: { processors: [sampler] }
+`), 0644))
+
+	c, err := LoadConfig(p)
+	x.NoError(err)
+	r := MakeReloader(ctx, c)
+	defer r.Shutdown(ctx)
+
+	tp, err := r.Tracer(ctx, "")
+	x.NoError(err)
+	sampled := func() bool {
+		_, span := tp.Tracer("t").Start(ctx, "s")
+		defer span.End()
+		return span.SpanContext().IsSampled()
+	}
+
+	// Each tick returns once the watcher has polled and is waiting again.
+	ticks := make(chan struct{})
+	idle := make(chan struct{})
+	tick := func() {
+		ticks <- struct{}{}
+		<-idle
+	}
+	done := make(chan struct{})
+	defer func() {
+		close(ticks)
+		<-done
+	}()
+	go func() {
+		defer close(done)
+		watchConfig(ctx, r, func() bool {
+			idle <- struct{}{}
+			_, ok := <-ticks
+			return ok
+		}, func(err error) { t.Error(err) }, p)
+	}()
+	<-idle
+
+	// Write the file in place in two steps; the half written file is invalid
+	// and must not be loaded.
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_TRUNC, 0644)
+	x.NoError(err)
+	defer f.Close()
+	_, err = f.WriteString("processors:\n  sampler: { type: ")
+	x.NoError(err)
+	tick()
+	_, err = f.WriteString(`always_on }
+providers:
+  tracer: { processors: [sampler] }
+`)
+	x.NoError(err)
+	x.NoError(f.Close())
+	tick()
+	x.Eq(false, sampled())
+
+	// Reloaded once the file stays the same for a tick.
+	tick()
+	tick()
+	x.Eq(true, sampled())
+}
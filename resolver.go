@@ -4,6 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
 
 	olog "go.opentelemetry.io/otel/log"
 	nooplogger "go.opentelemetry.io/otel/log/noop"
@@ -17,20 +21,40 @@ import (
 )
 
 // Resolver constructs providers from the config it is based on.
-// The providers are assumed to be unstarted before [Resolver.Start] is called.
+// The providers are assumed to be unstarted before [Resolver.Start] is called;
+// a provider resolved after that is started as it is built. Once
+// [Resolver.Shutdown] is called, providers resolve to noops along with
+// [ErrClosed]. All methods are safe for concurrent use.
+//
+// [Resolver.InstallGlobals] registers the default providers, those with no
+// name, and the configured propagators as the OpenTelemetry globals;
+// [Resolver.Shutdown] puts the previous globals back before anything else.
+//
+// [Resolver.Shutdown] flushes every provider before it shuts their components
+// down in parallel, each bounded by [Config.ShutdownTimeout] if it is set.
+//
+// If [Resolver.Start] fails, the components of every provider built so far are
+// shut down and the resolver is closed as if [Resolver.Shutdown] was called.
 type Resolver interface {
 	Tracer(ctx context.Context, name string, opts ...trace.TracerProviderOption) (otrace.TracerProvider, error)
 	Meter(ctx context.Context, name string, opts ...metric.Option) (ometric.MeterProvider, error)
 	Logger(ctx context.Context, name string, opts ...log.LoggerProviderOption) (olog.LoggerProvider, error)
 
+	InstallGlobals(ctx context.Context) error
+
 	Start(ctx context.Context) error
+	ForceFlush(ctx context.Context) error
 	Shutdown(ctx context.Context) error
 }
 
 func Make(ctx context.Context, c *Config) Resolver {
-	if c == nil || !c.IsEnabled() {
-		c = NewConfig()
-	}
+	r := newResolver(c)
+	r.global = r.config.Global
+	return r
+}
+
+func newResolver(c *Config) *resolver {
+	c = orDefault(c)
 	if c.Processors == nil {
 		c.Processors = map[Id]ProcessorConfig{}
 	}
@@ -42,316 +66,644 @@ func Make(ctx context.Context, c *Config) Resolver {
 	}
 	return &resolver{
 		config:    c,
+		resources: newResources(c.Resource),
 		providers: map[Id]*provider{},
 	}
 }
 
+// orDefault returns c, or an empty config if c is nil or disabled.
+func orDefault(c *Config) *Config {
+	if c == nil || !c.IsEnabled() {
+		return NewConfig()
+	}
+	return c
+}
+
 type resolver struct {
 	config    *Config
+	global    bool
+	resources *resources
+
+	mu        sync.Mutex
+	state     state
 	providers map[Id]*provider
+
+	// restore puts back the globals [Resolver.InstallGlobals] replaced.
+	restore func()
 }
 
+type state int
+
+const (
+	stateCreated state = iota
+	stateStarted
+	stateClosed
+)
+
 type provider struct {
+	// ready is closed once the provider is built, successfully or not.
+	ready chan struct{}
+	err   error
+
+	// built is set, under the resolver's lock, once the components are
+	// built; from then on starting and shutting them down is up to the
+	// resolver's lifecycle rather than the build.
+	built bool
+
 	value      any
 	components map[Id]any
 }
 
-func (r *resolver) Start(ctx context.Context) (err error) {
-	components := []any{}
+// snapshot returns the providers whose components are built.
+// It must be called with the lock held.
+func (r *resolver) snapshot() map[Id]*provider {
+	ps := map[Id]*provider{}
+	for id, p := range r.providers {
+		if p.built {
+			ps[id] = p
+		}
+	}
+	return ps
+}
+
+// resolve returns the provider of the given id, building it with build on
+// the first call. An id that falls back to another provider, as
+// [Config.Fallback] describes, shares it. Concurrent calls for the same id
+// wait for the single build in flight instead of building their own. A failed
+// build is not kept, so a later call tries again.
+//
+// A provider built after [Resolver.Start] has its components started before
+// it is returned, and no provider is built after [Resolver.Shutdown].
+func (r *resolver) resolve(ctx context.Context, id Id, build func(ctx context.Context, id Id, c *ProviderConfig) (any, map[Id]any, error)) (any, error) {
+	r.mu.Lock()
+	if r.state == stateClosed {
+		r.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if r.providers == nil {
+		r.providers = map[Id]*provider{}
+	}
+
+	id, c, ok := r.config.provider(id)
+	if !ok {
+		r.mu.Unlock()
+		return nil, ErrNotExist
+	}
+	if p, ok := r.providers[id]; ok {
+		r.mu.Unlock()
+		select {
+		case <-p.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if p.err != nil {
+			return nil, p.err
+		}
+		return p.value, nil
+	}
+
+	p := &provider{ready: make(chan struct{})}
+	r.providers[id] = p
+	r.mu.Unlock()
+
+	defer close(p.ready)
+	p.value, p.components, p.err = build(context.WithValue(ctx, resourcesKey{}, r.resources), id, c)
+
+	r.mu.Lock()
+	s := r.state
+	if p.err == nil && s != stateClosed {
+		p.built = true
+	} else {
+		delete(r.providers, id)
+	}
+	r.mu.Unlock()
+
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	switch s {
+	case stateStarted:
+		// [Resolver.Start] has already run, so nothing else starts them.
+		if err := startComponents(ctx, id, p.components); err != nil {
+			r.mu.Lock()
+			delete(r.providers, id)
+			r.mu.Unlock()
+
+			p.err = err
+			return nil, err
+		}
+	case stateClosed:
+		// Shut down while building; the components were never handed out.
+		shutdownComponents(ctx, id, p.components)
+		p.err = ErrClosed
+		return nil, ErrClosed
+	}
+
+	return p.value, nil
+}
+
+// startComponents starts the components that need it. If one fails, the
+// ones already started are shut down.
+func startComponents(ctx context.Context, pid Id, components map[Id]any) (err error) {
+	started := []any{}
 	defer func() {
 		if err == nil {
 			return
 		}
 
-		for _, c := range components {
-			c_, ok := c.(interface {
+		for _, c := range started {
+			c.(interface {
 				Shutdown(ctx context.Context) error
-			})
-			if !ok {
-				continue
-			}
-
-			c_.Shutdown(ctx)
+			}).Shutdown(ctx)
 		}
 	}()
 
-	for pid, p := range r.providers {
-		for cid, c := range p.components {
-			c_, ok := c.(interface {
-				Start(ctx context.Context) error
-			})
-			if !ok {
-				continue
-			}
+	for cid, c := range components {
+		c_, ok := c.(interface {
+			Start(ctx context.Context) error
+		})
+		if !ok {
+			continue
+		}
 
-			if err = c_.Start(ctx); err != nil {
-				return fmt.Errorf("provider[%q].component[%q]: %w", pid, cid, err)
-			}
+		if err = c_.Start(ctx); err != nil {
+			return fmt.Errorf("provider[%q].component[%q]: %w", pid, cid, err)
+		}
 
-			components = append(components, c_)
+		if _, ok := c.(interface {
+			Shutdown(ctx context.Context) error
+		}); ok {
+			started = append(started, c)
 		}
 	}
 
 	return nil
 }
 
-func (r *resolver) Shutdown(ctx context.Context) error {
+func shutdownComponents(ctx context.Context, pid Id, components map[Id]any) []error {
 	errs := []error{}
-	for pid, p := range r.providers {
-		for cid, c := range p.components {
-			c_, ok := c.(interface {
-				Shutdown(ctx context.Context) error
-			})
-			if !ok {
-				continue
-			}
+	for cid, c := range components {
+		c_, ok := c.(interface {
+			Shutdown(ctx context.Context) error
+		})
+		if !ok {
+			continue
+		}
 
-			err := c_.Shutdown(ctx)
-			if err != nil {
-				errs = append(errs, fmt.Errorf("provider[%q][%q]: %w", pid, cid, err))
-			}
+		err := c_.Shutdown(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("provider[%q][%q]: %w", pid, cid, err))
 		}
 	}
-
-	return errors.Join(errs...)
+	return errs
 }
 
-func (r *resolver) Tracer(ctx context.Context, name string, opts ...trace.TracerProviderOption) (otrace.TracerProvider, error) {
-	noop := nooptracer.NewTracerProvider()
+// shutdownComponent shuts c down within timeout, if it is positive. A
+// component that does not return by the deadline is left behind and reported
+// along with the number of items it dropped, if it can tell.
+func shutdownComponent(ctx context.Context, pid Id, cid Id, c interface {
+	Shutdown(ctx context.Context) error
+}, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
-	id := Id("tracer").WithName(name)
-	if r.providers == nil {
-		r.providers = map[Id]*provider{}
+	done := make(chan error, 1)
+	go func() { done <- c.Shutdown(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
 	}
-	if p, ok := r.providers[id]; ok {
-		return p.value.(otrace.TracerProvider), nil
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("provider[%q][%q]: %w", pid, cid, err)
 	}
 
-	c, ok := r.config.Providers[id]
-	if !ok {
-		return noop, ErrNotExist
+	msg := "timed out"
+	if timeout > 0 {
+		msg = fmt.Sprintf("timed out after %s", timeout)
+	}
+	if n := pendingOf(c); n >= 0 {
+		msg = fmt.Sprintf("%s, %d items dropped", msg, n)
 	}
+	return fmt.Errorf("provider[%q][%q]: %s: %w", pid, cid, msg, err)
+}
 
-	components := map[Id]any{}
-	for _, id := range c.Processors {
-		if err := func() error {
-			c, ok := r.config.Processors[id]
-			if !ok {
-				return fmt.Errorf("not found")
-			}
+func (r *resolver) Start(ctx context.Context) (err error) {
+	r.mu.Lock()
+	switch r.state {
+	case stateStarted:
+		r.mu.Unlock()
+		return nil
+	case stateClosed:
+		r.mu.Unlock()
+		return ErrClosed
+	}
+	r.state = stateStarted
+	ps := r.snapshot()
+	r.mu.Unlock()
 
-			c_, ok := c.(TracerProviderConfig)
-			if !ok {
-				return fmt.Errorf("not for the tracer")
-			}
+	defer func() {
+		if err == nil {
+			return
+		}
 
-			opts_, err := c_.TracerOpts(ctx)
-			if err != nil {
-				return err
-			}
-			if opts_ == nil {
-				return fmt.Errorf("not for the tracer")
-			}
+		// A half started resolver is closed, so no provider is built or
+		// started against it, and a later Shutdown does nothing. Every
+		// component is shut down here then, whether it was started, built
+		// while starting, or never reached.
+		r.mu.Lock()
+		r.state = stateClosed
+		all := r.snapshot()
+		restore := r.restore
+		r.restore = nil
+		r.mu.Unlock()
+
+		if restore != nil {
+			restore()
+		}
+		for pid, p := range all {
+			shutdownComponents(ctx, pid, p.components)
+		}
+	}()
 
-			opts = append(opts, opts_...)
-			return nil
-		}(); err != nil {
-			return noop, fmt.Errorf("processor %q: %w", id.String(), err)
+	for pid, p := range ps {
+		if err = startComponents(ctx, pid, p.components); err != nil {
+			return err
 		}
 	}
-	for _, id := range c.Exporters {
-		if err := func() error {
-			c, ok := r.config.Exporters[id]
-			if !ok {
-				return fmt.Errorf("not found")
-			}
 
-			c_, ok := c.(SpanExporterConfig)
-			if !ok {
-				return fmt.Errorf("not a span exporter")
-			}
+	if r.global {
+		if err = r.InstallGlobals(ctx); err != nil {
+			return fmt.Errorf("install globals: %w", err)
+		}
+	}
 
-			v, opts_, err := c_.SpanExporter(ctx)
-			if err != nil {
-				return err
-			}
+	return nil
+}
 
-			components[id] = v
-			opts = append(opts, opts_...)
-			return nil
-		}(); err != nil {
-			return noop, fmt.Errorf("exporter %q: %w", id.String(), err)
-		}
+func (r *resolver) InstallGlobals(ctx context.Context) error {
+	p, err := r.config.Propagator()
+	if err != nil {
+		return fmt.Errorf("propagators: %w", err)
+	}
+	tp, mp, lp, err := resolveDefaults(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
+	if r.state == stateClosed {
+		return ErrClosed
 	}
+	if r.restore != nil {
+		return nil
+	}
+	r.restore = installGlobals(tp, mp, lp, p)
+	return nil
+}
 
-	v := trace.NewTracerProvider(opts...)
-	r.providers[id] = &provider{
-		value:      v,
-		components: components,
+// flush flushes the given providers in parallel, each within timeout if it is
+// positive.
+func flush(ctx context.Context, ps map[Id]*provider, timeout time.Duration) error {
+	ids := slices.Sorted(maps.Keys(ps))
+	errs := make([]error, len(ids))
+
+	wg := sync.WaitGroup{}
+	for i, pid := range ids {
+		v, ok := ps[pid].value.(interface {
+			ForceFlush(ctx context.Context) error
+		})
+		if !ok {
+			continue
+		}
+		wg.Go(func() {
+			ctx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			if err := v.ForceFlush(ctx); err != nil {
+				errs[i] = fmt.Errorf("provider[%q]: flush: %w", pid, err)
+			}
+		})
 	}
-	return v, nil
+	wg.Wait()
+
+	return errors.Join(errs...)
 }
 
-func (r *resolver) Meter(ctx context.Context, name string, opts ...metric.Option) (ometric.MeterProvider, error) {
-	noop := noopmeter.NewMeterProvider()
+func (r *resolver) ForceFlush(ctx context.Context) error {
+	r.mu.Lock()
+	if r.state == stateClosed {
+		r.mu.Unlock()
+		return ErrClosed
+	}
+	ps := r.snapshot()
+	r.mu.Unlock()
 
-	id := Id("meter").WithName(name)
-	if r.providers == nil {
-		r.providers = map[Id]*provider{}
+	return flush(ctx, ps, 0)
+}
+
+func (r *resolver) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if r.state == stateClosed {
+		r.mu.Unlock()
+		return nil
 	}
-	if p, ok := r.providers[id]; ok {
-		return p.value.(ometric.MeterProvider), nil
+	r.state = stateClosed
+	ps := r.snapshot()
+	restore := r.restore
+	r.restore = nil
+	r.mu.Unlock()
+
+	if restore != nil {
+		restore()
 	}
 
-	c, ok := r.config.Providers[id]
-	if !ok {
-		return noop, ErrNotExist
-	}
+	// Every provider hands its data over to its components before any
+	// component closes, so closing them in parallel loses nothing buffered in
+	// the providers.
+	errs := []error{flush(ctx, ps, r.config.ShutdownTimeout)}
 
-	components := map[Id]any{}
-	for _, id := range c.Processors {
-		if err := func() error {
-			c, ok := r.config.Processors[id]
+	type entry struct {
+		pid Id
+		cid Id
+		c   interface {
+			Shutdown(ctx context.Context) error
+		}
+	}
+	entries := []entry{}
+	for _, pid := range slices.Sorted(maps.Keys(ps)) {
+		components := ps[pid].components
+		for _, cid := range slices.Sorted(maps.Keys(components)) {
+			c, ok := components[cid].(interface {
+				Shutdown(ctx context.Context) error
+			})
 			if !ok {
-				return fmt.Errorf("not found")
+				continue
 			}
+			entries = append(entries, entry{pid, cid, c})
+		}
+	}
 
-			c_, ok := c.(MeterProviderConfig)
-			if !ok {
-				return fmt.Errorf("not for the meter")
-			}
+	errs_ := make([]error, len(entries))
+	wg := sync.WaitGroup{}
+	for i, e := range entries {
+		wg.Go(func() {
+			errs_[i] = shutdownComponent(ctx, e.pid, e.cid, e.c, r.config.ShutdownTimeout)
+		})
+	}
+	wg.Wait()
+
+	return errors.Join(append(errs, errs_...)...)
+}
+
+func (r *resolver) Tracer(ctx context.Context, name string, opts ...trace.TracerProviderOption) (otrace.TracerProvider, error) {
+	v, err := r.tracer(ctx, Id("tracer").WithName(name), opts)
+	if err != nil {
+		return nooptracer.NewTracerProvider(), err
+	}
+	return v, nil
+}
 
-			opts_, err := c_.MeterOpts(ctx)
+func (r *resolver) tracer(ctx context.Context, id Id, opts []trace.TracerProviderOption) (otrace.TracerProvider, error) {
+	v, err := r.resolve(ctx, id, func(ctx context.Context, id Id, c *ProviderConfig) (any, map[Id]any, error) {
+		if len(c.Include) > 0 {
+			ids, err := r.config.includes(id)
 			if err != nil {
-				return err
+				return nil, nil, err
 			}
-			if opts_ == nil {
-				return fmt.Errorf("not for the meter")
+
+			vs := make([]otrace.TracerProvider, len(ids))
+			for i, id := range ids {
+				if vs[i], err = r.tracer(ctx, id, opts); err != nil {
+					return nil, nil, fmt.Errorf("include %q: %w", id.String(), err)
+				}
 			}
+			return &multiTracerProvider{providers: vs}, map[Id]any{}, nil
+		}
+
+		// Pipelines share the id generator so a fan-out can record the same
+		// span in each of them. Options given later still override it, as
+		// they do the top-level resource.
+		opts = append([]trace.TracerProviderOption{trace.WithIDGenerator(idGenerator{})}, opts...)
+		if v, err := r.resources.base(ctx); err != nil {
+			return nil, nil, fmt.Errorf("resource: %w", err)
+		} else if v != nil {
+			opts = append([]trace.TracerProviderOption{trace.WithResource(v)}, opts...)
+		}
 
+		components := map[Id]any{}
+		for _, id := range c.Processors {
+			opts_, err := r.config.tracerOpts(ctx, id)
+			if err != nil {
+				return nil, nil, fmt.Errorf("processor %q: %w", id.String(), err)
+			}
 			opts = append(opts, opts_...)
-			return nil
-		}(); err != nil {
-			return noop, fmt.Errorf("processor %q: %w", id.String(), err)
 		}
-	}
-	for _, id := range c.Exporters {
-		if err := func() error {
-			c, ok := r.config.Exporters[id]
-			if !ok {
-				return fmt.Errorf("not found")
+		wire, err := r.config.spanProcessor(c.Processors)
+		if err != nil {
+			return nil, nil, err
+		}
+		wrappers := r.config.spanWrappers(c.Processors)
+		for _, id := range c.Exporters {
+			v, opts_, err := r.config.spanExporter(ctx, id)
+			if err != nil {
+				return nil, nil, fmt.Errorf("exporter %q: %w", id.String(), err)
 			}
-
-			// Prefer the reader: it is the lifecycle component. Its Shutdown
-			// drives the final Collect+Export and it honors the configured push
-			// interval. The bare-exporter path cannot flush on Shutdown because
-			// the resolver tracks the returned value as the shutdown component,
-			// and shutting down an exporter does not collect from its reader.
-			if v, opts_, err := c.MetricReader(ctx); err == nil {
-				components[id] = v
-				opts = append(opts, opts_...)
-				return nil
-			} else if !errors.Is(err, ErrUnimplemented) {
-				return err
+			if wire != nil {
+				// The exporter's own processor is left unused; shutting down
+				// the one wired in its place shuts the exporter down.
+				if storedOf(v) {
+					v.(spanComponent).Shutdown(ctx)
+					return nil, nil, fmt.Errorf("exporter %q: %w", id.String(), errStorageBypassed)
+				}
+				v_ := v.(trace.SpanExporter)
+				p, err := wire.SpanProcessor(ctx, v_)
+				if err != nil {
+					return nil, nil, fmt.Errorf("exporter %q: %w", id.String(), err)
+				}
+				v, opts_ = SpanComponent(v_, p), []trace.TracerProviderOption{trace.WithSpanProcessor(p)}
 			}
-
-			if v, opts_, err := c.MetricExporter(ctx); err == nil {
-				components[id] = v
-				opts = append(opts, opts_...)
-				return nil
-			} else if !errors.Is(err, ErrUnimplemented) {
-				return err
+			if len(wrappers) > 0 {
+				c, ok := v.(spanComponent)
+				if !ok {
+					return nil, nil, fmt.Errorf("exporter %q: its span processor cannot be wrapped", id.String())
+				}
+				// The first processor listed sees the spans first.
+				p := c.p
+				for i := len(wrappers) - 1; i >= 0; i-- {
+					if p, err = wrappers[i].WrapSpanProcessor(ctx, p); err != nil {
+						return nil, nil, fmt.Errorf("exporter %q: %w", id.String(), err)
+					}
+				}
+				v, opts_ = SpanComponent(c.SpanExporter, p), []trace.TracerProviderOption{trace.WithSpanProcessor(p)}
 			}
 
-			return ErrUnimplemented
-		}(); err != nil {
-			return noop, fmt.Errorf("exporter %q: %w", id.String(), err)
+			components[id] = v
+			opts = append(opts, opts_...)
 		}
 
+		return trace.NewTracerProvider(opts...), components, nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return v.(otrace.TracerProvider), nil
+}
 
-	v := metric.NewMeterProvider(opts...)
-	r.providers[id] = &provider{
-		value:      v,
-		components: components,
+func (r *resolver) Meter(ctx context.Context, name string, opts ...metric.Option) (ometric.MeterProvider, error) {
+	v, err := r.meter(ctx, Id("meter").WithName(name), opts)
+	if err != nil {
+		return noopmeter.NewMeterProvider(), err
 	}
 	return v, nil
 }
 
-func (r *resolver) Logger(ctx context.Context, name string, opts ...log.LoggerProviderOption) (olog.LoggerProvider, error) {
-	noop := nooplogger.NewLoggerProvider()
-
-	id := Id("logger").WithName(name)
-	if r.providers == nil {
-		r.providers = map[Id]*provider{}
-	}
-	if p, ok := r.providers[id]; ok {
-		return p.value.(olog.LoggerProvider), nil
-	}
-
-	c, ok := r.config.Providers[id]
-	if !ok {
-		return nil, ErrNotExist
-	}
-
-	components := map[Id]any{}
-	for _, id := range c.Processors {
-		if err := func() error {
-			c, ok := r.config.Processors[id]
-			if !ok {
-				return fmt.Errorf("not found")
+func (r *resolver) meter(ctx context.Context, id Id, opts []metric.Option) (ometric.MeterProvider, error) {
+	v, err := r.resolve(ctx, id, func(ctx context.Context, id Id, c *ProviderConfig) (any, map[Id]any, error) {
+		if len(c.Include) > 0 {
+			ids, err := r.config.includes(id)
+			if err != nil {
+				return nil, nil, err
 			}
 
-			c_, ok := c.(LoggerProviderConfig)
-			if !ok {
-				return fmt.Errorf("not for the logger")
+			vs := make([]ometric.MeterProvider, len(ids))
+			for i, id := range ids {
+				if vs[i], err = r.meter(ctx, id, opts); err != nil {
+					return nil, nil, fmt.Errorf("include %q: %w", id.String(), err)
+				}
 			}
+			return multiMeterProvider{providers: vs}, map[Id]any{}, nil
+		}
+
+		if v, err := r.resources.base(ctx); err != nil {
+			return nil, nil, fmt.Errorf("resource: %w", err)
+		} else if v != nil {
+			opts = append([]metric.Option{metric.WithResource(v)}, opts...)
+		}
 
-			opts_, err := c_.LoggerOpts(ctx)
+		components := map[Id]any{}
+		for _, id := range c.Processors {
+			opts_, err := r.config.meterOpts(ctx, id)
 			if err != nil {
-				return err
+				return nil, nil, fmt.Errorf("processor %q: %w", id.String(), err)
 			}
-			if opts_ == nil {
-				return fmt.Errorf("not for the logger")
+			opts = append(opts, opts_...)
+		}
+		for _, id := range c.Exporters {
+			v, opts_, err := r.config.metricExporter(ctx, id)
+			if err != nil {
+				return nil, nil, fmt.Errorf("exporter %q: %w", id.String(), err)
 			}
 
+			components[id] = v
 			opts = append(opts, opts_...)
-			return nil
-		}(); err != nil {
-			return noop, fmt.Errorf("processor %q: %w", id.String(), err)
 		}
+
+		return metric.NewMeterProvider(opts...), components, nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	for _, id := range c.Exporters {
-		if err := func() error {
-			c, ok := r.config.Exporters[id]
-			if !ok {
-				return fmt.Errorf("not found")
-			}
+	return v.(ometric.MeterProvider), nil
+}
 
-			c_, ok := c.(LogExporterConfig)
-			if !ok {
-				return fmt.Errorf("not a log exporter")
+func (r *resolver) Logger(ctx context.Context, name string, opts ...log.LoggerProviderOption) (olog.LoggerProvider, error) {
+	v, err := r.logger(ctx, Id("logger").WithName(name), opts)
+	if err != nil {
+		return nooplogger.NewLoggerProvider(), err
+	}
+	return v, nil
+}
+
+func (r *resolver) logger(ctx context.Context, id Id, opts []log.LoggerProviderOption) (olog.LoggerProvider, error) {
+	v, err := r.resolve(ctx, id, func(ctx context.Context, id Id, c *ProviderConfig) (any, map[Id]any, error) {
+		if len(c.Include) > 0 {
+			ids, err := r.config.includes(id)
+			if err != nil {
+				return nil, nil, err
+			}
 
+			vs := make([]olog.LoggerProvider, len(ids))
+			for i, id := range ids {
+				if vs[i], err = r.logger(ctx, id, opts); err != nil {
+					return nil, nil, fmt.Errorf("include %q: %w", id.String(), err)
+				}
 			}
+			return multiLoggerProvider{providers: vs}, map[Id]any{}, nil
+		}
+
+		if v, err := r.resources.base(ctx); err != nil {
+			return nil, nil, fmt.Errorf("resource: %w", err)
+		} else if v != nil {
+			opts = append([]log.LoggerProviderOption{log.WithResource(v)}, opts...)
+		}
 
-			v, opts_, err := c_.LogExporter(ctx)
+		components := map[Id]any{}
+		for _, id := range c.Processors {
+			opts_, err := r.config.loggerOpts(ctx, id)
 			if err != nil {
-				return err
+				return nil, nil, fmt.Errorf("processor %q: %w", id.String(), err)
+			}
+			opts = append(opts, opts_...)
+		}
+		wire, err := r.config.logProcessor(c.Processors)
+		if err != nil {
+			return nil, nil, err
+		}
+		wrappers := r.config.logWrappers(c.Processors)
+		for _, id := range c.Exporters {
+			v, opts_, err := r.config.logExporter(ctx, id)
+			if err != nil {
+				return nil, nil, fmt.Errorf("exporter %q: %w", id.String(), err)
+			}
+			if wire != nil {
+				if storedOf(v) {
+					v.(logComponent).Shutdown(ctx)
+					return nil, nil, fmt.Errorf("exporter %q: %w", id.String(), errStorageBypassed)
+				}
+				v_ := v.(log.Exporter)
+				p, err := wire.LogProcessor(ctx, v_)
+				if err != nil {
+					return nil, nil, fmt.Errorf("exporter %q: %w", id.String(), err)
+				}
+				v, opts_ = LogComponent(v_, p), []log.LoggerProviderOption{log.WithProcessor(p)}
+			}
+			if len(wrappers) > 0 {
+				c, ok := v.(logComponent)
+				if !ok {
+					return nil, nil, fmt.Errorf("exporter %q: its log processor cannot be wrapped", id.String())
+				}
+				p := c.p
+				for i := len(wrappers) - 1; i >= 0; i-- {
+					if p, err = wrappers[i].WrapLogProcessor(ctx, p); err != nil {
+						return nil, nil, fmt.Errorf("exporter %q: %w", id.String(), err)
+					}
+				}
+				v, opts_ = LogComponent(c.Exporter, p), []log.LoggerProviderOption{log.WithProcessor(p)}
 			}
 
 			components[id] = v
 			opts = append(opts, opts_...)
-			return nil
-		}(); err != nil {
-			return noop, fmt.Errorf("exporter %q: %w", id.String(), err)
 		}
-	}
 
-	v := log.NewLoggerProvider(opts...)
-	r.providers[id] = &provider{
-		value:      v,
-		components: components,
+		return log.NewLoggerProvider(opts...), components, nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return v, nil
+	return v.(olog.LoggerProvider), nil
 }
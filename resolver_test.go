@@ -0,0 +1,398 @@
+package mkot_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lesomnus/mkot"
+	"github.com/lesomnus/mkot/internal/x"
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// countingExporterConfig counts how many times each signal is built.
+type countingExporterConfig struct {
+	mkot.UnimplementedExporterConfig `yaml:"-"`
+
+	spans   atomic.Int32
+	metrics atomic.Int32
+	logs    atomic.Int32
+}
+
+func (c *countingExporterConfig) SpanExporter(ctx context.Context) (trace.SpanExporter, []trace.TracerProviderOption, error) {
+	c.spans.Add(1)
+	v := &recordingSpanExporter{}
+	return v, []trace.TracerProviderOption{trace.WithSyncer(v)}, nil
+}
+
+func (c *countingExporterConfig) MetricReader(ctx context.Context) (metric.Reader, []metric.Option, error) {
+	c.metrics.Add(1)
+	v := metric.NewManualReader()
+	return v, []metric.Option{metric.WithReader(v)}, nil
+}
+
+func (c *countingExporterConfig) LogExporter(ctx context.Context) (log.Exporter, []log.LoggerProviderOption, error) {
+	c.logs.Add(1)
+	v := nopLogExporter{}
+	return v, []log.LoggerProviderOption{log.WithProcessor(log.NewSimpleProcessor(v))}, nil
+}
+
+type nopLogExporter struct{}
+
+func (nopLogExporter) Export(context.Context, []log.Record) error { return nil }
+func (nopLogExporter) Shutdown(context.Context) error             { return nil }
+func (nopLogExporter) ForceFlush(context.Context) error           { return nil }
+
+func TestResolverConcurrent(t *testing.T) {
+	ctx, x := x.New(t)
+
+	const Names = 4
+	const Workers = 32
+
+	exporter := &countingExporterConfig{}
+	c := mkot.NewConfig()
+	c.Exporters["counting"] = exporter
+	for i := range Names {
+		name := fmt.Sprintf("n%d", i)
+		for _, t := range []string{"tracer", "meter", "logger"} {
+			c.Providers[mkot.Id(t).WithName(name)] = &mkot.ProviderConfig{
+				Exporters: []mkot.Id{"counting"},
+			}
+		}
+	}
+
+	r := mkot.Make(ctx, c)
+
+	start := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i := range Workers {
+		wg.Go(func() {
+			<-start
+
+			name := fmt.Sprintf("n%d", i%Names)
+			tp, err := r.Tracer(ctx, name)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mp, err := r.Meter(ctx, name)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			lp, err := r.Logger(ctx, name)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			_, span := tp.Tracer("t").Start(ctx, "s")
+			span.End()
+			counter, err := mp.Meter("m").Int64Counter("c")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			counter.Add(ctx, 1)
+			lp.Logger("l")
+
+			if _, err := r.Tracer(ctx, "missing"); err == nil {
+				t.Error("expected ErrNotExist")
+			}
+		})
+	}
+	for range Workers / 8 {
+		wg.Go(func() {
+			<-start
+			if err := r.Start(ctx); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	close(start)
+	wg.Wait()
+	x.NoError(r.Shutdown(ctx))
+
+	// Every provider is built exactly once, however many goroutines race for it.
+	x.Eq(int32(Names), exporter.spans.Load())
+	x.Eq(int32(Names), exporter.metrics.Load())
+	x.Eq(int32(Names), exporter.logs.Load())
+}
+
+func TestResolverSameProvider(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := mkot.NewConfig()
+	c.Exporters["counting"] = &countingExporterConfig{}
+	c.Providers["tracer"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"counting"}}
+	r := mkot.Make(ctx, c)
+
+	const Workers = 16
+	vs := make(chan any, Workers)
+	wg := sync.WaitGroup{}
+	for range Workers {
+		wg.Go(func() {
+			v, err := r.Tracer(ctx, "")
+			if err != nil {
+				t.Error(err)
+			}
+			vs <- v
+		})
+	}
+	wg.Wait()
+	close(vs)
+
+	first := <-vs
+	for v := range vs {
+		if v != first {
+			t.Fatal("concurrent calls resolved different providers")
+		}
+	}
+	x.NoError(r.Shutdown(ctx))
+}
+
+type lifecycleSpanExporter struct {
+	recordingSpanExporter
+
+	fail     error
+	started  atomic.Bool
+	shutdown atomic.Bool
+}
+
+func (e *lifecycleSpanExporter) Start(context.Context) error {
+	if e.fail != nil {
+		return e.fail
+	}
+	e.started.Store(true)
+	return nil
+}
+
+func (e *lifecycleSpanExporter) Shutdown(context.Context) error {
+	e.shutdown.Store(true)
+	return nil
+}
+
+type lifecycleExporterConfig struct {
+	mkot.UnimplementedExporterConfig `yaml:"-"`
+
+	exporters []*lifecycleSpanExporter
+}
+
+func (c *lifecycleExporterConfig) SpanExporter(ctx context.Context) (trace.SpanExporter, []trace.TracerProviderOption, error) {
+	v := &lifecycleSpanExporter{}
+	c.exporters = append(c.exporters, v)
+	return v, []trace.TracerProviderOption{trace.WithSyncer(v)}, nil
+}
+
+func TestResolverLifecycle(t *testing.T) {
+	ctx, x := x.New(t)
+
+	exporter := &lifecycleExporterConfig{}
+	c := mkot.NewConfig()
+	c.Exporters["lifecycle"] = exporter
+	c.Providers["tracer/early"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"lifecycle"}}
+	c.Providers["tracer/late"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"lifecycle"}}
+	c.Providers["tracer/never"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"lifecycle"}}
+	r := mkot.Make(ctx, c)
+
+	_, err := r.Tracer(ctx, "early")
+	x.NoError(err)
+	early := exporter.exporters[0]
+	x.Eq(false, early.started.Load())
+
+	x.NoError(r.Start(ctx))
+	x.Eq(true, early.started.Load())
+
+	// Resolved after Start: started right away.
+	_, err = r.Tracer(ctx, "late")
+	x.NoError(err)
+	late := exporter.exporters[1]
+	x.Eq(true, late.started.Load())
+
+	x.NoError(r.Shutdown(ctx))
+	x.Eq(true, early.shutdown.Load())
+	x.Eq(true, late.shutdown.Load())
+
+	// Nothing is built after Shutdown.
+	tp, err := r.Tracer(ctx, "never")
+	x.ErrorIs(err, mkot.ErrClosed)
+	_, span := tp.Tracer("t").Start(ctx, "s")
+	x.Eq(false, span.SpanContext().IsValid())
+	x.Eq(2, len(exporter.exporters))
+
+	// Already resolved providers are not handed out either.
+	_, err = r.Tracer(ctx, "early")
+	x.ErrorIs(err, mkot.ErrClosed)
+
+	x.ErrorIs(r.Start(ctx), mkot.ErrClosed)
+	x.NoError(r.Shutdown(ctx))
+}
+
+func TestResolverStartFails(t *testing.T) {
+	ctx, x := x.New(t)
+
+	exporter := &lifecycleExporterConfig{}
+	c := mkot.NewConfig()
+	c.Exporters["lifecycle"] = exporter
+	c.Providers["tracer/a"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"lifecycle"}}
+	c.Providers["tracer/b"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"lifecycle"}}
+	c.Providers["tracer/c"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"lifecycle"}}
+	c.Providers["tracer/late"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"lifecycle"}}
+	r := mkot.Make(ctx, c)
+
+	_, err := r.Tracer(ctx, "a")
+	x.NoError(err)
+	_, err = r.Tracer(ctx, "b")
+	x.NoError(err)
+	_, err = r.Tracer(ctx, "c")
+	x.NoError(err)
+	errFail := errors.New("fail")
+	exporter.exporters[1].fail = errFail
+
+	x.ErrorIs(r.Start(ctx), errFail)
+	for _, e := range exporter.exporters {
+		// Shut down whether Start reached it or not.
+		x.Eq(true, e.shutdown.Load())
+	}
+
+	// The resolver is closed rather than left half started.
+	_, err = r.Tracer(ctx, "late")
+	x.ErrorIs(err, mkot.ErrClosed)
+	x.Eq(3, len(exporter.exporters))
+	x.ErrorIs(r.Start(ctx), mkot.ErrClosed)
+	x.NoError(r.Shutdown(ctx))
+}
+
+// stuckSpanExporter is an exporter whose endpoint never answers until it is
+// released.
+type stuckSpanExporter struct {
+	release chan struct{}
+}
+
+func (e *stuckSpanExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	<-e.release
+	return nil
+}
+
+func (e *stuckSpanExporter) Shutdown(ctx context.Context) error {
+	<-e.release
+	return nil
+}
+
+type stuckExporterConfig struct {
+	mkot.UnimplementedExporterConfig `yaml:"-"`
+
+	exporter *stuckSpanExporter
+}
+
+func (c *stuckExporterConfig) SpanExporter(ctx context.Context) (trace.SpanExporter, []trace.TracerProviderOption, error) {
+	p, err := mkot.QueueConfig{}.BuildSpanProcessor(c.exporter)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mkot.SpanComponent(c.exporter, p), []trace.TracerProviderOption{trace.WithSpanProcessor(p)}, nil
+}
+
+func TestResolverShutdownTimeout(t *testing.T) {
+	ctx, x := x.New(t)
+
+	stuck := &stuckSpanExporter{release: make(chan struct{})}
+	defer close(stuck.release)
+
+	lifecycle := &lifecycleExporterConfig{}
+	c := mkot.NewConfig()
+	c.ShutdownTimeout = 50 * time.Millisecond
+	c.Exporters["stuck"] = &stuckExporterConfig{exporter: stuck}
+	c.Exporters["lifecycle"] = lifecycle
+	c.Providers["tracer/stuck"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"stuck"}}
+	c.Providers["tracer/ok"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"lifecycle"}}
+	r := mkot.Make(ctx, c)
+	x.NoError(r.Start(ctx))
+
+	tp, err := r.Tracer(ctx, "stuck")
+	x.NoError(err)
+	_, err = r.Tracer(ctx, "ok")
+	x.NoError(err)
+	for range 3 {
+		_, span := tp.Tracer("t").Start(ctx, "s")
+		span.End()
+	}
+
+	t0 := time.Now()
+	err = r.Shutdown(ctx)
+	x.ErrorIs(err, context.DeadlineExceeded)
+	x.Contains(err.Error(), `provider["tracer/stuck"]: flush:`)
+	x.Contains(err.Error(), `provider["tracer/stuck"]["stuck"]: timed out after 50ms, 3 items dropped`)
+	if d := time.Since(t0); d > time.Second {
+		t.Fatalf("shutdown took %s", d)
+	}
+
+	// The stuck component does not hold up the others.
+	x.Eq(1, len(lifecycle.exporters))
+	x.Eq(true, lifecycle.exporters[0].shutdown.Load())
+}
+
+func TestResolverForceFlush(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := mkot.NewConfig()
+	c.Exporters["counting"] = &countingExporterConfig{}
+	c.Providers["meter"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"counting"}}
+	r := mkot.Make(ctx, c)
+
+	_, err := r.Meter(ctx, "")
+	x.NoError(err)
+	x.NoError(r.ForceFlush(ctx))
+	x.NoError(r.Shutdown(ctx))
+	x.ErrorIs(r.ForceFlush(ctx), mkot.ErrClosed)
+}
+
+func TestResolverFallback(t *testing.T) {
+	ctx, x := x.New(t)
+
+	exporter := &countingExporterConfig{}
+	c := mkot.NewConfig()
+	c.Fallback = true
+	c.Exporters["counting"] = exporter
+	c.Providers["tracer"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"counting"}}
+	c.Providers["tracer/db"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"counting"}}
+	r := mkot.Make(ctx, c)
+
+	root, err := r.Tracer(ctx, "")
+	x.NoError(err)
+	db, err := r.Tracer(ctx, "db")
+	x.NoError(err)
+
+	v, err := r.Tracer(ctx, "http")
+	x.NoError(err)
+	x.Eq(root, v)
+	v, err = r.Tracer(ctx, "db/pg")
+	x.NoError(err)
+	x.Eq(db, v)
+
+	_, err = r.Meter(ctx, "db")
+	x.ErrorIs(err, mkot.ErrNotExist)
+
+	// Providers that fall back share the pipeline instead of building their own.
+	x.Eq(int32(2), exporter.spans.Load())
+	x.NoError(r.Shutdown(ctx))
+}
+
+func TestResolverNoFallback(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := mkot.NewConfig()
+	c.Exporters["counting"] = &countingExporterConfig{}
+	c.Providers["tracer"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"counting"}}
+	r := mkot.Make(ctx, c)
+
+	_, err := r.Tracer(ctx, "db")
+	x.ErrorIs(err, mkot.ErrNotExist)
+}
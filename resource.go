@@ -2,8 +2,12 @@ package mkot
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/sdk/log"
 	"go.opentelemetry.io/otel/sdk/metric"
@@ -16,34 +20,240 @@ type Resource struct {
 
 	Attributes []Attr   `yaml:",omitempty"`
 	Detectors  []string `yaml:",omitempty"`
+
+	// File is the file the `file` detector reads.
+	File string `yaml:",omitempty"`
+
+	// DetectionTimeout bounds the detection as a whole. A detector that does
+	// not finish in time fails.
+	DetectionTimeout time.Duration `yaml:"detection_timeout,omitempty"`
+
+	// OnError decides what a failed detector does: "fail" (default) fails the
+	// resource, "warn" keeps the attributes detected and reports the failed
+	// detectors to the OpenTelemetry error handler, and "ignore" keeps the
+	// attributes detected silently.
+	OnError string `yaml:"on_error,omitempty"`
+}
+
+func (c *Resource) UnmarshalYAML(unmarshal func(any) error) error {
+	type plain Resource
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	_, err := c.detectors()
+	return err
 }
 
 func (c *Resource) TracerOpts(ctx context.Context) ([]trace.TracerProviderOption, error) {
-	v, err := resource.New(ctx, c.opts()...)
+	v, err := c.resource(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("create resource: %w", err)
+		return nil, err
 	}
 	return []trace.TracerProviderOption{trace.WithResource(v)}, nil
 }
 
 func (c *Resource) MeterOpts(ctx context.Context) ([]metric.Option, error) {
-	v, err := resource.New(ctx, c.opts()...)
+	v, err := c.resource(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("create resource: %w", err)
+		return nil, err
 	}
 	return []metric.Option{metric.WithResource(v)}, nil
 }
 
 func (c *Resource) LoggerOpts(ctx context.Context) ([]log.LoggerProviderOption, error) {
-	v, err := resource.New(ctx, c.opts()...)
+	v, err := c.resource(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("create resource: %w", err)
+		return nil, err
 	}
 	return []log.LoggerProviderOption{log.WithResource(v)}, nil
 }
 
-func (c *Resource) opts() []resource.Option {
-	opts := []resource.Option{}
+// resource returns the resource c describes. Built by a [Resolver], it is
+// detected once per Resolver and layered over the top-level resource, so its
+// attributes override those of the top-level one.
+func (c *Resource) resource(ctx context.Context) (*resource.Resource, error) {
+	s, ok := ctx.Value(resourcesKey{}).(*resources)
+	if !ok {
+		return c.detect(ctx)
+	}
+
+	v, err := s.get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	base, err := s.base(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// On conflicting schema URLs, the merged resource is still usable, only
+	// without a schema URL.
+	v, _ = resource.Merge(base, v)
+	return v, nil
+}
+
+// detect runs the detectors concurrently and merges what they detect in the
+// order they are listed, so a later one overrides an earlier one. It returns
+// as soon as ctx is done, with the detectors not finished by then failed.
+func (c *Resource) detect(ctx context.Context) (*resource.Resource, error) {
+	ds, err := c.detectors()
+	if err != nil {
+		return nil, err
+	}
+	if c.DetectionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.DetectionTimeout)
+		defer cancel()
+	}
+
+	type result struct {
+		v   *resource.Resource
+		err error
+	}
+	results := make([]chan result, len(ds))
+	for i, d := range ds {
+		results[i] = make(chan result, 1)
+		go func() {
+			v, err := resource.New(ctx, d.opt)
+			results[i] <- result{v, err}
+		}()
+	}
+
+	v := resource.Empty()
+	errs := []error{}
+	for i, ch := range results {
+		var r result
+		select {
+		case r = <-ch:
+		case <-ctx.Done():
+			r.err = ctx.Err()
+		}
+		if r.err != nil {
+			errs = append(errs, fmt.Errorf("detector %q: %w", ds[i].name, r.err))
+		}
+		if r.v != nil {
+			// A detector that fails may still detect some attributes.
+			v, _ = resource.Merge(v, r.v)
+		}
+	}
+
+	err = errors.Join(errs...)
+	if err == nil {
+		return v, nil
+	}
+	switch c.OnError {
+	case "warn":
+		otel.Handle(fmt.Errorf("detect resource: %w", err))
+		return v, nil
+	case "ignore":
+		return v, nil
+	default:
+		return nil, fmt.Errorf("detect resource: %w", err)
+	}
+}
+
+type resourcesKey struct{}
+
+// resources holds the resources a [Resolver] detected, so every provider, of
+// every signal, reuses them rather than running the detectors again.
+type resources struct {
+	// config is the top-level resource, or nil.
+	config *Resource
+
+	mu sync.Mutex
+	vs map[*Resource]*detection
+}
+
+type detection struct {
+	// ready is closed once the detection is done, successfully or not.
+	ready chan struct{}
+	v     *resource.Resource
+	err   error
+
+	// waiters is the number of callers waiting for the detection, which is
+	// cancelled once none is left.
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func newResources(c *Resource) *resources {
+	return &resources{
+		config: c,
+		vs:     map[*Resource]*detection{},
+	}
+}
+
+// get returns the resource c describes, detecting it on the first call. A
+// failed detection is not kept, so a later call tries again.
+//
+// Other callers may be waiting for the same detection, so it runs until every
+// caller waiting for it has its ctx done, bounded by its own timeout.
+func (s *resources) get(ctx context.Context, c *Resource) (*resource.Resource, error) {
+	s.mu.Lock()
+	d, ok := s.vs[c]
+	if !ok {
+		ctx_, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		d = &detection{ready: make(chan struct{}), cancel: cancel}
+		s.vs[c] = d
+		go func() {
+			defer close(d.ready)
+			defer cancel()
+			d.v, d.err = c.detect(ctx_)
+			if d.err != nil {
+				s.forget(c, d)
+			}
+		}()
+	}
+	d.waiters++
+	s.mu.Unlock()
+
+	select {
+	case <-d.ready:
+		s.mu.Lock()
+		d.waiters--
+		s.mu.Unlock()
+		return d.v, d.err
+	case <-ctx.Done():
+		s.mu.Lock()
+		d.waiters--
+		if d.waiters == 0 {
+			d.cancel()
+			if s.vs[c] == d {
+				delete(s.vs, c)
+			}
+		}
+		s.mu.Unlock()
+		return nil, fmt.Errorf("detect resource: %w", ctx.Err())
+	}
+}
+
+// forget drops the detection d of c, unless it is already replaced.
+func (s *resources) forget(c *Resource, d *detection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.vs[c] == d {
+		delete(s.vs, c)
+	}
+}
+
+// base returns the top-level resource, or nil if there is none.
+func (s *resources) base(ctx context.Context) (*resource.Resource, error) {
+	if s.config == nil {
+		return nil, nil
+	}
+	return s.get(ctx, s.config)
+}
+
+// detector is a resource option along with the name it is reported by.
+type detector struct {
+	name string
+	opt  resource.Option
+}
+
+// detectors returns the detectors c lists, preceded by its attributes.
+func (c *Resource) detectors() ([]detector, error) {
+	ds := []detector{}
 
 	kvs := []attribute.KeyValue{}
 	for _, a := range c.Attributes {
@@ -53,52 +263,77 @@ func (c *Resource) opts() []resource.Option {
 		})
 	}
 	if len(kvs) > 0 {
-		opts = append(opts, resource.WithAttributes(kvs...))
+		ds = append(ds, detector{"attributes", resource.WithAttributes(kvs...)})
 	}
 
-	for _, v := range c.Detectors {
+	errs := []error{}
+	switch c.OnError {
+	case "", "fail", "warn", "ignore":
+	default:
+		errs = append(errs, fmt.Errorf("on_error: unknown value %q (want fail, warn, or ignore)", c.OnError))
+	}
+	for i, v := range c.Detectors {
 		switch v {
 		case "env":
-			opts = append(opts, resource.WithFromEnv())
+			ds = append(ds, detector{v, resource.WithFromEnv()})
 
 		case "container":
-			opts = append(opts, resource.WithContainer())
+			ds = append(ds, detector{v, resource.WithContainer()})
 		case "container.id":
-			opts = append(opts, resource.WithContainerID())
+			ds = append(ds, detector{v, resource.WithContainerID()})
 		case "host":
-			opts = append(opts, resource.WithHost())
+			ds = append(ds, detector{v, resource.WithHost()})
 		case "host.id":
-			opts = append(opts, resource.WithHostID())
+			ds = append(ds, detector{v, resource.WithHostID()})
 		case "os":
-			opts = append(opts, resource.WithOS())
+			ds = append(ds, detector{v, resource.WithOS()})
 		case "os.description":
-			opts = append(opts, resource.WithOSDescription())
+			ds = append(ds, detector{v, resource.WithOSDescription()})
 		case "os.type":
-			opts = append(opts, resource.WithOSType())
+			ds = append(ds, detector{v, resource.WithOSType()})
 		case "process":
-			opts = append(opts, resource.WithProcess())
+			ds = append(ds, detector{v, resource.WithProcess()})
 		case "process.command_args":
-			opts = append(opts, resource.WithProcessCommandArgs())
+			ds = append(ds, detector{v, resource.WithProcessCommandArgs()})
 		case "process.executable.name":
-			opts = append(opts, resource.WithProcessExecutableName())
+			ds = append(ds, detector{v, resource.WithProcessExecutableName()})
 		case "process.executable.path":
-			opts = append(opts, resource.WithProcessExecutablePath())
+			ds = append(ds, detector{v, resource.WithProcessExecutablePath()})
 		case "process.owner":
-			opts = append(opts, resource.WithProcessOwner())
+			ds = append(ds, detector{v, resource.WithProcessOwner()})
 		case "process.pid":
-			opts = append(opts, resource.WithProcessPID())
+			ds = append(ds, detector{v, resource.WithProcessPID()})
 		case "process.runtime.description":
-			opts = append(opts, resource.WithProcessRuntimeDescription())
+			ds = append(ds, detector{v, resource.WithProcessRuntimeDescription()})
 		case "process.runtime.name":
-			opts = append(opts, resource.WithProcessRuntimeName())
+			ds = append(ds, detector{v, resource.WithProcessRuntimeName()})
 		case "process.runtime.version":
-			opts = append(opts, resource.WithProcessRuntimeVersion())
+			ds = append(ds, detector{v, resource.WithProcessRuntimeVersion()})
 		case "telemetry.sdk":
-			opts = append(opts, resource.WithTelemetrySDK())
+			ds = append(ds, detector{v, resource.WithTelemetrySDK()})
+
+		case "k8s":
+			ds = append(ds, detector{v, resource.WithDetectors(k8sDetector{})})
+		case "machine_id":
+			ds = append(ds, detector{v, resource.WithDetectors(machineIdDetector{})})
+		case "service.instance.id":
+			ds = append(ds, detector{v, resource.WithDetectors(serviceInstanceIdDetector{})})
+		case "file":
+			if c.File == "" {
+				errs = append(errs, fmt.Errorf("detectors[%d]: file detector needs a file", i))
+				continue
+			}
+			ds = append(ds, detector{v, resource.WithDetectors(fileDetector{c.File})})
+
+		default:
+			errs = append(errs, fmt.Errorf("detectors[%d]: unknown detector %q", i, v))
 		}
 	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
 
-	return opts
+	return ds, nil
 }
 
 func init() {
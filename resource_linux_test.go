@@ -0,0 +1,115 @@
+package mkot_test
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lesomnus/mkot"
+	"github.com/lesomnus/mkot/internal/x"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// stuckFile returns a FIFO nothing writes to, so reading it blocks until the
+// test ends.
+func stuckFile(t *testing.T) string {
+	p := filepath.Join(t.TempDir(), "fifo")
+	if err := syscall.Mkfifo(p, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// Opening for both reading and writing does not block, and closing it
+		// lets the blocked reader see the end of the file.
+		if f, err := os.OpenFile(p, os.O_RDWR, 0); err == nil {
+			f.Close()
+		}
+	})
+	return p
+}
+
+func TestResourceDetectionTimeout(t *testing.T) {
+	_, x := x.New(t)
+
+	t0 := time.Now()
+	v := detect(t, &mkot.Resource{
+		Attributes:       []mkot.Attr{{Key: "service.name", Value: attribute.StringValue("svc")}},
+		Detectors:        []string{"file"},
+		File:             stuckFile(t),
+		DetectionTimeout: 50 * time.Millisecond,
+		OnError:          "ignore",
+	})
+	x.Eq(true, v.Set().HasValue("service.name"))
+	if d := time.Since(t0); d > time.Second {
+		t.Fatalf("detection took %s", d)
+	}
+}
+
+func TestResourceDetectionCancel(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := mkot.NewConfig()
+	c.Resource = &mkot.Resource{Detectors: []string{"file"}, File: stuckFile(t)}
+	c.Exporters["memory"] = &inMemoryExporterConfig{}
+	c.Providers["tracer"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"memory"}}
+	r := mkot.Make(ctx, c)
+
+	ctx_, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err := r.Tracer(ctx_, "")
+	x.ErrorIs(err, context.DeadlineExceeded)
+}
+
+func TestResourceDetectionCancelStopsDetectors(t *testing.T) {
+	ctx, x := x.New(t)
+
+	mu := sync.Mutex{}
+	errs := []error{}
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.Contains(err.Error(), "detect resource") {
+			errs = append(errs, err)
+		}
+	}))
+	defer otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) { log.Print(err) }))
+
+	c := mkot.NewConfig()
+	c.Resource = &mkot.Resource{Detectors: []string{"file"}, File: stuckFile(t), OnError: "warn"}
+	c.Exporters["memory"] = &inMemoryExporterConfig{}
+	c.Providers["tracer"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"memory"}}
+	r := mkot.Make(ctx, c)
+
+	ctx_, cancel := context.WithCancel(ctx)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	_, err := r.Tracer(ctx_, "")
+	x.ErrorIs(err, context.Canceled)
+
+	// With no one left waiting, the detection itself is cancelled and the
+	// stuck detector reported.
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		n := len(errs)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("detection was not cancelled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	x.Contains(errs[0].Error(), `detector "file": context canceled`)
+}
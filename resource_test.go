@@ -0,0 +1,263 @@
+package mkot_test
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+	"github.com/google/uuid"
+	"github.com/lesomnus/mkot"
+	"github.com/lesomnus/mkot/internal/x"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+func TestConfigResource(t *testing.T) {
+	_, x := x.New(t)
+
+	c := mkot.NewConfig()
+	err := yaml.Unmarshal([]byte(`
+resource:
+  attributes:
+    - key: service.name
+      value: svc
+  detectors: [process.pid]
+`), c)
+	x.NoError(err)
+	x.Eq("service.name", c.Resource.Attributes[0].Key)
+	x.Eq([]string{"process.pid"}, c.Resource.Detectors)
+}
+
+func TestResolverResource(t *testing.T) {
+	ctx, x := x.New(t)
+
+	get := func(r *resource.Resource, k attribute.Key) string {
+		v, _ := r.Set().Value(k)
+		return v.Emit()
+	}
+
+	tracer := &inMemoryExporterConfig{}
+	override := &inMemoryExporterConfig{}
+	reader := &manualReaderConfig{}
+	c := mkot.NewConfig()
+	c.Resource = &mkot.Resource{
+		Attributes: []mkot.Attr{
+			{Key: "service.name", Value: attribute.StringValue("svc")},
+			{Key: "deployment.environment", Value: attribute.StringValue("prod")},
+		},
+		Detectors: []string{"process.pid"},
+	}
+	c.Processors["resource/override"] = &mkot.Resource{
+		Attributes: []mkot.Attr{{Key: "service.name", Value: attribute.StringValue("override")}},
+	}
+	c.Exporters["tracer"] = tracer
+	c.Exporters["override"] = override
+	c.Exporters["reader"] = reader
+	c.Providers["tracer"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"tracer"}}
+	c.Providers["tracer/override"] = &mkot.ProviderConfig{
+		Processors: []mkot.Id{"resource/override"},
+		Exporters:  []mkot.Id{"override"},
+	}
+	c.Providers["meter"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"reader"}}
+	x.NoError(c.Validate(ctx))
+
+	r := mkot.Make(ctx, c)
+	for _, name := range []string{"", "override"} {
+		tp, err := r.Tracer(ctx, name)
+		x.NoError(err)
+		_, span := tp.Tracer("t").Start(ctx, "s")
+		span.End()
+	}
+	mp, err := r.Meter(ctx, "")
+	x.NoError(err)
+	counter, err := mp.Meter("m").Int64Counter("c")
+	x.NoError(err)
+	counter.Add(ctx, 1)
+
+	res_tracer := tracer.exporter.GetSpans()[0].Resource
+	x.Eq("svc", get(res_tracer, "service.name"))
+	x.Eq(true, get(res_tracer, "process.pid") != "")
+
+	// The provider's own resource overrides the top-level one key by key.
+	res_override := override.exporter.GetSpans()[0].Resource
+	x.Eq("override", get(res_override, "service.name"))
+	x.Eq("prod", get(res_override, "deployment.environment"))
+
+	rm := metricdata.ResourceMetrics{}
+	x.NoError(reader.reader.Collect(ctx, &rm))
+	x.Eq(true, res_tracer.Equal(rm.Resource))
+
+	x.NoError(r.Shutdown(ctx))
+}
+
+// detect returns the resource a tracer of a resolver gets from c.
+func detect(t *testing.T, c *mkot.Resource) *resource.Resource {
+	ctx, x := x.New(t)
+
+	exporter := &inMemoryExporterConfig{}
+	conf := mkot.NewConfig()
+	conf.Resource = c
+	conf.Exporters["memory"] = exporter
+	conf.Providers["tracer"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"memory"}}
+
+	r := mkot.Make(ctx, conf)
+	defer r.Shutdown(ctx)
+
+	tp, err := r.Tracer(ctx, "")
+	x.NoError(err)
+	_, span := tp.Tracer("t").Start(ctx, "s")
+	span.End()
+	return exporter.exporter.GetSpans()[0].Resource
+}
+
+func TestResourceDetectors(t *testing.T) {
+	get := func(r *resource.Resource, k attribute.Key) string {
+		v, _ := r.Set().Value(k)
+		return v.Emit()
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		ctx, x := x.New(t)
+
+		c := mkot.NewConfig()
+		err := yaml.Unmarshal([]byte(`resource: { detectors: [host, hostt] }`), c)
+		x.Contains(err.Error(), `detectors[1]: unknown detector "hostt"`)
+
+		c = mkot.NewConfig()
+		c.Resource = &mkot.Resource{Detectors: []string{"hostt"}}
+		err = c.Validate(ctx)
+		x.Contains(err.Error(), `$.resource: detectors[0]: unknown detector "hostt"`)
+	})
+	t.Run("k8s", func(t *testing.T) {
+		_, x := x.New(t)
+
+		t.Setenv("K8S_POD_NAME", "pod")
+		t.Setenv("K8S_NAMESPACE_NAME", "ns")
+		t.Setenv("K8S_NODE_NAME", "node")
+
+		v := detect(t, &mkot.Resource{Detectors: []string{"k8s"}})
+		x.Eq("pod", get(v, "k8s.pod.name"))
+		x.Eq("ns", get(v, "k8s.namespace.name"))
+		x.Eq("node", get(v, "k8s.node.name"))
+	})
+	t.Run("service.instance.id", func(t *testing.T) {
+		_, x := x.New(t)
+
+		c := &mkot.Resource{Detectors: []string{"service.instance.id"}}
+		v := get(detect(t, c), "service.instance.id")
+		_, err := uuid.Parse(v)
+		x.NoError(err)
+
+		// Every resolver gets the same id, and so does a reload.
+		x.Eq(v, get(detect(t, c), "service.instance.id"))
+
+		ctx := t.Context()
+		exporter := &inMemoryExporterConfig{}
+		conf := mkot.NewConfig()
+		conf.Resource = c
+		conf.Exporters["memory"] = exporter
+		conf.Providers["tracer"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"memory"}}
+		r := mkot.MakeReloader(ctx, conf)
+		defer r.Shutdown(ctx)
+		x.NoError(r.Reload(ctx, conf))
+
+		tp, err := r.Tracer(ctx, "")
+		x.NoError(err)
+		_, span := tp.Tracer("t").Start(ctx, "s")
+		span.End()
+		x.Eq(v, get(exporter.exporter.GetSpans()[0].Resource, "service.instance.id"))
+	})
+	t.Run("file", func(t *testing.T) {
+		_, x := x.New(t)
+
+		p := filepath.Join(t.TempDir(), "labels")
+		err := os.WriteFile(p, []byte("# labels\napp=\"web\"\n\ntier = backend\n"), 0o644)
+		x.NoError(err)
+
+		v := detect(t, &mkot.Resource{Detectors: []string{"file"}, File: p})
+		x.Eq("web", get(v, "app"))
+		x.Eq("backend", get(v, "tier"))
+	})
+	t.Run("file without a path", func(t *testing.T) {
+		_, x := x.New(t)
+
+		c := mkot.NewConfig()
+		err := yaml.Unmarshal([]byte(`resource: { detectors: [file] }`), c)
+		x.Contains(err.Error(), "file detector needs a file")
+	})
+}
+
+func TestResourceOnError(t *testing.T) {
+	missing := func(t *testing.T) *mkot.Resource {
+		return &mkot.Resource{
+			Attributes: []mkot.Attr{{Key: "service.name", Value: attribute.StringValue("svc")}},
+			Detectors:  []string{"file", "process.pid"},
+			File:       filepath.Join(t.TempDir(), "missing"),
+		}
+	}
+	resolve := func(ctx context.Context, c *mkot.Resource) (mkot.Resolver, error) {
+		conf := mkot.NewConfig()
+		conf.Resource = c
+		conf.Exporters["memory"] = &inMemoryExporterConfig{}
+		conf.Providers["tracer"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"memory"}}
+
+		r := mkot.Make(ctx, conf)
+		_, err := r.Tracer(ctx, "")
+		return r, err
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		ctx, x := x.New(t)
+
+		_, err := resolve(ctx, missing(t))
+		x.Contains(err.Error(), `detect resource: detector "file": `)
+		x.ErrorIs(err, os.ErrNotExist)
+	})
+	t.Run("warn", func(t *testing.T) {
+		_, x := x.New(t)
+
+		// The default handler cannot be set back once replaced, and the
+		// handler set here sees the errors of other tests' goroutines too.
+		mu := sync.Mutex{}
+		errs := []error{}
+		otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if strings.Contains(err.Error(), "detect resource") {
+				errs = append(errs, err)
+			}
+		}))
+		defer otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) { log.Print(err) }))
+
+		c := missing(t)
+		c.OnError = "warn"
+		v := detect(t, c)
+		x.Eq(true, v.Set().HasValue("service.name"))
+		x.Eq(true, v.Set().HasValue("process.pid"))
+
+		x.Eq(1, len(errs))
+		x.Contains(errs[0].Error(), `detector "file"`)
+	})
+	t.Run("ignore", func(t *testing.T) {
+		_, x := x.New(t)
+
+		c := missing(t)
+		c.OnError = "ignore"
+		v := detect(t, c)
+		x.Eq(true, v.Set().HasValue("service.name"))
+	})
+	t.Run("unknown", func(t *testing.T) {
+		_, x := x.New(t)
+
+		c := mkot.NewConfig()
+		err := yaml.Unmarshal([]byte(`resource: { on_error: panic }`), c)
+		x.Contains(err.Error(), `on_error: unknown value "panic"`)
+	})
+}
@@ -2,9 +2,14 @@ package mkot
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"sync"
+	"time"
 
 	"go.opentelemetry.io/otel/sdk/trace"
+	otrace "go.opentelemetry.io/otel/trace"
 )
 
 // Sampler is a processor that installs a head sampler on the tracer provider.
@@ -14,23 +19,117 @@ type Sampler struct {
 	UnimplementedProcessorConfig `yaml:"-"`
 
 	// Type selects the sampler: "always_on" (default), "always_off",
-	// "trace_id_ratio", or "parent_based".
+	// "trace_id_ratio", "consistent_probability", "parent_based", "rules",
+	// "rate_limiting", or "jaeger_remote".
 	Type string `yaml:"type,omitempty"`
 
-	// Ratio is the sampling probability in [0,1] for "trace_id_ratio" and for
-	// the root sampler of "parent_based".
+	// Ratio is the sampling probability in [0,1] for "trace_id_ratio",
+	// "consistent_probability", and for the root sampler of "parent_based" if
+	// Root is not given.
 	Ratio float64 `yaml:"ratio,omitempty"`
+
+	// Root is the sampler of "parent_based" for the spans without a parent.
+	Root *Sampler `yaml:"root,omitempty"`
+
+	// The samplers of "parent_based" for the spans with a parent, by where
+	// the parent is and whether it is sampled. They default to following the
+	// parent's decision.
+	RemoteParentSampled    *Sampler `yaml:"remote_parent_sampled,omitempty"`
+	RemoteParentNotSampled *Sampler `yaml:"remote_parent_not_sampled,omitempty"`
+	LocalParentSampled     *Sampler `yaml:"local_parent_sampled,omitempty"`
+	LocalParentNotSampled  *Sampler `yaml:"local_parent_not_sampled,omitempty"`
+
+	// Rules of "rules" are tried in order; the first that matches a span
+	// samples it by its ratio. Fallback samples the spans no rule matches,
+	// and defaults to "always_on".
+	Rules    []SamplingRule `yaml:"rules,omitempty"`
+	Fallback *Sampler       `yaml:"fallback,omitempty"`
+
+	// TracesPerSecond is the rate "rate_limiting" samples at, with bursts of
+	// up to a second's worth. Use it as the root of "parent_based" so it
+	// counts traces rather than spans.
+	TracesPerSecond float64 `yaml:"traces_per_second,omitempty"`
+
+	// Endpoint is the Jaeger sampling endpoint "jaeger_remote" polls for the
+	// strategy of ServiceName, e.g. "http://jaeger:5778/sampling". File is a
+	// Jaeger strategies file to read it from instead, for offline use.
+	Endpoint string `yaml:"endpoint,omitempty"`
+	File     string `yaml:"file,omitempty"`
+
+	// ServiceName defaults to OTEL_SERVICE_NAME.
+	ServiceName string `yaml:"service_name,omitempty"`
+
+	// PollingInterval is how often "jaeger_remote" refreshes its strategy.
+	// Defaults to 1m. A fetch times out after it or 10s, whichever is
+	// shorter.
+	PollingInterval time.Duration `yaml:"polling_interval,omitempty"`
+
+	// InitialSampler samples until the first strategy is fetched, and
+	// defaults to "trace_id_ratio" of 0.001.
+	InitialSampler *Sampler `yaml:"initial_sampler,omitempty"`
+}
+
+// SamplingRule matches the spans whose properties match every one given, as
+// they are when the span starts, and samples them by Ratio.
+type SamplingRule struct {
+	// MatchType is how names and attribute values are compared: "strict"
+	// (default) or "regexp".
+	MatchType  string           `yaml:"match_type,omitempty"`
+	SpanNames  []string         `yaml:"span_names,omitempty"`
+	SpanKinds  []string         `yaml:"span_kinds,omitempty"`
+	Attributes []AttributeMatch `yaml:"attributes,omitempty"`
+
+	Ratio float64 `yaml:"ratio"`
 }
 
 func (c *Sampler) TracerOpts(ctx context.Context) ([]trace.TracerProviderOption, error) {
-	s, err := c.build()
+	// "jaeger_remote" polls until the provider shuts down.
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	s, err := c.build(ctx)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
-	return []trace.TracerProviderOption{trace.WithSampler(s)}, nil
+	opts := []trace.TracerProviderOption{trace.WithSampler(s)}
+	if c.polls() {
+		opts = append(opts, trace.WithSpanProcessor(samplerStopper(cancel)))
+	} else {
+		cancel()
+	}
+	return opts, nil
 }
 
-func (c *Sampler) build() (trace.Sampler, error) {
+// polls reports whether the sampler, or one it uses, polls in the background.
+func (c *Sampler) polls() bool {
+	if c == nil {
+		return false
+	}
+	return c.Type == "jaeger_remote" || slices.ContainsFunc([]*Sampler{
+		c.Root,
+		c.RemoteParentSampled,
+		c.RemoteParentNotSampled,
+		c.LocalParentSampled,
+		c.LocalParentNotSampled,
+		c.Fallback,
+		c.InitialSampler,
+	}, (*Sampler).polls)
+}
+
+// samplerStopper stops the polls of the samplers of a provider as it shuts
+// down.
+type samplerStopper context.CancelFunc
+
+func (f samplerStopper) OnStart(parent context.Context, s trace.ReadWriteSpan) {}
+func (f samplerStopper) OnEnd(s trace.ReadOnlySpan)                            {}
+func (f samplerStopper) ForceFlush(ctx context.Context) error                  { return nil }
+
+func (f samplerStopper) Shutdown(ctx context.Context) error {
+	f()
+	return nil
+}
+
+// build builds the sampler, whose polls run on ctx.
+func (c *Sampler) build(ctx context.Context) (trace.Sampler, error) {
 	switch c.Type {
 	case "", "always_on":
 		return trace.AlwaysSample(), nil
@@ -38,13 +137,170 @@ func (c *Sampler) build() (trace.Sampler, error) {
 		return trace.NeverSample(), nil
 	case "trace_id_ratio":
 		return trace.TraceIDRatioBased(c.Ratio), nil
+	case "consistent_probability":
+		// Records its threshold in the tracestate, unlike trace_id_ratio, so
+		// the adjusted count of the spans can be computed downstream.
+		return newConsistentSampler(c.Ratio)
 	case "parent_based":
-		// Respect an upstream sampling decision; fall back to the ratio at the
-		// root of a new trace.
-		return trace.ParentBased(trace.TraceIDRatioBased(c.Ratio)), nil
+		return c.buildParentBased(ctx)
+	case "rules":
+		return c.buildRules(ctx)
+	case "rate_limiting":
+		if c.TracesPerSecond <= 0 {
+			return nil, errors.New("rate_limiting: traces_per_second must be positive")
+		}
+		return newRateLimitingSampler(c.TracesPerSecond), nil
+	case "jaeger_remote":
+		return c.buildJaegerRemote(ctx)
 	default:
-		return nil, fmt.Errorf("unknown sampler type %q (want always_on, always_off, trace_id_ratio, or parent_based)", c.Type)
+		return nil, fmt.Errorf("unknown sampler type %q (want always_on, always_off, trace_id_ratio, consistent_probability, parent_based, rules, rate_limiting, or jaeger_remote)", c.Type)
+	}
+}
+
+// buildParentBased respects an upstream sampling decision unless a sampler
+// for the kind of parent is given, and falls back to the root sampler at the
+// root of a new trace.
+func (c *Sampler) buildParentBased(ctx context.Context) (trace.Sampler, error) {
+	root := trace.TraceIDRatioBased(c.Ratio)
+	if c.Root != nil {
+		v, err := c.Root.build(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("root: %w", err)
+		}
+		root = v
+	}
+
+	opts := []trace.ParentBasedSamplerOption{}
+	for _, v := range []struct {
+		name string
+		c    *Sampler
+		opt  func(trace.Sampler) trace.ParentBasedSamplerOption
+	}{
+		{"remote_parent_sampled", c.RemoteParentSampled, trace.WithRemoteParentSampled},
+		{"remote_parent_not_sampled", c.RemoteParentNotSampled, trace.WithRemoteParentNotSampled},
+		{"local_parent_sampled", c.LocalParentSampled, trace.WithLocalParentSampled},
+		{"local_parent_not_sampled", c.LocalParentNotSampled, trace.WithLocalParentNotSampled},
+	} {
+		if v.c == nil {
+			continue
+		}
+		s, err := v.c.build(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", v.name, err)
+		}
+		opts = append(opts, v.opt(s))
+	}
+	return trace.ParentBased(root, opts...), nil
+}
+
+func (c *Sampler) buildRules(ctx context.Context) (trace.Sampler, error) {
+	if len(c.Rules) == 0 {
+		return nil, errors.New("rules: at least one rule is required")
 	}
+
+	s := &rulesSampler{fallback: trace.AlwaysSample()}
+	for i, r := range c.Rules {
+		m, err := (&MatchConfig{
+			MatchType:  r.MatchType,
+			SpanNames:  r.SpanNames,
+			SpanKinds:  r.SpanKinds,
+			Attributes: r.Attributes,
+		}).compile("traces")
+		if err != nil {
+			return nil, fmt.Errorf("rules[%d]: %w", i, err)
+		}
+		if r.Ratio < 0 || r.Ratio > 1 {
+			return nil, fmt.Errorf("rules[%d]: ratio must be from 0 to 1", i)
+		}
+		s.rules = append(s.rules, samplingRule{m, trace.TraceIDRatioBased(r.Ratio)})
+	}
+	if c.Fallback != nil {
+		v, err := c.Fallback.build(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("fallback: %w", err)
+		}
+		s.fallback = v
+	}
+	return s, nil
+}
+
+type samplingRule struct {
+	m *matcher
+	s trace.Sampler
+}
+
+// rulesSampler samples a span by the first rule that matches it.
+type rulesSampler struct {
+	rules    []samplingRule
+	fallback trace.Sampler
+}
+
+func (s *rulesSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	v := matchItem{
+		span: true,
+		name: p.Name,
+		kind: p.Kind.String(),
+		attr: func(key string) (string, bool) {
+			for _, kv := range p.Attributes {
+				if string(kv.Key) == key {
+					return kv.Value.Emit(), true
+				}
+			}
+			return "", false
+		},
+	}
+	for _, r := range s.rules {
+		if r.m.match(v) {
+			return r.s.ShouldSample(p)
+		}
+	}
+	return s.fallback.ShouldSample(p)
+}
+
+func (s *rulesSampler) Description() string {
+	return fmt.Sprintf("Rules{rules:%d,fallback:%s}", len(s.rules), s.fallback.Description())
+}
+
+// rateLimitingSampler samples while a token bucket that fills at the rate has
+// a token left.
+type rateLimitingSampler struct {
+	rate float64
+
+	mu      sync.Mutex
+	balance float64
+	max     float64
+	last    time.Time
+}
+
+func newRateLimitingSampler(rate float64) *rateLimitingSampler {
+	m := max(rate, 1)
+	return &rateLimitingSampler{rate: rate, balance: m, max: m, last: time.Now()}
+}
+
+func (s *rateLimitingSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	now := time.Now()
+
+	s.mu.Lock()
+	s.balance = min(s.max, s.balance+now.Sub(s.last).Seconds()*s.rate)
+	s.last = now
+	ok := s.balance >= 1
+	if ok {
+		s.balance--
+	}
+	s.mu.Unlock()
+
+	r := trace.SamplingResult{
+		Decision:   trace.Drop,
+		Tracestate: otrace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+	if ok {
+		r.Decision = trace.RecordAndSample
+	}
+	return r
+}
+
+func (s *rateLimitingSampler) Description() string {
+	return fmt.Sprintf("RateLimiting{%g}", s.rate)
 }
 
 func init() {
@@ -1,12 +1,15 @@
 package mkot_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/goccy/go-yaml"
 	"github.com/lesomnus/mkot"
 	"github.com/lesomnus/mkot/internal/x"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/sdk/trace"
+	otrace "go.opentelemetry.io/otel/trace"
 )
 
 func TestSampler(t *testing.T) {
@@ -49,3 +52,188 @@ processors:
 	x.Eq("trace_id_ratio", s.Type)
 	x.Eq(0.1, s.Ratio)
 }
+
+func TestSamplerRules(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := mkot.NewConfig()
+	err := yaml.Unmarshal([]byte(`
+processors:
+  sampler:
+    type: parent_based
+    root:
+      type: rules
+      rules:
+        - span_names: [/checkout]
+          ratio: 1
+        - match_type: regexp
+          span_names: ["^/health"]
+          ratio: 0
+        - span_kinds: [client]
+          attributes:
+            - key: peer.service
+              value: billing
+          ratio: 1
+      fallback:
+        type: rate_limiting
+        traces_per_second: 2
+`), c)
+	x.NoError(err)
+	opts, err := c.Processors["sampler"].TracerOpts(ctx)
+	x.NoError(err)
+	tracer := trace.NewTracerProvider(opts...).Tracer("t")
+
+	sampled := func(name string, opts ...otrace.SpanStartOption) bool {
+		_, span := tracer.Start(ctx, name, opts...)
+		defer span.End()
+		return span.SpanContext().IsSampled()
+	}
+	for range 5 {
+		x.Eq(true, sampled("/checkout"))
+		x.Eq(false, sampled("/healthz"))
+		x.Eq(true, sampled("charge", otrace.WithSpanKind(otrace.SpanKindClient), otrace.WithAttributes(attribute.String("peer.service", "billing"))))
+	}
+
+	// The rest is capped at 2 traces per second.
+	x.Eq(true, sampled("/paper"))
+	x.Eq(true, sampled("/paper"))
+	x.Eq(false, sampled("/paper"))
+
+	// Children follow their root.
+	ctx, span := tracer.Start(ctx, "/checkout")
+	defer span.End()
+	_, child := tracer.Start(ctx, "/healthz")
+	defer child.End()
+	x.Eq(true, child.SpanContext().IsSampled())
+}
+
+func TestSamplerRulesInvalid(t *testing.T) {
+	ctx, x := x.New(t)
+
+	_, err := (&mkot.Sampler{Type: "rules"}).TracerOpts(ctx)
+	x.Contains(err.Error(), "rules: at least one rule is required")
+
+	_, err = (&mkot.Sampler{Type: "parent_based", Root: &mkot.Sampler{
+		Type:  "rules",
+		Rules: []mkot.SamplingRule{{SpanKinds: []string{"sideways"}}},
+	}}).TracerOpts(ctx)
+	x.Contains(err.Error(), `root: rules[0]: span_kinds[0]: unknown span kind "sideways"`)
+
+	_, err = (&mkot.Sampler{Type: "rate_limiting"}).TracerOpts(ctx)
+	x.Contains(err.Error(), "rate_limiting: traces_per_second must be positive")
+}
+
+func TestSamplerParentBased(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := mkot.NewConfig()
+	err := yaml.Unmarshal([]byte(`
+processors:
+  sampler:
+    type: parent_based
+    root:
+      type: always_off
+    remote_parent_sampled:
+      type: always_off
+    remote_parent_not_sampled:
+      type: parent_based
+      root:
+        type: always_on
+    local_parent_not_sampled:
+      type: always_on
+`), c)
+	x.NoError(err)
+	opts, err := c.Processors["sampler"].TracerOpts(ctx)
+	x.NoError(err)
+	tracer := trace.NewTracerProvider(opts...).Tracer("t")
+
+	remote := func(flags otrace.TraceFlags) context.Context {
+		return otrace.ContextWithRemoteSpanContext(ctx, otrace.NewSpanContext(otrace.SpanContextConfig{
+			TraceID:    otrace.TraceID{1},
+			SpanID:     otrace.SpanID{1},
+			TraceFlags: flags,
+			Remote:     true,
+		}))
+	}
+	sampled := func(ctx context.Context) bool {
+		_, span := tracer.Start(ctx, "s")
+		defer span.End()
+		return span.SpanContext().IsSampled()
+	}
+
+	x.Eq(false, sampled(ctx))
+	x.Eq(false, sampled(remote(otrace.FlagsSampled)))
+	// A nested parent_based sees the remote parent as well.
+	x.Eq(false, sampled(remote(0)))
+
+	ctx_, span := tracer.Start(ctx, "root")
+	defer span.End()
+	x.Eq(false, span.SpanContext().IsSampled())
+	x.Eq(true, sampled(ctx_))
+}
+
+func TestSamplerParentBasedInvalid(t *testing.T) {
+	ctx, x := x.New(t)
+
+	_, err := (&mkot.Sampler{Type: "parent_based", LocalParentSampled: &mkot.Sampler{
+		Type: "parent_based",
+		Root: &mkot.Sampler{Type: "nope"},
+	}}).TracerOpts(ctx)
+	x.Contains(err.Error(), `local_parent_sampled: root: unknown sampler type "nope"`)
+}
+
+func TestSamplerConsistentProbability(t *testing.T) {
+	ctx, x := x.New(t)
+
+	tracer := func(s *mkot.Sampler) otrace.Tracer {
+		opts, err := s.TracerOpts(ctx)
+		x.NoError(err)
+		return trace.NewTracerProvider(opts...).Tracer("t")
+	}
+	remote := func(trace_id otrace.TraceID, tracestate string) context.Context {
+		ts, err := otrace.ParseTraceState(tracestate)
+		x.NoError(err)
+		return otrace.ContextWithRemoteSpanContext(ctx, otrace.NewSpanContext(otrace.SpanContextConfig{
+			TraceID:    trace_id,
+			SpanID:     otrace.SpanID{1},
+			TraceState: ts,
+			Remote:     true,
+		}))
+	}
+
+	half := tracer(&mkot.Sampler{Type: "consistent_probability", Ratio: 0.5})
+
+	// The randomness is the last 7 bytes of the trace id.
+	_, span := half.Start(remote(otrace.TraceID{15: 1}, "vendor=v"), "s")
+	x.Eq(false, span.SpanContext().IsSampled())
+	x.Eq("vendor=v", span.SpanContext().TraceState().String())
+	_, span = half.Start(remote(otrace.TraceID{9: 0x80}, "vendor=v"), "s")
+	x.Eq(true, span.SpanContext().IsSampled())
+	x.Eq("ot=th:8,vendor=v", span.SpanContext().TraceState().String())
+
+	// rv takes precedence over the trace id, and a threshold not met is removed.
+	_, span = half.Start(remote(otrace.TraceID{9: 0x80}, "ot=th:0;rv:00000000000001"), "s")
+	x.Eq(false, span.SpanContext().IsSampled())
+	x.Eq("ot=rv:00000000000001", span.SpanContext().TraceState().String())
+	_, span = half.Start(remote(otrace.TraceID{15: 1}, "ot=rv:c0000000000000"), "s")
+	x.Eq(true, span.SpanContext().IsSampled())
+	x.Eq("ot=rv:c0000000000000;th:8", span.SpanContext().TraceState().String())
+
+	all := tracer(&mkot.Sampler{Type: "consistent_probability", Ratio: 1})
+	_, span = all.Start(ctx, "s")
+	x.Eq("ot=th:0", span.SpanContext().TraceState().String())
+
+	// Children of a parent_based sampler keep the threshold of their root.
+	based := tracer(&mkot.Sampler{Type: "parent_based", Root: &mkot.Sampler{Type: "consistent_probability", Ratio: 0.25}})
+	for range 20 {
+		ctx, root := based.Start(ctx, "root")
+		_, child := based.Start(ctx, "child")
+		x.Eq(root.SpanContext().IsSampled(), child.SpanContext().IsSampled())
+		if root.SpanContext().IsSampled() {
+			x.Eq("ot=th:c", child.SpanContext().TraceState().String())
+		}
+	}
+
+	_, err := (&mkot.Sampler{Type: "consistent_probability", Ratio: 2}).TracerOpts(ctx)
+	x.Contains(err.Error(), "consistent_probability: ratio must be from 0 to 1")
+}
@@ -0,0 +1,442 @@
+package mkot
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// StorageConfig enables the persistent queue. Each batch is written to a
+// segment file in Directory before it is exported, and the segment is removed
+// once the batch is exported. Segments left by a failed export or by a
+// previous process are replayed, oldest first. Replayed log records do not
+// report the attributes their provider dropped.
+type StorageConfig struct {
+	// Directory holds the segments, in a subdirectory per signal. Exporters
+	// of a process that use the same directory, like the ones of the
+	// pipelines a reload swaps, share its segments; processes must not share
+	// it.
+	Directory string `yaml:"directory"`
+
+	// MaxSizeMiB limits the total size of the segments. A batch that does not
+	// fit is exported without a copy on disk. Zero means no limit.
+	MaxSizeMiB int64 `yaml:"max_size_mib,omitempty"`
+}
+
+// storageReplayInterval is how often stored segments are replayed, besides
+// on ForceFlush.
+var storageReplayInterval = 5 * time.Second
+
+var errCorruptSegment = errors.New("corrupt segment")
+
+// spool is a directory of segments, one per batch, named by their sequence
+// number. A segment is a little-endian uint32 length and CRC-32 of its
+// payload followed by the payload. A segment that fails its check is renamed
+// with a ".corrupt" suffix, so it is kept for inspection but not replayed.
+type spool struct {
+	dir  string
+	max  int64
+	refs int // Guarded by spoolsMu.
+
+	// replaying serializes replays so they keep the order of the segments.
+	replaying sync.Mutex
+
+	mu       sync.Mutex
+	next     uint64
+	size     int64
+	segments map[uint64]int64 // Sizes of the segments.
+	busy     map[uint64]bool  // Segments being exported.
+}
+
+// spools are the spools open in the process by their directory. Every
+// exporter that stores to a directory shares its spool, so their segments
+// neither collide nor are replayed twice.
+var (
+	spoolsMu sync.Mutex
+	spools   = map[string]*spool{}
+)
+
+// acquireSpool returns the spool open for the directory, or opens it. The
+// size limit of the first to open it applies. The spool is released by
+// [spool.close].
+func acquireSpool(dir string, max_size int64) (*spool, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	spoolsMu.Lock()
+	defer spoolsMu.Unlock()
+	s, ok := spools[dir]
+	if !ok {
+		if s, err = openSpool(dir, max_size); err != nil {
+			return nil, err
+		}
+		spools[dir] = s
+	}
+	s.refs++
+	return s, nil
+}
+
+// close releases s, and forgets it once no one uses it.
+func (s *spool) close() {
+	spoolsMu.Lock()
+	defer spoolsMu.Unlock()
+	s.refs--
+	if s.refs == 0 {
+		delete(spools, s.dir)
+	}
+}
+
+func openSpool(dir string, max_size int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &spool{
+		dir:      dir,
+		max:      max_size,
+		next:     1,
+		segments: map[uint64]int64{},
+		busy:     map[uint64]bool{},
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			// A write the previous process did not finish.
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		seq, ok := strings.CutSuffix(name, ".wal")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(seq, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		s.segments[n] = info.Size()
+		s.size += info.Size()
+		s.next = max(s.next, n+1)
+	}
+	return s, nil
+}
+
+func (s *spool) path(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d.wal", seq))
+}
+
+// write stores a segment of the payload and returns its sequence number. The
+// segment is busy until it is released.
+func (s *spool) write(payload []byte) (uint64, error) {
+	size := int64(8 + len(payload))
+
+	s.mu.Lock()
+	if s.max > 0 && s.size+size > s.max {
+		s.mu.Unlock()
+		return 0, fmt.Errorf("storage is full")
+	}
+	seq := s.next
+	s.next++
+	s.size += size
+	s.segments[seq] = size
+	s.busy[seq] = true
+	s.mu.Unlock()
+
+	if err := s.writeFile(s.path(seq), payload); err != nil {
+		s.mu.Lock()
+		s.size -= size
+		delete(s.segments, seq)
+		delete(s.busy, seq)
+		s.mu.Unlock()
+		return 0, err
+	}
+	return seq, nil
+}
+
+// writeFile writes the segment to a temporary file first and renames it, so
+// a segment is either whole or missing.
+func (s *spool) writeFile(p string, payload []byte) error {
+	header := [8]byte{}
+	binary.LittleEndian.PutUint32(header[:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(header[4:], crc32.ChecksumIEEE(payload))
+
+	f, err := os.OpenFile(p+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(header[:], payload...))
+	if err == nil {
+		err = f.Sync()
+	}
+	if err_ := f.Close(); err == nil {
+		err = err_
+	}
+	if err == nil {
+		err = os.Rename(p+".tmp", p)
+	}
+	if err != nil {
+		os.Remove(p + ".tmp")
+	}
+	return err
+}
+
+// read returns the payload of the segment.
+func (s *spool) read(seq uint64) ([]byte, error) {
+	b, err := os.ReadFile(s.path(seq))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 8 {
+		return nil, errCorruptSegment
+	}
+	n := binary.LittleEndian.Uint32(b[:4])
+	sum := binary.LittleEndian.Uint32(b[4:8])
+	payload := b[8:]
+	if int(n) != len(payload) || crc32.ChecksumIEEE(payload) != sum {
+		return nil, errCorruptSegment
+	}
+	return payload, nil
+}
+
+// claim marks the oldest segment after the given one that is not busy as busy
+// and returns it.
+func (s *spool) claim(after uint64) (uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := false
+	seq := uint64(0)
+	for n := range s.segments {
+		if n > after && !s.busy[n] && (!found || n < seq) {
+			seq = n
+			found = true
+		}
+	}
+	if found {
+		s.busy[seq] = true
+	}
+	return seq, found
+}
+
+// release marks the segment as not busy, and removes it if it is done.
+func (s *spool) release(seq uint64, done bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.busy, seq)
+	if !done {
+		return
+	}
+	os.Remove(s.path(seq))
+	s.size -= s.segments[seq]
+	delete(s.segments, seq)
+}
+
+// quarantine sets the segment aside so it is not replayed again.
+func (s *spool) quarantine(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.busy, seq)
+	p := s.path(seq)
+	if err := os.Rename(p, p+".corrupt"); err != nil {
+		os.Remove(p)
+	}
+	s.size -= s.segments[seq]
+	delete(s.segments, seq)
+}
+
+// persistent writes each batch to a spool before it exports it, and keeps the
+// batches that fail to export to replay them later.
+type persistent[T any] struct {
+	spool  *spool
+	encode func([]T) ([]byte, error)
+	decode func([]byte) ([]T, error)
+	export func(context.Context, []T) error
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	start   sync.Once
+	done    chan struct{}
+	release sync.Once
+}
+
+func newPersistent[T any](c *StorageConfig, signal string, encode func([]T) ([]byte, error), decode func([]byte) ([]T, error), export func(context.Context, []T) error) (*persistent[T], error) {
+	if c.Directory == "" {
+		return nil, fmt.Errorf("sending_queue: storage: directory is required")
+	}
+	s, err := acquireSpool(filepath.Join(c.Directory, signal), c.MaxSizeMiB<<20)
+	if err != nil {
+		return nil, fmt.Errorf("sending_queue: storage: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &persistent[T]{
+		spool:  s,
+		encode: encode,
+		decode: decode,
+		export: export,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	return p, nil
+}
+
+// begin starts replaying in the background. It is called on start or the first
+// export, so storage that is built only to be checked, as by
+// [Config.Validate], replays nothing.
+func (p *persistent[T]) begin() {
+	p.start.Do(func() { go p.run(p.ctx) })
+}
+
+func (p *persistent[T]) Export(ctx context.Context, vs []T) error {
+	p.begin()
+	b, err := p.encode(vs)
+	seq := uint64(0)
+	if err == nil {
+		seq, err = p.spool.write(b)
+	}
+	if err != nil {
+		// The batch is exported anyway, only without a copy on disk.
+		otel.Handle(fmt.Errorf("sending_queue: storage: %w", err))
+		return p.export(ctx, vs)
+	}
+
+	err = p.export(ctx, vs)
+	p.spool.release(seq, err == nil)
+	return err
+}
+
+func (p *persistent[T]) run(ctx context.Context) {
+	defer close(p.done)
+
+	t := time.NewTicker(storageReplayInterval)
+	defer t.Stop()
+	for {
+		if err := p.replay(ctx); err != nil && ctx.Err() == nil {
+			otel.Handle(fmt.Errorf("sending_queue: storage: replay: %w", err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// replay exports the stored batches, oldest first, until one fails to.
+func (p *persistent[T]) replay(ctx context.Context) error {
+	p.spool.replaying.Lock()
+	defer p.spool.replaying.Unlock()
+
+	seq := uint64(0)
+	for {
+		var ok bool
+		seq, ok = p.spool.claim(seq)
+		if !ok {
+			return nil
+		}
+
+		b, err := p.spool.read(seq)
+		var vs []T
+		if err == nil {
+			vs, err = p.decode(b)
+		}
+		if err != nil {
+			p.spool.quarantine(seq)
+			otel.Handle(fmt.Errorf("sending_queue: storage: segment %d: %w", seq, err))
+			continue
+		}
+		if err := p.export(ctx, vs); err != nil {
+			p.spool.release(seq, false)
+			return err
+		}
+		p.spool.release(seq, true)
+	}
+}
+
+// close stops replaying and releases the spool once it stopped. The segments
+// left are replayed by the next process.
+func (p *persistent[T]) close(ctx context.Context) error {
+	p.cancel()
+	// Never started, so it is already stopped.
+	p.start.Do(func() { close(p.done) })
+	select {
+	case <-p.done:
+		p.release.Do(p.spool.close)
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-p.done
+			p.release.Do(p.spool.close)
+		}()
+		return ctx.Err()
+	}
+}
+
+// persistentMetricExporter stores each export of the exporter it wraps.
+type persistentMetricExporter struct {
+	metric.Exporter
+	p *persistent[*metricdata.ResourceMetrics]
+}
+
+func newPersistentMetricExporter(c *StorageConfig, v metric.Exporter) (*persistentMetricExporter, error) {
+	export := func(ctx context.Context, rms []*metricdata.ResourceMetrics) error {
+		errs := []error{}
+		for _, rm := range rms {
+			errs = append(errs, v.Export(ctx, rm))
+		}
+		return errors.Join(errs...)
+	}
+	p, err := newPersistent(c, "metrics", encodeResourceMetrics, decodeResourceMetrics, export)
+	if err != nil {
+		return nil, err
+	}
+	return &persistentMetricExporter{Exporter: v, p: p}, nil
+}
+
+// Start starts replaying the stored exports, before the first export.
+func (e *persistentMetricExporter) Start(ctx context.Context) error {
+	e.p.begin()
+	return startOf(ctx, e.Exporter)
+}
+
+func (e *persistentMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	return e.p.Export(ctx, []*metricdata.ResourceMetrics{rm})
+}
+
+func (e *persistentMetricExporter) ForceFlush(ctx context.Context) error {
+	if err := e.p.replay(ctx); err != nil {
+		return err
+	}
+	return e.Exporter.ForceFlush(ctx)
+}
+
+func (e *persistentMetricExporter) Shutdown(ctx context.Context) error {
+	if err := e.p.close(ctx); err != nil {
+		return err
+	}
+	return e.Exporter.Shutdown(ctx)
+}
@@ -0,0 +1,904 @@
+package mkot
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	olog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+	otrace "go.opentelemetry.io/otel/trace"
+)
+
+// The persistent queue stores batches as gob of the stored* types below,
+// which mirror the SDK types gob cannot encode for their unexported fields.
+
+func gobEncode[T any](v T) ([]byte, error) {
+	b := bytes.Buffer{}
+	if err := gob.NewEncoder(&b).Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func gobDecode[T any](b []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&v)
+	return v, err
+}
+
+type storedKeyValue struct {
+	Key   string
+	Value storedValue
+}
+
+// storedValue is an attribute value or a log value, of the kind in its own
+// package.
+type storedValue struct {
+	Kind   int
+	Bool   bool
+	Int    int64
+	Float  float64
+	String string
+	Bytes  []byte
+	Slice  []storedValue
+	Map    []storedKeyValue
+}
+
+func storeAttrs(kvs []attribute.KeyValue) []storedKeyValue {
+	vs := make([]storedKeyValue, len(kvs))
+	for i, kv := range kvs {
+		vs[i] = storedKeyValue{string(kv.Key), storeAttrValue(kv.Value)}
+	}
+	return vs
+}
+
+func loadAttrs(vs []storedKeyValue) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, len(vs))
+	for i, v := range vs {
+		kvs[i] = attribute.KeyValue{Key: attribute.Key(v.Key), Value: loadAttrValue(v.Value)}
+	}
+	return kvs
+}
+
+// loadSet keeps an empty set the zero set, as the SDK has it.
+func loadSet(vs []storedKeyValue) attribute.Set {
+	if len(vs) == 0 {
+		return attribute.Set{}
+	}
+	return attribute.NewSet(loadAttrs(vs)...)
+}
+
+func storeAttrValue(v attribute.Value) storedValue {
+	s := storedValue{Kind: int(v.Type())}
+	switch v.Type() {
+	case attribute.BOOL:
+		s.Bool = v.AsBool()
+	case attribute.INT64:
+		s.Int = v.AsInt64()
+	case attribute.FLOAT64:
+		s.Float = v.AsFloat64()
+	case attribute.STRING:
+		s.String = v.AsString()
+	case attribute.BOOLSLICE:
+		for _, v := range v.AsBoolSlice() {
+			s.Slice = append(s.Slice, storedValue{Bool: v})
+		}
+	case attribute.INT64SLICE:
+		for _, v := range v.AsInt64Slice() {
+			s.Slice = append(s.Slice, storedValue{Int: v})
+		}
+	case attribute.FLOAT64SLICE:
+		for _, v := range v.AsFloat64Slice() {
+			s.Slice = append(s.Slice, storedValue{Float: v})
+		}
+	case attribute.STRINGSLICE:
+		for _, v := range v.AsStringSlice() {
+			s.Slice = append(s.Slice, storedValue{String: v})
+		}
+	case attribute.BYTESLICE:
+		s.Bytes = v.AsByteSlice()
+	case attribute.SLICE:
+		for _, v := range v.AsSlice() {
+			s.Slice = append(s.Slice, storeAttrValue(v))
+		}
+	}
+	return s
+}
+
+func loadAttrValue(s storedValue) attribute.Value {
+	switch attribute.Type(s.Kind) {
+	case attribute.BOOL:
+		return attribute.BoolValue(s.Bool)
+	case attribute.INT64:
+		return attribute.Int64Value(s.Int)
+	case attribute.FLOAT64:
+		return attribute.Float64Value(s.Float)
+	case attribute.STRING:
+		return attribute.StringValue(s.String)
+	case attribute.BOOLSLICE:
+		vs := make([]bool, len(s.Slice))
+		for i, v := range s.Slice {
+			vs[i] = v.Bool
+		}
+		return attribute.BoolSliceValue(vs)
+	case attribute.INT64SLICE:
+		vs := make([]int64, len(s.Slice))
+		for i, v := range s.Slice {
+			vs[i] = v.Int
+		}
+		return attribute.Int64SliceValue(vs)
+	case attribute.FLOAT64SLICE:
+		vs := make([]float64, len(s.Slice))
+		for i, v := range s.Slice {
+			vs[i] = v.Float
+		}
+		return attribute.Float64SliceValue(vs)
+	case attribute.STRINGSLICE:
+		vs := make([]string, len(s.Slice))
+		for i, v := range s.Slice {
+			vs[i] = v.String
+		}
+		return attribute.StringSliceValue(vs)
+	case attribute.BYTESLICE:
+		return attribute.ByteSliceValue(s.Bytes)
+	case attribute.SLICE:
+		vs := make([]attribute.Value, len(s.Slice))
+		for i, v := range s.Slice {
+			vs[i] = loadAttrValue(v)
+		}
+		return attribute.SliceValue(vs...)
+	default:
+		return attribute.Value{}
+	}
+}
+
+func storeLogValue(v olog.Value) storedValue {
+	s := storedValue{Kind: int(v.Kind())}
+	switch v.Kind() {
+	case olog.KindBool:
+		s.Bool = v.AsBool()
+	case olog.KindInt64:
+		s.Int = v.AsInt64()
+	case olog.KindFloat64:
+		s.Float = v.AsFloat64()
+	case olog.KindString:
+		s.String = v.AsString()
+	case olog.KindBytes:
+		s.Bytes = v.AsBytes()
+	case olog.KindSlice:
+		for _, v := range v.AsSlice() {
+			s.Slice = append(s.Slice, storeLogValue(v))
+		}
+	case olog.KindMap:
+		for _, kv := range v.AsMap() {
+			s.Map = append(s.Map, storedKeyValue{kv.Key, storeLogValue(kv.Value)})
+		}
+	}
+	return s
+}
+
+func loadLogValue(s storedValue) olog.Value {
+	switch olog.Kind(s.Kind) {
+	case olog.KindBool:
+		return olog.BoolValue(s.Bool)
+	case olog.KindInt64:
+		return olog.Int64Value(s.Int)
+	case olog.KindFloat64:
+		return olog.Float64Value(s.Float)
+	case olog.KindString:
+		return olog.StringValue(s.String)
+	case olog.KindBytes:
+		return olog.BytesValue(s.Bytes)
+	case olog.KindSlice:
+		vs := make([]olog.Value, len(s.Slice))
+		for i, v := range s.Slice {
+			vs[i] = loadLogValue(v)
+		}
+		return olog.SliceValue(vs...)
+	case olog.KindMap:
+		return olog.MapValue(loadLogAttrs(s.Map)...)
+	default:
+		return olog.Value{}
+	}
+}
+
+func loadLogAttrs(vs []storedKeyValue) []olog.KeyValue {
+	kvs := make([]olog.KeyValue, len(vs))
+	for i, v := range vs {
+		kvs[i] = olog.KeyValue{Key: v.Key, Value: loadLogValue(v.Value)}
+	}
+	return kvs
+}
+
+type storedResource struct {
+	SchemaURL string
+	Attrs     []storedKeyValue
+}
+
+func storeResource(r *resource.Resource) storedResource {
+	return storedResource{r.SchemaURL(), storeAttrs(r.Attributes())}
+}
+
+func (s storedResource) load() *resource.Resource {
+	return resource.NewWithAttributes(s.SchemaURL, loadAttrs(s.Attrs)...)
+}
+
+type storedScope struct {
+	Name      string
+	Version   string
+	SchemaURL string
+	Attrs     []storedKeyValue
+}
+
+func storeScope(v instrumentation.Scope) storedScope {
+	return storedScope{v.Name, v.Version, v.SchemaURL, storeAttrs(v.Attributes.ToSlice())}
+}
+
+func (s storedScope) load() instrumentation.Scope {
+	return instrumentation.Scope{
+		Name:       s.Name,
+		Version:    s.Version,
+		SchemaURL:  s.SchemaURL,
+		Attributes: loadSet(s.Attrs),
+	}
+}
+
+type storedSpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	TraceFlags byte
+	TraceState string
+	Remote     bool
+}
+
+func storeSpanContext(v otrace.SpanContext) storedSpanContext {
+	return storedSpanContext{v.TraceID(), v.SpanID(), byte(v.TraceFlags()), v.TraceState().String(), v.IsRemote()}
+}
+
+func (s storedSpanContext) load() otrace.SpanContext {
+	// The state was valid when stored.
+	ts, _ := otrace.ParseTraceState(s.TraceState)
+	return otrace.NewSpanContext(otrace.SpanContextConfig{
+		TraceID:    s.TraceID,
+		SpanID:     s.SpanID,
+		TraceFlags: otrace.TraceFlags(s.TraceFlags),
+		TraceState: ts,
+		Remote:     s.Remote,
+	})
+}
+
+type storedSpan struct {
+	Name              string
+	SpanContext       storedSpanContext
+	Parent            storedSpanContext
+	Kind              int
+	StartTime         time.Time
+	EndTime           time.Time
+	Attrs             []storedKeyValue
+	Events            []storedEvent
+	Links             []storedLink
+	StatusCode        uint32
+	StatusDescription string
+	DroppedAttributes int
+	DroppedEvents     int
+	DroppedLinks      int
+	ChildSpanCount    int
+	Resource          storedResource
+	Scope             storedScope
+}
+
+type storedEvent struct {
+	Name              string
+	Time              time.Time
+	Attrs             []storedKeyValue
+	DroppedAttributes int
+}
+
+type storedLink struct {
+	SpanContext       storedSpanContext
+	Attrs             []storedKeyValue
+	DroppedAttributes int
+}
+
+func encodeSpans(spans []trace.ReadOnlySpan) ([]byte, error) {
+	vs := make([]storedSpan, len(spans))
+	for i, s := range spans {
+		v := storedSpan{
+			Name:              s.Name(),
+			SpanContext:       storeSpanContext(s.SpanContext()),
+			Parent:            storeSpanContext(s.Parent()),
+			Kind:              int(s.SpanKind()),
+			StartTime:         s.StartTime(),
+			EndTime:           s.EndTime(),
+			Attrs:             storeAttrs(s.Attributes()),
+			StatusCode:        uint32(s.Status().Code),
+			StatusDescription: s.Status().Description,
+			DroppedAttributes: s.DroppedAttributes(),
+			DroppedEvents:     s.DroppedEvents(),
+			DroppedLinks:      s.DroppedLinks(),
+			ChildSpanCount:    s.ChildSpanCount(),
+			Resource:          storeResource(s.Resource()),
+			Scope:             storeScope(s.InstrumentationScope()),
+		}
+		for _, e := range s.Events() {
+			v.Events = append(v.Events, storedEvent{e.Name, e.Time, storeAttrs(e.Attributes), e.DroppedAttributeCount})
+		}
+		for _, l := range s.Links() {
+			v.Links = append(v.Links, storedLink{storeSpanContext(l.SpanContext), storeAttrs(l.Attributes), l.DroppedAttributeCount})
+		}
+		vs[i] = v
+	}
+	return gobEncode(vs)
+}
+
+func decodeSpans(b []byte) ([]trace.ReadOnlySpan, error) {
+	vs, err := gobDecode[[]storedSpan](b)
+	if err != nil {
+		return nil, err
+	}
+
+	spans := make([]trace.ReadOnlySpan, len(vs))
+	for i, v := range vs {
+		s := &replayedSpan{
+			name:        v.Name,
+			spanContext: v.SpanContext.load(),
+			parent:      v.Parent.load(),
+			kind:        otrace.SpanKind(v.Kind),
+			startTime:   v.StartTime,
+			endTime:     v.EndTime,
+			attrs:       loadAttrs(v.Attrs),
+			status:      trace.Status{Code: codes.Code(v.StatusCode), Description: v.StatusDescription},
+			resource:    v.Resource.load(),
+			scope:       v.Scope.load(),
+
+			droppedAttributes: v.DroppedAttributes,
+			droppedEvents:     v.DroppedEvents,
+			droppedLinks:      v.DroppedLinks,
+			childSpanCount:    v.ChildSpanCount,
+		}
+		for _, e := range v.Events {
+			s.events = append(s.events, trace.Event{Name: e.Name, Time: e.Time, Attributes: loadAttrs(e.Attrs), DroppedAttributeCount: e.DroppedAttributes})
+		}
+		for _, l := range v.Links {
+			s.links = append(s.links, trace.Link{SpanContext: l.SpanContext.load(), Attributes: loadAttrs(l.Attrs), DroppedAttributeCount: l.DroppedAttributes})
+		}
+		spans[i] = s
+	}
+	return spans, nil
+}
+
+// replayedSpan is a span decoded from storage, with everything it had when it
+// was stored.
+type replayedSpan struct {
+	// ReadOnlySpan is embedded for the unexported method of the interface
+	// and is nil; every other method is of replayedSpan.
+	trace.ReadOnlySpan
+
+	name        string
+	spanContext otrace.SpanContext
+	parent      otrace.SpanContext
+	kind        otrace.SpanKind
+	startTime   time.Time
+	endTime     time.Time
+	attrs       []attribute.KeyValue
+	events      []trace.Event
+	links       []trace.Link
+	status      trace.Status
+	resource    *resource.Resource
+	scope       instrumentation.Scope
+
+	droppedAttributes int
+	droppedEvents     int
+	droppedLinks      int
+	childSpanCount    int
+}
+
+func (s *replayedSpan) Name() string                     { return s.name }
+func (s *replayedSpan) SpanContext() otrace.SpanContext  { return s.spanContext }
+func (s *replayedSpan) Parent() otrace.SpanContext       { return s.parent }
+func (s *replayedSpan) SpanKind() otrace.SpanKind        { return s.kind }
+func (s *replayedSpan) StartTime() time.Time             { return s.startTime }
+func (s *replayedSpan) EndTime() time.Time               { return s.endTime }
+func (s *replayedSpan) Attributes() []attribute.KeyValue { return s.attrs }
+func (s *replayedSpan) Links() []trace.Link              { return s.links }
+func (s *replayedSpan) Events() []trace.Event            { return s.events }
+func (s *replayedSpan) Status() trace.Status             { return s.status }
+func (s *replayedSpan) Resource() *resource.Resource     { return s.resource }
+func (s *replayedSpan) DroppedAttributes() int           { return s.droppedAttributes }
+func (s *replayedSpan) DroppedLinks() int                { return s.droppedLinks }
+func (s *replayedSpan) DroppedEvents() int               { return s.droppedEvents }
+func (s *replayedSpan) ChildSpanCount() int              { return s.childSpanCount }
+
+func (s *replayedSpan) InstrumentationScope() instrumentation.Scope { return s.scope }
+
+//nolint:staticcheck // Part of the interface.
+func (s *replayedSpan) InstrumentationLibrary() instrumentation.Library { return s.scope }
+
+type storedRecord struct {
+	EventName         string
+	Timestamp         time.Time
+	ObservedTimestamp time.Time
+	Severity          int
+	SeverityText      string
+	Body              storedValue
+	Attrs             []storedKeyValue
+	TraceID           [16]byte
+	SpanID            [8]byte
+	TraceFlags        byte
+	Resource          storedResource
+	Scope             storedScope
+
+	// DroppedAttributes is kept for inspection only; a [log.Record] takes no
+	// dropped count but the one of its limit, so replayed records have none.
+	DroppedAttributes int
+}
+
+func encodeRecords(records []log.Record) ([]byte, error) {
+	vs := make([]storedRecord, len(records))
+	for i, r := range records {
+		v := storedRecord{
+			EventName:         r.EventName(),
+			Timestamp:         r.Timestamp(),
+			ObservedTimestamp: r.ObservedTimestamp(),
+			Severity:          int(r.Severity()),
+			SeverityText:      r.SeverityText(),
+			Body:              storeLogValue(r.Body()),
+			TraceID:           r.TraceID(),
+			SpanID:            r.SpanID(),
+			TraceFlags:        byte(r.TraceFlags()),
+			DroppedAttributes: r.DroppedAttributes(),
+			Resource:          storeResource(r.Resource()),
+			Scope:             storeScope(r.InstrumentationScope()),
+		}
+		r.WalkAttributes(func(kv olog.KeyValue) bool {
+			v.Attrs = append(v.Attrs, storedKeyValue{kv.Key, storeLogValue(kv.Value)})
+			return true
+		})
+		vs[i] = v
+	}
+	return gobEncode(vs)
+}
+
+func decodeRecords(b []byte) ([]log.Record, error) {
+	vs, err := gobDecode[[]storedRecord](b)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]log.Record, len(vs))
+	templates := recordTemplates{}
+	for i, v := range vs {
+		r := templates.get(v.Resource.load(), v.Scope.load())
+		r.SetEventName(v.EventName)
+		r.SetTimestamp(v.Timestamp)
+		r.SetObservedTimestamp(v.ObservedTimestamp)
+		r.SetSeverity(olog.Severity(v.Severity))
+		r.SetSeverityText(v.SeverityText)
+		r.SetBody(loadLogValue(v.Body))
+		r.SetTraceID(v.TraceID)
+		r.SetSpanID(v.SpanID)
+		r.SetTraceFlags(otrace.TraceFlags(v.TraceFlags))
+
+		r.SetAttributes(loadLogAttrs(v.Attrs)...)
+		records[i] = r
+	}
+	return records, nil
+}
+
+// recordTemplates holds empty records of each resource and scope. Only a
+// LoggerProvider sets those of a record, so a template is emitted once
+// through a provider and cloned for every record decoded.
+type recordTemplates map[recordTemplateKey]log.Record
+
+type recordTemplateKey struct {
+	resource  attribute.Distinct
+	schemaUrl string
+	scope     instrumentation.Scope
+}
+
+// get returns a record of the resource and scope, which drops no attributes.
+func (ts recordTemplates) get(res *resource.Resource, scope instrumentation.Scope) log.Record {
+	k := recordTemplateKey{res.Equivalent(), res.SchemaURL(), scope}
+	if r, ok := ts[k]; ok {
+		return r.Clone()
+	}
+
+	p := &templateProcessor{}
+	lp := log.NewLoggerProvider(
+		log.WithResource(res),
+		log.WithProcessor(p),
+		log.WithAttributeCountLimit(-1),
+	)
+	lp.Logger(scope.Name,
+		olog.WithInstrumentationVersion(scope.Version),
+		olog.WithSchemaURL(scope.SchemaURL),
+		olog.WithInstrumentationAttributeSet(scope.Attributes),
+	).Emit(context.Background(), olog.Record{})
+	lp.Shutdown(context.Background())
+
+	ts[k] = p.record
+	return p.record.Clone()
+}
+
+// templateProcessor keeps the record emitted to it.
+type templateProcessor struct {
+	record log.Record
+}
+
+func (p *templateProcessor) OnEmit(ctx context.Context, r *log.Record) error {
+	p.record = r.Clone()
+	return nil
+}
+
+func (p *templateProcessor) Enabled(ctx context.Context, param log.EnabledParameters) bool {
+	return true
+}
+
+func (p *templateProcessor) Shutdown(ctx context.Context) error   { return nil }
+func (p *templateProcessor) ForceFlush(ctx context.Context) error { return nil }
+
+type storedResourceMetrics struct {
+	Resource storedResource
+	Scopes   []storedScopeMetrics
+}
+
+type storedScopeMetrics struct {
+	Scope   storedScope
+	Metrics []storedMetrics
+}
+
+type storedMetrics struct {
+	Name        string
+	Description string
+	Unit        string
+	Data        storedAggregation
+}
+
+type storedAggregation interface {
+	load() metricdata.Aggregation
+}
+
+func init() {
+	gob.Register(storedGauge[int64]{})
+	gob.Register(storedGauge[float64]{})
+	gob.Register(storedSum[int64]{})
+	gob.Register(storedSum[float64]{})
+	gob.Register(storedHistogram[int64]{})
+	gob.Register(storedHistogram[float64]{})
+	gob.Register(storedExponentialHistogram[int64]{})
+	gob.Register(storedExponentialHistogram[float64]{})
+	gob.Register(storedSummary{})
+}
+
+func storeAggregation(a metricdata.Aggregation) storedAggregation {
+	switch a := a.(type) {
+	case metricdata.Gauge[int64]:
+		return storeGauge(a)
+	case metricdata.Gauge[float64]:
+		return storeGauge(a)
+	case metricdata.Sum[int64]:
+		return storeSum(a)
+	case metricdata.Sum[float64]:
+		return storeSum(a)
+	case metricdata.Histogram[int64]:
+		return storeHistogram(a)
+	case metricdata.Histogram[float64]:
+		return storeHistogram(a)
+	case metricdata.ExponentialHistogram[int64]:
+		return storeExponentialHistogram(a)
+	case metricdata.ExponentialHistogram[float64]:
+		return storeExponentialHistogram(a)
+	case metricdata.Summary:
+		return storeSummary(a)
+	default:
+		return nil
+	}
+}
+
+type storedExemplar[N int64 | float64] struct {
+	FilteredAttrs []storedKeyValue
+	Time          time.Time
+	Value         N
+	SpanID        []byte
+	TraceID       []byte
+}
+
+func storeExemplars[N int64 | float64](es []metricdata.Exemplar[N]) []storedExemplar[N] {
+	vs := make([]storedExemplar[N], len(es))
+	for i, e := range es {
+		vs[i] = storedExemplar[N]{storeAttrs(e.FilteredAttributes), e.Time, e.Value, e.SpanID, e.TraceID}
+	}
+	return vs
+}
+
+func loadExemplars[N int64 | float64](vs []storedExemplar[N]) []metricdata.Exemplar[N] {
+	es := make([]metricdata.Exemplar[N], len(vs))
+	for i, v := range vs {
+		es[i] = metricdata.Exemplar[N]{FilteredAttributes: loadAttrs(v.FilteredAttrs), Time: v.Time, Value: v.Value, SpanID: v.SpanID, TraceID: v.TraceID}
+	}
+	return es
+}
+
+type storedExtrema[N int64 | float64] struct {
+	Value N
+	Valid bool
+}
+
+func storeExtrema[N int64 | float64](e metricdata.Extrema[N]) storedExtrema[N] {
+	v, ok := e.Value()
+	return storedExtrema[N]{v, ok}
+}
+
+func (s storedExtrema[N]) load() metricdata.Extrema[N] {
+	if !s.Valid {
+		return metricdata.Extrema[N]{}
+	}
+	return metricdata.NewExtrema(s.Value)
+}
+
+type storedDataPoint[N int64 | float64] struct {
+	Attrs     []storedKeyValue
+	StartTime time.Time
+	Time      time.Time
+	Value     N
+	Exemplars []storedExemplar[N]
+}
+
+func storeDataPoints[N int64 | float64](ps []metricdata.DataPoint[N]) []storedDataPoint[N] {
+	vs := make([]storedDataPoint[N], len(ps))
+	for i, p := range ps {
+		vs[i] = storedDataPoint[N]{storeAttrs(p.Attributes.ToSlice()), p.StartTime, p.Time, p.Value, storeExemplars(p.Exemplars)}
+	}
+	return vs
+}
+
+func loadDataPoints[N int64 | float64](vs []storedDataPoint[N]) []metricdata.DataPoint[N] {
+	ps := make([]metricdata.DataPoint[N], len(vs))
+	for i, v := range vs {
+		ps[i] = metricdata.DataPoint[N]{
+			Attributes: loadSet(v.Attrs),
+			StartTime:  v.StartTime,
+			Time:       v.Time,
+			Value:      v.Value,
+			Exemplars:  loadExemplars(v.Exemplars),
+		}
+	}
+	return ps
+}
+
+type storedGauge[N int64 | float64] struct {
+	Points []storedDataPoint[N]
+}
+
+func storeGauge[N int64 | float64](a metricdata.Gauge[N]) storedGauge[N] {
+	return storedGauge[N]{storeDataPoints(a.DataPoints)}
+}
+
+func (s storedGauge[N]) load() metricdata.Aggregation {
+	return metricdata.Gauge[N]{DataPoints: loadDataPoints(s.Points)}
+}
+
+type storedSum[N int64 | float64] struct {
+	Points      []storedDataPoint[N]
+	Temporality uint8
+	IsMonotonic bool
+}
+
+func storeSum[N int64 | float64](a metricdata.Sum[N]) storedSum[N] {
+	return storedSum[N]{storeDataPoints(a.DataPoints), uint8(a.Temporality), a.IsMonotonic}
+}
+
+func (s storedSum[N]) load() metricdata.Aggregation {
+	return metricdata.Sum[N]{
+		DataPoints:  loadDataPoints(s.Points),
+		Temporality: metricdata.Temporality(s.Temporality),
+		IsMonotonic: s.IsMonotonic,
+	}
+}
+
+type storedHistogramDataPoint[N int64 | float64] struct {
+	Attrs        []storedKeyValue
+	StartTime    time.Time
+	Time         time.Time
+	Count        uint64
+	Bounds       []float64
+	BucketCounts []uint64
+	Min          storedExtrema[N]
+	Max          storedExtrema[N]
+	Sum          N
+	Exemplars    []storedExemplar[N]
+}
+
+type storedHistogram[N int64 | float64] struct {
+	Points      []storedHistogramDataPoint[N]
+	Temporality uint8
+}
+
+func storeHistogram[N int64 | float64](a metricdata.Histogram[N]) storedHistogram[N] {
+	vs := make([]storedHistogramDataPoint[N], len(a.DataPoints))
+	for i, p := range a.DataPoints {
+		vs[i] = storedHistogramDataPoint[N]{
+			Attrs:        storeAttrs(p.Attributes.ToSlice()),
+			StartTime:    p.StartTime,
+			Time:         p.Time,
+			Count:        p.Count,
+			Bounds:       p.Bounds,
+			BucketCounts: p.BucketCounts,
+			Min:          storeExtrema(p.Min),
+			Max:          storeExtrema(p.Max),
+			Sum:          p.Sum,
+			Exemplars:    storeExemplars(p.Exemplars),
+		}
+	}
+	return storedHistogram[N]{vs, uint8(a.Temporality)}
+}
+
+func (s storedHistogram[N]) load() metricdata.Aggregation {
+	ps := make([]metricdata.HistogramDataPoint[N], len(s.Points))
+	for i, v := range s.Points {
+		ps[i] = metricdata.HistogramDataPoint[N]{
+			Attributes:   loadSet(v.Attrs),
+			StartTime:    v.StartTime,
+			Time:         v.Time,
+			Count:        v.Count,
+			Bounds:       v.Bounds,
+			BucketCounts: v.BucketCounts,
+			Min:          v.Min.load(),
+			Max:          v.Max.load(),
+			Sum:          v.Sum,
+			Exemplars:    loadExemplars(v.Exemplars),
+		}
+	}
+	return metricdata.Histogram[N]{DataPoints: ps, Temporality: metricdata.Temporality(s.Temporality)}
+}
+
+type storedExponentialHistogramDataPoint[N int64 | float64] struct {
+	Attrs          []storedKeyValue
+	StartTime      time.Time
+	Time           time.Time
+	Count          uint64
+	Min            storedExtrema[N]
+	Max            storedExtrema[N]
+	Sum            N
+	Scale          int32
+	ZeroCount      uint64
+	PositiveBucket metricdata.ExponentialBucket
+	NegativeBucket metricdata.ExponentialBucket
+	ZeroThreshold  float64
+	Exemplars      []storedExemplar[N]
+}
+
+type storedExponentialHistogram[N int64 | float64] struct {
+	Points      []storedExponentialHistogramDataPoint[N]
+	Temporality uint8
+}
+
+func storeExponentialHistogram[N int64 | float64](a metricdata.ExponentialHistogram[N]) storedExponentialHistogram[N] {
+	vs := make([]storedExponentialHistogramDataPoint[N], len(a.DataPoints))
+	for i, p := range a.DataPoints {
+		vs[i] = storedExponentialHistogramDataPoint[N]{
+			Attrs:          storeAttrs(p.Attributes.ToSlice()),
+			StartTime:      p.StartTime,
+			Time:           p.Time,
+			Count:          p.Count,
+			Min:            storeExtrema(p.Min),
+			Max:            storeExtrema(p.Max),
+			Sum:            p.Sum,
+			Scale:          p.Scale,
+			ZeroCount:      p.ZeroCount,
+			PositiveBucket: p.PositiveBucket,
+			NegativeBucket: p.NegativeBucket,
+			ZeroThreshold:  p.ZeroThreshold,
+			Exemplars:      storeExemplars(p.Exemplars),
+		}
+	}
+	return storedExponentialHistogram[N]{vs, uint8(a.Temporality)}
+}
+
+func (s storedExponentialHistogram[N]) load() metricdata.Aggregation {
+	ps := make([]metricdata.ExponentialHistogramDataPoint[N], len(s.Points))
+	for i, v := range s.Points {
+		ps[i] = metricdata.ExponentialHistogramDataPoint[N]{
+			Attributes:     loadSet(v.Attrs),
+			StartTime:      v.StartTime,
+			Time:           v.Time,
+			Count:          v.Count,
+			Min:            v.Min.load(),
+			Max:            v.Max.load(),
+			Sum:            v.Sum,
+			Scale:          v.Scale,
+			ZeroCount:      v.ZeroCount,
+			PositiveBucket: v.PositiveBucket,
+			NegativeBucket: v.NegativeBucket,
+			ZeroThreshold:  v.ZeroThreshold,
+			Exemplars:      loadExemplars(v.Exemplars),
+		}
+	}
+	return metricdata.ExponentialHistogram[N]{DataPoints: ps, Temporality: metricdata.Temporality(s.Temporality)}
+}
+
+type storedSummaryDataPoint struct {
+	Attrs          []storedKeyValue
+	StartTime      time.Time
+	Time           time.Time
+	Count          uint64
+	Sum            float64
+	QuantileValues []metricdata.QuantileValue
+}
+
+type storedSummary struct {
+	Points []storedSummaryDataPoint
+}
+
+func storeSummary(a metricdata.Summary) storedSummary {
+	vs := make([]storedSummaryDataPoint, len(a.DataPoints))
+	for i, p := range a.DataPoints {
+		vs[i] = storedSummaryDataPoint{storeAttrs(p.Attributes.ToSlice()), p.StartTime, p.Time, p.Count, p.Sum, p.QuantileValues}
+	}
+	return storedSummary{vs}
+}
+
+func (s storedSummary) load() metricdata.Aggregation {
+	ps := make([]metricdata.SummaryDataPoint, len(s.Points))
+	for i, v := range s.Points {
+		ps[i] = metricdata.SummaryDataPoint{
+			Attributes:     loadSet(v.Attrs),
+			StartTime:      v.StartTime,
+			Time:           v.Time,
+			Count:          v.Count,
+			Sum:            v.Sum,
+			QuantileValues: v.QuantileValues,
+		}
+	}
+	return metricdata.Summary{DataPoints: ps}
+}
+
+func encodeResourceMetrics(rms []*metricdata.ResourceMetrics) ([]byte, error) {
+	vs := make([]storedResourceMetrics, len(rms))
+	for i, rm := range rms {
+		v := storedResourceMetrics{Resource: storeResource(rm.Resource)}
+		for _, sm := range rm.ScopeMetrics {
+			s := storedScopeMetrics{Scope: storeScope(sm.Scope)}
+			for _, m := range sm.Metrics {
+				a := storeAggregation(m.Data)
+				if a == nil {
+					// An aggregation this version does not know of.
+					continue
+				}
+				s.Metrics = append(s.Metrics, storedMetrics{m.Name, m.Description, m.Unit, a})
+			}
+			v.Scopes = append(v.Scopes, s)
+		}
+		vs[i] = v
+	}
+	return gobEncode(vs)
+}
+
+func decodeResourceMetrics(b []byte) ([]*metricdata.ResourceMetrics, error) {
+	vs, err := gobDecode[[]storedResourceMetrics](b)
+	if err != nil {
+		return nil, err
+	}
+
+	rms := make([]*metricdata.ResourceMetrics, len(vs))
+	for i, v := range vs {
+		rm := &metricdata.ResourceMetrics{Resource: v.Resource.load()}
+		for _, s := range v.Scopes {
+			sm := metricdata.ScopeMetrics{Scope: s.Scope.load()}
+			for _, m := range s.Metrics {
+				sm.Metrics = append(sm.Metrics, metricdata.Metrics{Name: m.Name, Description: m.Description, Unit: m.Unit, Data: m.Data.load()})
+			}
+			rm.ScopeMetrics = append(rm.ScopeMetrics, sm)
+		}
+		rms[i] = rm
+	}
+	return rms, nil
+}
@@ -0,0 +1,365 @@
+package mkot_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lesomnus/mkot"
+	"github.com/lesomnus/mkot/internal/x"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	olog "go.opentelemetry.io/otel/log"
+	ometric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata/metricdatatest"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	otrace "go.opentelemetry.io/otel/trace"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+// flaky fails while down.
+type flaky struct {
+	mu   sync.Mutex
+	down bool
+}
+
+func (f *flaky) set(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+func (f *flaky) err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		return errUnavailable
+	}
+	return nil
+}
+
+type flakyLogExporter struct {
+	flaky
+	records []log.Record
+}
+
+func (e *flakyLogExporter) Export(ctx context.Context, records []log.Record) error {
+	if err := e.err(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.records = append(e.records, records...)
+	return nil
+}
+
+func (e *flakyLogExporter) Shutdown(context.Context) error   { return nil }
+func (e *flakyLogExporter) ForceFlush(context.Context) error { return nil }
+
+type flakySpanExporter struct {
+	flaky
+	*tracetest.InMemoryExporter
+}
+
+func (e *flakySpanExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	if err := e.err(); err != nil {
+		return err
+	}
+	return e.InMemoryExporter.ExportSpans(ctx, spans)
+}
+
+func TestStorageReplaysAfterRestart(t *testing.T) {
+	ctx, x := x.New(t)
+	dir := t.TempDir()
+	c := mkot.QueueConfig{Storage: &mkot.StorageConfig{Directory: dir}}
+
+	down := &flakyLogExporter{}
+	down.set(true)
+	p, err := c.BuildLogProcessor(down)
+	x.NoError(err)
+
+	r := log.Record{}
+	r.SetBody(olog.MapValue(olog.String("k", "v"), olog.Slice("s", olog.IntValue(1), olog.BoolValue(true))))
+	r.SetSeverity(olog.SeverityWarn)
+	r.SetAttributes(olog.Bytes("b", []byte{1, 2}), olog.Float64("f", 4.2))
+	x.NoError(p.OnEmit(ctx, &r))
+
+	x.ErrorIs(p.ForceFlush(ctx), errUnavailable)
+	x.NoError(p.Shutdown(ctx))
+
+	segments, err := filepath.Glob(filepath.Join(dir, "logs", "*.wal"))
+	x.NoError(err)
+	x.Eq(1, len(segments))
+
+	// The next process replays what the previous one could not export.
+	up := &flakyLogExporter{}
+	p, err = c.BuildLogProcessor(up)
+	x.NoError(err)
+	x.NoError(p.ForceFlush(ctx))
+	x.NoError(p.Shutdown(ctx))
+
+	x.Eq(1, len(up.records))
+	v := up.records[0]
+	x.Eq(true, r.Body().Equal(v.Body()))
+	x.Eq(olog.SeverityWarn, v.Severity())
+	x.Eq(2, v.AttributesLen())
+
+	segments, err = filepath.Glob(filepath.Join(dir, "logs", "*.wal"))
+	x.NoError(err)
+	x.Eq(0, len(segments))
+}
+
+func TestStorageKeepsLogRecordContext(t *testing.T) {
+	ctx, x := x.New(t)
+	c := mkot.QueueConfig{Storage: &mkot.StorageConfig{Directory: t.TempDir()}}
+
+	down := &flakyLogExporter{}
+	down.set(true)
+	p, err := c.BuildLogProcessor(down)
+	x.NoError(err)
+
+	res := resource.NewWithAttributes("https://schema", attribute.String("service.name", "svc"))
+	lp := log.NewLoggerProvider(log.WithResource(res), log.WithProcessor(p), log.WithAttributeCountLimit(1))
+	sc := otrace.NewSpanContext(otrace.SpanContextConfig{
+		TraceID:    otrace.TraceID{1},
+		SpanID:     otrace.SpanID{2},
+		TraceFlags: otrace.FlagsSampled,
+	})
+	r := olog.Record{}
+	r.SetEventName("e")
+	r.AddAttributes(olog.String("a", "1"), olog.String("b", "2"), olog.String("c", "3"))
+	lp.Logger("l", olog.WithInstrumentationVersion("v1")).Emit(otrace.ContextWithSpanContext(ctx, sc), r)
+	x.ErrorIs(p.ForceFlush(ctx), errUnavailable)
+	x.NoError(p.Shutdown(ctx))
+
+	up := &flakyLogExporter{}
+	p, err = c.BuildLogProcessor(up)
+	x.NoError(err)
+	x.NoError(p.ForceFlush(ctx))
+	x.NoError(p.Shutdown(ctx))
+
+	x.Eq(1, len(up.records))
+	v := up.records[0]
+	x.Eq(true, res.Equal(v.Resource()))
+	x.Eq("l", v.InstrumentationScope().Name)
+	x.Eq("v1", v.InstrumentationScope().Version)
+	x.Eq("e", v.EventName())
+	x.Eq(sc.TraceID(), v.TraceID())
+	x.Eq(sc.SpanID(), v.SpanID())
+	x.Eq(otrace.FlagsSampled, v.TraceFlags())
+	x.Eq(1, v.AttributesLen())
+	x.Eq(0, v.DroppedAttributes())
+}
+
+func TestStorageUnusedDoesNotReplay(t *testing.T) {
+	ctx, x := x.New(t)
+	dir := t.TempDir()
+	c := mkot.QueueConfig{Storage: &mkot.StorageConfig{Directory: dir}}
+
+	down := &flakyLogExporter{}
+	down.set(true)
+	p, err := c.BuildLogProcessor(down)
+	x.NoError(err)
+	x.NoError(p.OnEmit(ctx, &log.Record{}))
+	x.ErrorIs(p.ForceFlush(ctx), errUnavailable)
+	x.NoError(p.Shutdown(ctx))
+
+	// Built and shut down without being used, as by Validate.
+	up := &flakyLogExporter{}
+	p, err = c.BuildLogProcessor(up)
+	x.NoError(err)
+	time.Sleep(20 * time.Millisecond)
+	x.NoError(p.Shutdown(ctx))
+	x.Eq(0, len(up.records))
+
+	segments, err := filepath.Glob(filepath.Join(dir, "logs", "*.wal"))
+	x.NoError(err)
+	x.Eq(1, len(segments))
+}
+
+func TestStorageSharedDirectory(t *testing.T) {
+	ctx, x := x.New(t)
+	c := mkot.QueueConfig{Storage: &mkot.StorageConfig{Directory: t.TempDir()}}
+
+	// As the pipelines of a reload, or an exporter listed by two providers.
+	e_a := &flakyLogExporter{}
+	e_a.set(true)
+	p_a, err := c.BuildLogProcessor(e_a)
+	x.NoError(err)
+	e_b := &flakyLogExporter{}
+	e_b.set(true)
+	p_b, err := c.BuildLogProcessor(e_b)
+	x.NoError(err)
+
+	emit := func(p log.Processor, body string) {
+		r := log.Record{}
+		r.SetBody(olog.StringValue(body))
+		x.NoError(p.OnEmit(ctx, &r))
+		x.ErrorIs(p.ForceFlush(ctx), errUnavailable)
+	}
+	emit(p_a, "a")
+	emit(p_b, "b")
+
+	// Each batch is replayed once, by whichever gets to it.
+	e_a.set(false)
+	e_b.set(false)
+	x.NoError(p_a.ForceFlush(ctx))
+	x.NoError(p_b.ForceFlush(ctx))
+	x.NoError(p_a.Shutdown(ctx))
+	x.NoError(p_b.Shutdown(ctx))
+
+	bodies := []string{}
+	for _, r := range append(e_a.records, e_b.records...) {
+		bodies = append(bodies, r.Body().AsString())
+	}
+	slices.Sort(bodies)
+	x.Eq([]string{"a", "b"}, bodies)
+}
+
+func TestStorageReplaysWhenBackUp(t *testing.T) {
+	ctx, x := x.New(t)
+	e := &flakySpanExporter{InMemoryExporter: tracetest.NewInMemoryExporter()}
+	e.set(true)
+	p, err := mkot.QueueConfig{Storage: &mkot.StorageConfig{Directory: t.TempDir()}}.BuildSpanProcessor(e)
+	x.NoError(err)
+	defer p.Shutdown(ctx)
+
+	res := resource.NewSchemaless(attribute.String("service.name", "dunder"))
+	limits := trace.NewSpanLimits()
+	limits.AttributeCountLimit = 1
+	tp := trace.NewTracerProvider(trace.WithSpanProcessor(p), trace.WithResource(res), trace.WithRawSpanLimits(limits))
+	ctx, parent := tp.Tracer("t").Start(ctx, "parent")
+	_, span := tp.Tracer("t").Start(ctx, "child",
+		otrace.WithAttributes(attribute.StringSlice("ss", []string{"a", "b"})),
+		otrace.WithLinks(otrace.Link{SpanContext: parent.SpanContext(), Attributes: []attribute.KeyValue{attribute.Bool("l", true)}}),
+	)
+	span.SetAttributes(attribute.Bool("dropped", true))
+	span.AddEvent("e", otrace.WithAttributes(attribute.Int("n", 1)))
+	span.SetStatus(codes.Error, "oops")
+	span.End()
+
+	x.ErrorIs(p.ForceFlush(ctx), errUnavailable)
+	x.Eq(0, len(e.GetSpans()))
+
+	e.set(false)
+	x.NoError(p.ForceFlush(ctx))
+
+	spans := e.GetSpans()
+	x.Eq(1, len(spans))
+	v := spans[0]
+	x.Eq("child", v.Name)
+	x.Eq(span.SpanContext(), v.SpanContext)
+	x.Eq(parent.SpanContext().SpanID(), v.Parent.SpanID())
+	x.Eq([]attribute.KeyValue{attribute.StringSlice("ss", []string{"a", "b"})}, v.Attributes)
+	x.Eq(1, v.DroppedAttributes)
+	x.Eq("e", v.Events[0].Name)
+	x.Eq([]attribute.KeyValue{attribute.Int("n", 1)}, v.Events[0].Attributes)
+	x.Eq(parent.SpanContext().SpanID(), v.Links[0].SpanContext.SpanID())
+	x.Eq(trace.Status{Code: codes.Error, Description: "oops"}, v.Status)
+	x.Eq(true, res.Equal(v.Resource))
+	x.Eq("t", v.InstrumentationScope.Name)
+}
+
+func TestStorageSkipsCorruptSegments(t *testing.T) {
+	ctx, x := x.New(t)
+	dir := t.TempDir()
+	x.NoError(os.MkdirAll(filepath.Join(dir, "logs"), 0o700))
+	corrupt := filepath.Join(dir, "logs", "00000000000000000001.wal")
+	x.NoError(os.WriteFile(corrupt, []byte("not a segment"), 0o600))
+
+	e := &flakyLogExporter{}
+	p, err := mkot.QueueConfig{Storage: &mkot.StorageConfig{Directory: dir}}.BuildLogProcessor(e)
+	x.NoError(err)
+
+	r := log.Record{}
+	r.SetBody(olog.StringValue("ok"))
+	x.NoError(p.OnEmit(ctx, &r))
+	x.NoError(p.ForceFlush(ctx))
+	x.NoError(p.Shutdown(ctx))
+
+	x.Eq(1, len(e.records))
+	_, err = os.Stat(corrupt + ".corrupt")
+	x.NoError(err)
+	_, err = os.Stat(corrupt)
+	x.ErrorIs(err, os.ErrNotExist)
+}
+
+type flakyMetricExporter struct {
+	flaky
+	exported []metricdata.ResourceMetrics
+}
+
+func (e *flakyMetricExporter) Temporality(k metric.InstrumentKind) metricdata.Temporality {
+	return metric.DefaultTemporalitySelector(k)
+}
+
+func (e *flakyMetricExporter) Aggregation(k metric.InstrumentKind) metric.Aggregation {
+	return metric.DefaultAggregationSelector(k)
+}
+
+func (e *flakyMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	if err := e.err(); err != nil {
+		return err
+	}
+	e.exported = append(e.exported, *rm)
+	return nil
+}
+
+func (e *flakyMetricExporter) ForceFlush(context.Context) error { return nil }
+func (e *flakyMetricExporter) Shutdown(context.Context) error   { return nil }
+
+func TestStorageMetrics(t *testing.T) {
+	ctx, x := x.New(t)
+	e := &flakyMetricExporter{}
+	e.set(true)
+	v, err := mkot.QueueConfig{Storage: &mkot.StorageConfig{Directory: t.TempDir()}}.BuildMetricExporter(e)
+	x.NoError(err)
+
+	reader := metric.NewManualReader()
+	mp := metric.NewMeterProvider(metric.WithReader(reader))
+	m := mp.Meter("m")
+	counter, err := m.Int64Counter("c")
+	x.NoError(err)
+	counter.Add(ctx, 3, ometric.WithAttributes(attribute.String("k", "v")))
+	histogram, err := m.Float64Histogram("h")
+	x.NoError(err)
+	histogram.Record(ctx, 1.5)
+	updown, err := m.Int64UpDownCounter("u")
+	x.NoError(err)
+	updown.Add(ctx, -2)
+
+	rm := metricdata.ResourceMetrics{}
+	x.NoError(reader.Collect(ctx, &rm))
+
+	x.ErrorIs(v.Export(ctx, &rm), errUnavailable)
+	e.set(false)
+	x.NoError(v.ForceFlush(ctx))
+	x.NoError(v.Shutdown(ctx))
+
+	x.Eq(1, len(e.exported))
+	metricdatatest.AssertEqual(t, rm, e.exported[0])
+}
+
+func TestStorageRequiresQueue(t *testing.T) {
+	_, x := x.New(t)
+	disabled := false
+	c := mkot.QueueConfig{Enabled: &disabled, Storage: &mkot.StorageConfig{Directory: t.TempDir()}}
+
+	_, err := c.BuildSpanProcessor(&recordingSpanExporter{})
+	x.Contains(err.Error(), "sending_queue: storage requires the queue to be enabled")
+
+	c = mkot.QueueConfig{Storage: &mkot.StorageConfig{}}
+	_, err = c.BuildSpanProcessor(&recordingSpanExporter{})
+	x.Contains(err.Error(), "sending_queue: storage: directory is required")
+}
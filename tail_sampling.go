@@ -0,0 +1,644 @@
+package mkot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/trace"
+	otrace "go.opentelemetry.io/otel/trace"
+)
+
+// TailSampling samples whole traces after their spans end, like the
+// collector's tail sampling processor. The spans of a trace are held for
+// DecisionWait after its first span ends, then exported or dropped together:
+// a trace is sampled if any policy samples it. Spans that end after the
+// decision follow it.
+//
+// Only the spans that end in this process make up a trace. Each exporter
+// samples on its own, so policies that depend on more than the trace, such as
+// rate limiting, may decide differently for each.
+type TailSampling struct {
+	UnimplementedProcessorConfig `yaml:"-"`
+
+	// DecisionWait is how long the spans of a trace are held before it is
+	// decided. Defaults to 30s.
+	DecisionWait time.Duration `yaml:"decision_wait,omitempty"`
+
+	// NumTraces is the number of traces held. When more are waiting, the
+	// oldest is dropped undecided. Defaults to 50000.
+	NumTraces int `yaml:"num_traces,omitempty"`
+
+	Policies []TailSamplingPolicy `yaml:"policies"`
+
+	decisions struct {
+		sampled     atomic.Int64
+		not_sampled atomic.Int64
+		dropped     atomic.Int64
+	}
+}
+
+// TailSamplingPolicy decides on a trace. Type names the property that holds
+// its settings: "always_sample", "latency", "status_code", "attribute",
+// "probabilistic", "rate_limiting", "and", or "composite".
+type TailSamplingPolicy struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+
+	Latency       *LatencyPolicy       `yaml:"latency,omitempty"`
+	StatusCode    *StatusCodePolicy    `yaml:"status_code,omitempty"`
+	Attribute     *AttributePolicy     `yaml:"attribute,omitempty"`
+	Probabilistic *ProbabilisticPolicy `yaml:"probabilistic,omitempty"`
+	RateLimiting  *RateLimitingPolicy  `yaml:"rate_limiting,omitempty"`
+	And           *AndPolicy           `yaml:"and,omitempty"`
+	Composite     *CompositePolicy     `yaml:"composite,omitempty"`
+}
+
+// LatencyPolicy samples the traces that last at least Threshold, from the
+// earliest start of their spans to the latest end, and less than
+// UpperThreshold if it is given.
+type LatencyPolicy struct {
+	Threshold      time.Duration `yaml:"threshold"`
+	UpperThreshold time.Duration `yaml:"upper_threshold,omitempty"`
+}
+
+// StatusCodePolicy samples the traces with a span of one of the status codes:
+// "ERROR", "OK", or "UNSET".
+type StatusCodePolicy struct {
+	StatusCodes []string `yaml:"status_codes"`
+}
+
+// AttributePolicy samples the traces with a span that has the attribute with
+// one of the values, compared as strings, or with any value if none is given.
+type AttributePolicy struct {
+	Key    string `yaml:"key"`
+	Values []any  `yaml:"values,omitempty"`
+
+	// EnabledRegexMatching matches the values as regular expressions.
+	EnabledRegexMatching bool `yaml:"enabled_regex_matching,omitempty"`
+
+	// InvertMatch samples the traces that do not match instead.
+	InvertMatch bool `yaml:"invert_match,omitempty"`
+}
+
+// ProbabilisticPolicy samples a percentage of the traces by a hash of their
+// trace id, so every exporter and process with the same HashSalt decides
+// alike.
+type ProbabilisticPolicy struct {
+	SamplingPercentage float64 `yaml:"sampling_percentage"`
+	HashSalt           string  `yaml:"hash_salt,omitempty"`
+}
+
+// RateLimitingPolicy samples traces while their spans fit in SpansPerSecond.
+type RateLimitingPolicy struct {
+	SpansPerSecond int64 `yaml:"spans_per_second"`
+}
+
+// AndPolicy samples the traces every sub-policy samples.
+type AndPolicy struct {
+	SubPolicies []TailSamplingPolicy `yaml:"and_sub_policy"`
+}
+
+// CompositePolicy tries its sub-policies in PolicyOrder and samples a trace
+// by the first that samples it within its share of MaxTotalSpansPerSecond. A
+// sub-policy without a RateAllocation may use the whole rate.
+type CompositePolicy struct {
+	MaxTotalSpansPerSecond int64                `yaml:"max_total_spans_per_second"`
+	PolicyOrder            []string             `yaml:"policy_order,omitempty"`
+	SubPolicies            []TailSamplingPolicy `yaml:"composite_sub_policy"`
+	RateAllocation         []RateAllocation     `yaml:"rate_allocation,omitempty"`
+}
+
+type RateAllocation struct {
+	Policy  string  `yaml:"policy"`
+	Percent float64 `yaml:"percent"`
+}
+
+// TailSamplingDecisions is the number of traces a [TailSampling] decided on,
+// or dropped undecided when it held too many.
+type TailSamplingDecisions struct {
+	Sampled    int64
+	NotSampled int64
+	Dropped    int64
+}
+
+// Decisions returns the number of traces decided by every pipeline the
+// processor is in.
+func (c *TailSampling) Decisions() TailSamplingDecisions {
+	return TailSamplingDecisions{
+		Sampled:    c.decisions.sampled.Load(),
+		NotSampled: c.decisions.not_sampled.Load(),
+		Dropped:    c.decisions.dropped.Load(),
+	}
+}
+
+func (c *TailSampling) TracerOpts(ctx context.Context) ([]trace.TracerProviderOption, error) {
+	// The traces are held by WrapSpanProcessor.
+	if _, err := c.policies(); err != nil {
+		return nil, err
+	}
+	return []trace.TracerProviderOption{}, nil
+}
+
+func (c *TailSampling) WrapSpanProcessor(ctx context.Context, p trace.SpanProcessor) (trace.SpanProcessor, error) {
+	ps, err := c.policies()
+	if err != nil {
+		return nil, err
+	}
+
+	wait := c.DecisionWait
+	if wait == 0 {
+		wait = 30 * time.Second
+	}
+	num_traces := c.NumTraces
+	if num_traces == 0 {
+		num_traces = 50000
+	}
+	return newTailSampler(c, p, ps, wait, num_traces), nil
+}
+
+func (c *TailSampling) policies() ([]tailPolicy, error) {
+	if c.DecisionWait < 0 {
+		return nil, errors.New("decision_wait must not be negative")
+	}
+	if c.NumTraces < 0 {
+		return nil, errors.New("num_traces must not be negative")
+	}
+	if len(c.Policies) == 0 {
+		return nil, errors.New("policies are required")
+	}
+	ps, err := compilePolicies(c.Policies)
+	if err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+// tailTrace is the spans of a trace that ended.
+type tailTrace struct {
+	id    otrace.TraceID
+	spans []trace.ReadOnlySpan
+	at    time.Time // When the first span ended.
+}
+
+type tailPolicy interface {
+	sample(t *tailTrace) bool
+}
+
+type tailPolicyFunc func(t *tailTrace) bool
+
+func (f tailPolicyFunc) sample(t *tailTrace) bool { return f(t) }
+
+func compilePolicies(cs []TailSamplingPolicy) ([]tailPolicy, error) {
+	names := map[string]bool{}
+	ps := []tailPolicy{}
+	errs := []error{}
+	for i, c := range cs {
+		if c.Name == "" {
+			errs = append(errs, fmt.Errorf("policies[%d]: name is required", i))
+			continue
+		}
+		if names[c.Name] {
+			errs = append(errs, fmt.Errorf("policies[%d]: duplicate name %q", i, c.Name))
+			continue
+		}
+		names[c.Name] = true
+
+		p, err := c.compile()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("policies[%d] %q: %w", i, c.Name, err))
+			continue
+		}
+		ps = append(ps, p)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+func (c TailSamplingPolicy) compile() (tailPolicy, error) {
+	required := func(v bool) error {
+		if v {
+			return fmt.Errorf("%s is required", c.Type)
+		}
+		return nil
+	}
+
+	switch c.Type {
+	case "always_sample":
+		return tailPolicyFunc(func(*tailTrace) bool { return true }), nil
+
+	case "latency":
+		if err := required(c.Latency == nil); err != nil {
+			return nil, err
+		}
+		return c.Latency.compile()
+
+	case "status_code":
+		if err := required(c.StatusCode == nil); err != nil {
+			return nil, err
+		}
+		return c.StatusCode.compile()
+
+	case "attribute":
+		if err := required(c.Attribute == nil); err != nil {
+			return nil, err
+		}
+		return c.Attribute.compile()
+
+	case "probabilistic":
+		if err := required(c.Probabilistic == nil); err != nil {
+			return nil, err
+		}
+		return c.Probabilistic.compile()
+
+	case "rate_limiting":
+		if err := required(c.RateLimiting == nil); err != nil {
+			return nil, err
+		}
+		if c.RateLimiting.SpansPerSecond <= 0 {
+			return nil, errors.New("rate_limiting: spans_per_second must be positive")
+		}
+		l := &spanRateLimiter{limit: c.RateLimiting.SpansPerSecond}
+		return tailPolicyFunc(func(t *tailTrace) bool { return l.allow(len(t.spans)) }), nil
+
+	case "and":
+		if err := required(c.And == nil); err != nil {
+			return nil, err
+		}
+		if len(c.And.SubPolicies) == 0 {
+			return nil, errors.New("and: and_sub_policy is required")
+		}
+		ps, err := compilePolicies(c.And.SubPolicies)
+		if err != nil {
+			return nil, fmt.Errorf("and: %w", err)
+		}
+		return tailPolicyFunc(func(t *tailTrace) bool {
+			for _, p := range ps {
+				if !p.sample(t) {
+					return false
+				}
+			}
+			return true
+		}), nil
+
+	case "composite":
+		if err := required(c.Composite == nil); err != nil {
+			return nil, err
+		}
+		p, err := c.Composite.compile()
+		if err != nil {
+			return nil, fmt.Errorf("composite: %w", err)
+		}
+		return p, nil
+
+	default:
+		return nil, fmt.Errorf("unknown policy type %q (want always_sample, latency, status_code, attribute, probabilistic, rate_limiting, and, or composite)", c.Type)
+	}
+}
+
+func (c *LatencyPolicy) compile() (tailPolicy, error) {
+	if c.Threshold <= 0 {
+		return nil, errors.New("latency: threshold must be positive")
+	}
+	if c.UpperThreshold != 0 && c.UpperThreshold <= c.Threshold {
+		return nil, errors.New("latency: upper_threshold must be greater than threshold")
+	}
+	return tailPolicyFunc(func(t *tailTrace) bool {
+		start, end := t.spans[0].StartTime(), t.spans[0].EndTime()
+		for _, s := range t.spans[1:] {
+			if s.StartTime().Before(start) {
+				start = s.StartTime()
+			}
+			if s.EndTime().After(end) {
+				end = s.EndTime()
+			}
+		}
+		d := end.Sub(start)
+		return d >= c.Threshold && (c.UpperThreshold == 0 || d < c.UpperThreshold)
+	}), nil
+}
+
+func (c *StatusCodePolicy) compile() (tailPolicy, error) {
+	if len(c.StatusCodes) == 0 {
+		return nil, errors.New("status_code: status_codes is required")
+	}
+	codes := []string{}
+	for i, v := range c.StatusCodes {
+		v = strings.ToLower(v)
+		if !slices.Contains([]string{"unset", "ok", "error"}, v) {
+			return nil, fmt.Errorf("status_code: status_codes[%d]: unknown status %q", i, c.StatusCodes[i])
+		}
+		codes = append(codes, v)
+	}
+	return tailPolicyFunc(func(t *tailTrace) bool {
+		return slices.ContainsFunc(t.spans, func(s trace.ReadOnlySpan) bool {
+			return slices.Contains(codes, strings.ToLower(s.Status().Code.String()))
+		})
+	}), nil
+}
+
+func (c *AttributePolicy) compile() (tailPolicy, error) {
+	if c.Key == "" {
+		return nil, errors.New("attribute: key is required")
+	}
+	fs := []func(string) bool{}
+	for i, v := range c.Values {
+		s := fmt.Sprint(v)
+		if !c.EnabledRegexMatching {
+			fs = append(fs, func(v string) bool { return v == s })
+			continue
+		}
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("attribute: values[%d]: %w", i, err)
+		}
+		fs = append(fs, re.MatchString)
+	}
+
+	match := func(s trace.ReadOnlySpan) bool {
+		for _, kv := range s.Attributes() {
+			if string(kv.Key) == c.Key {
+				return len(fs) == 0 || matchAny(fs, kv.Value.Emit())
+			}
+		}
+		return false
+	}
+	return tailPolicyFunc(func(t *tailTrace) bool {
+		return slices.ContainsFunc(t.spans, match) != c.InvertMatch
+	}), nil
+}
+
+func (c *ProbabilisticPolicy) compile() (tailPolicy, error) {
+	if c.SamplingPercentage < 0 || c.SamplingPercentage > 100 {
+		return nil, errors.New("probabilistic: sampling_percentage must be from 0 to 100")
+	}
+	threshold := uint64(c.SamplingPercentage / 100 * math.MaxUint64)
+	if c.SamplingPercentage == 100 {
+		threshold = math.MaxUint64
+	}
+	return tailPolicyFunc(func(t *tailTrace) bool {
+		h := fnv.New64a()
+		h.Write([]byte(c.HashSalt))
+		h.Write(t.id[:])
+		return h.Sum64() < threshold || threshold == math.MaxUint64
+	}), nil
+}
+
+func (c *CompositePolicy) compile() (tailPolicy, error) {
+	if c.MaxTotalSpansPerSecond <= 0 {
+		return nil, errors.New("max_total_spans_per_second must be positive")
+	}
+	if len(c.SubPolicies) == 0 {
+		return nil, errors.New("composite_sub_policy is required")
+	}
+	ps, err := compilePolicies(c.SubPolicies)
+	if err != nil {
+		return nil, err
+	}
+
+	type sub struct {
+		p     tailPolicy
+		limit *spanRateLimiter
+	}
+	subs := map[string]*sub{}
+	for i, v := range c.SubPolicies {
+		subs[v.Name] = &sub{p: ps[i]}
+	}
+	total := int64(0)
+	for i, v := range c.RateAllocation {
+		s, ok := subs[v.Policy]
+		if !ok {
+			return nil, fmt.Errorf("rate_allocation[%d]: unknown policy %q", i, v.Policy)
+		}
+		if v.Percent <= 0 || v.Percent > 100 {
+			return nil, fmt.Errorf("rate_allocation[%d]: percent must be from 0 to 100", i)
+		}
+		n := int64(float64(c.MaxTotalSpansPerSecond) * v.Percent / 100)
+		total += n
+		s.limit = &spanRateLimiter{limit: n}
+	}
+	if total > c.MaxTotalSpansPerSecond {
+		return nil, errors.New("rate_allocation exceeds 100 percent")
+	}
+
+	order := c.PolicyOrder
+	if len(order) == 0 {
+		for _, v := range c.SubPolicies {
+			order = append(order, v.Name)
+		}
+	}
+	seq := []*sub{}
+	for i, name := range order {
+		s, ok := subs[name]
+		if !ok {
+			return nil, fmt.Errorf("policy_order[%d]: unknown policy %q", i, name)
+		}
+		seq = append(seq, s)
+	}
+
+	limit := &spanRateLimiter{limit: c.MaxTotalSpansPerSecond}
+	return tailPolicyFunc(func(t *tailTrace) bool {
+		for _, s := range seq {
+			if !s.p.sample(t) {
+				continue
+			}
+			if s.limit != nil && !s.limit.allow(len(t.spans)) {
+				continue
+			}
+			return limit.allow(len(t.spans))
+		}
+		return false
+	}), nil
+}
+
+// spanRateLimiter allows up to limit spans in each second.
+type spanRateLimiter struct {
+	limit int64
+
+	mu     sync.Mutex
+	second int64
+	spent  int64
+}
+
+func (l *spanRateLimiter) allow(n int) bool {
+	now := time.Now().Unix()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now != l.second {
+		l.second = now
+		l.spent = 0
+	}
+	if l.spent+int64(n) > l.limit {
+		return false
+	}
+	l.spent += int64(n)
+	return true
+}
+
+// tailSampler holds the spans of the traces waiting for a decision and
+// passes those of the sampled ones to the next processor.
+type tailSampler struct {
+	c          *TailSampling
+	next       trace.SpanProcessor
+	policies   []tailPolicy
+	wait       time.Duration
+	num_traces int
+
+	mu      sync.Mutex
+	traces  map[otrace.TraceID]*tailTrace
+	order   []otrace.TraceID        // Traces waiting, oldest first.
+	decided map[otrace.TraceID]bool // Recent decisions, for spans that end late.
+	history []otrace.TraceID        // Keys of decided, oldest first.
+	held    int64
+
+	stop     chan struct{}
+	stopping sync.Once
+	done     chan struct{}
+}
+
+func newTailSampler(c *TailSampling, next trace.SpanProcessor, ps []tailPolicy, wait time.Duration, num_traces int) *tailSampler {
+	s := &tailSampler{
+		c:          c,
+		next:       next,
+		policies:   ps,
+		wait:       wait,
+		num_traces: num_traces,
+		traces:     map[otrace.TraceID]*tailTrace{},
+		decided:    map[otrace.TraceID]bool{},
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *tailSampler) run() {
+	defer close(s.done)
+
+	t := time.NewTicker(max(s.wait/10, time.Millisecond))
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-t.C:
+			s.decide(func(v *tailTrace) bool { return now.Sub(v.at) >= s.wait })
+		}
+	}
+}
+
+func (s *tailSampler) OnStart(parent context.Context, v trace.ReadWriteSpan) {
+	s.next.OnStart(parent, v)
+}
+
+func (s *tailSampler) OnEnd(v trace.ReadOnlySpan) {
+	id := v.SpanContext().TraceID()
+
+	s.mu.Lock()
+	if sampled, ok := s.decided[id]; ok {
+		s.mu.Unlock()
+		if sampled {
+			s.next.OnEnd(v)
+		}
+		return
+	}
+
+	t, ok := s.traces[id]
+	if !ok {
+		t = &tailTrace{id: id, at: time.Now()}
+		s.traces[id] = t
+		s.order = append(s.order, id)
+	}
+	t.spans = append(t.spans, v)
+	s.held++
+
+	if len(s.order) > s.num_traces {
+		oldest := s.order[0]
+		s.order = s.order[1:]
+		s.held -= int64(len(s.traces[oldest].spans))
+		delete(s.traces, oldest)
+		s.c.decisions.dropped.Add(1)
+	}
+	s.mu.Unlock()
+}
+
+// decide decides on the traces waiting that are due, in order. A trace is
+// decided as it is removed, so a span that ends meanwhile follows the decision
+// instead of starting the trace over.
+func (s *tailSampler) decide(due func(*tailTrace) bool) {
+	s.mu.Lock()
+	ts := []*tailTrace{}
+	for len(s.order) > 0 {
+		t := s.traces[s.order[0]]
+		if !due(t) {
+			break
+		}
+		s.order = s.order[1:]
+		delete(s.traces, t.id)
+		s.held -= int64(len(t.spans))
+
+		sampled := slices.ContainsFunc(s.policies, func(p tailPolicy) bool { return p.sample(t) })
+		s.remember(t.id, sampled)
+		if !sampled {
+			s.c.decisions.not_sampled.Add(1)
+			continue
+		}
+		s.c.decisions.sampled.Add(1)
+		ts = append(ts, t)
+	}
+	s.mu.Unlock()
+
+	for _, t := range ts {
+		for _, v := range t.spans {
+			s.next.OnEnd(v)
+		}
+	}
+}
+
+// remember keeps the decision for the spans that end late. s.mu must be held.
+func (s *tailSampler) remember(id otrace.TraceID, sampled bool) {
+	s.decided[id] = sampled
+	s.history = append(s.history, id)
+	if len(s.history) > s.num_traces {
+		delete(s.decided, s.history[0])
+		s.history = s.history[1:]
+	}
+}
+
+// ForceFlush decides on every trace waiting, without waiting for the rest of
+// their spans.
+func (s *tailSampler) ForceFlush(ctx context.Context) error {
+	s.decide(func(*tailTrace) bool { return true })
+	return s.next.ForceFlush(ctx)
+}
+
+func (s *tailSampler) Shutdown(ctx context.Context) error {
+	s.stopping.Do(func() { close(s.stop) })
+	<-s.done
+	s.decide(func(*tailTrace) bool { return true })
+	return s.next.Shutdown(ctx)
+}
+
+func (s *tailSampler) Pending() int64 {
+	s.mu.Lock()
+	n := s.held
+	s.mu.Unlock()
+	return n + max(pendingOf(s.next), 0)
+}
+
+func init() {
+	DefaultProcessorRegistry.Set("tail_sampling", func() ProcessorConfig {
+		return &TailSampling{}
+	})
+}
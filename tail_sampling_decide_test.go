@@ -0,0 +1,47 @@
+package mkot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lesomnus/mkot/internal/x"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	otrace "go.opentelemetry.io/otel/trace"
+)
+
+func TestTailSamplingSpanEndsWhileDeciding(t *testing.T) {
+	ctx, x := x.New(t)
+
+	sc := otrace.NewSpanContext(otrace.SpanContextConfig{TraceID: otrace.TraceID{1}, SpanID: otrace.SpanID{1}, TraceFlags: otrace.FlagsSampled})
+	root := tracetest.SpanStub{Name: "root", SpanContext: sc}.Snapshot()
+	late := tracetest.SpanStub{Name: "late", SpanContext: sc.WithSpanID(otrace.SpanID{2})}.Snapshot()
+
+	// The late span ends while the policy decides, and waits for the
+	// decision if it is taken in the same critical section.
+	var s *tailSampler
+	ended := make(chan struct{})
+	policy := tailPolicyFunc(func(*tailTrace) bool {
+		go func() {
+			s.OnEnd(late)
+			close(ended)
+		}()
+		select {
+		case <-ended:
+		case <-time.After(20 * time.Millisecond):
+		}
+		return true
+	})
+
+	e := tracetest.NewInMemoryExporter()
+	c := &TailSampling{}
+	s = newTailSampler(c, trace.NewSimpleSpanProcessor(e), []tailPolicy{policy}, time.Hour, 10)
+	s.OnEnd(root)
+	x.NoError(s.ForceFlush(ctx))
+	<-ended
+
+	x.Eq(int64(0), s.Pending())
+	x.Eq(2, len(e.GetSpans()))
+	x.Eq(TailSamplingDecisions{Sampled: 1}, c.Decisions())
+	x.NoError(s.Shutdown(ctx))
+}
@@ -0,0 +1,212 @@
+package mkot_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lesomnus/mkot"
+	"github.com/lesomnus/mkot/internal/x"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	otrace "go.opentelemetry.io/otel/trace"
+)
+
+func TestTailSampling(t *testing.T) {
+	ctx, x := x.New(t)
+
+	e := &componentExporterConfig{}
+	c := mkot.NewConfig()
+	err := yaml.Unmarshal([]byte(`
+processors:
+  tail_sampling:
+    decision_wait: 1h
+    policies:
+      - name: errors
+        type: status_code
+        status_code:
+          status_codes: [ERROR]
+      - name: slow
+        type: latency
+        latency:
+          threshold: 1s
+      - name: debug
+        type: and
+        and:
+          and_sub_policy:
+            - name: flagged
+              type: attribute
+              attribute:
+                key: debug
+                values: [true]
+            - name: all
+              type: probabilistic
+              probabilistic:
+                sampling_percentage: 100
+`), c)
+	x.NoError(err)
+	c.Exporters["e"] = e
+	c.Providers = map[mkot.Id]*mkot.ProviderConfig{
+		"tracer": {Processors: []mkot.Id{"tail_sampling"}, Exporters: []mkot.Id{"e"}},
+	}
+	x.NoError(c.Validate(ctx))
+
+	r := mkot.Make(ctx, c)
+	tp, err := r.Tracer(ctx, "")
+	x.NoError(err)
+	tracer := tp.Tracer("t")
+
+	// The root of a failing trace ends fine.
+	ctx_a, root := tracer.Start(ctx, "failing")
+	_, child := tracer.Start(ctx_a, "child")
+	child.SetStatus(codes.Error, "oops")
+	child.End()
+	root.End()
+
+	now := time.Now()
+	_, span := tracer.Start(ctx, "slow", otrace.WithTimestamp(now.Add(-2*time.Second)))
+	span.End(otrace.WithTimestamp(now))
+
+	_, span = tracer.Start(ctx, "flagged", otrace.WithAttributes(attribute.Bool("debug", true)))
+	span.End()
+
+	ctx_b, late := tracer.Start(ctx, "fine")
+	_, span = tracer.Start(ctx_b, "fine child")
+	span.End()
+
+	// Held until decided.
+	x.Eq(0, len(e.spans.GetSpans()))
+
+	x.NoError(r.ForceFlush(ctx))
+	names := []string{}
+	for _, s := range e.spans.GetSpans() {
+		names = append(names, s.Name)
+	}
+	x.Eq([]string{"child", "failing", "slow", "flagged"}, names)
+
+	f := c.Processors["tail_sampling"].(*mkot.TailSampling)
+	x.Eq(mkot.TailSamplingDecisions{Sampled: 3, NotSampled: 1}, f.Decisions())
+
+	// A span that ends after the decision follows it.
+	late.SetStatus(codes.Error, "late")
+	late.End()
+	x.NoError(r.ForceFlush(ctx))
+	x.Eq(4, len(e.spans.GetSpans()))
+	x.NoError(r.Shutdown(ctx))
+}
+
+func TestTailSamplingDecisionWait(t *testing.T) {
+	ctx, x := x.New(t)
+
+	e := &componentExporterConfig{}
+	c := mkot.NewConfig()
+	c.Processors["tail_sampling"] = &mkot.TailSampling{
+		DecisionWait: 20 * time.Millisecond,
+		Policies:     []mkot.TailSamplingPolicy{{Name: "all", Type: "always_sample"}},
+	}
+	c.Exporters["e"] = e
+	c.Providers["tracer"] = &mkot.ProviderConfig{Processors: []mkot.Id{"tail_sampling"}, Exporters: []mkot.Id{"e"}}
+
+	r := mkot.Make(ctx, c)
+	tp, err := r.Tracer(ctx, "")
+	x.NoError(err)
+	_, span := tp.Tracer("t").Start(ctx, "s")
+	span.End()
+	x.Eq(0, len(e.spans.GetSpans()))
+
+	for i := 0; i < 100 && len(e.spans.GetSpans()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	x.Eq(1, len(e.spans.GetSpans()))
+	x.NoError(r.Shutdown(ctx))
+}
+
+func TestTailSamplingNumTraces(t *testing.T) {
+	ctx, x := x.New(t)
+
+	e := &componentExporterConfig{}
+	c := mkot.NewConfig()
+	c.Processors["tail_sampling"] = &mkot.TailSampling{
+		DecisionWait: time.Hour,
+		NumTraces:    2,
+		Policies:     []mkot.TailSamplingPolicy{{Name: "all", Type: "always_sample"}},
+	}
+	c.Exporters["e"] = e
+	c.Providers["tracer"] = &mkot.ProviderConfig{Processors: []mkot.Id{"tail_sampling"}, Exporters: []mkot.Id{"e"}}
+
+	r := mkot.Make(ctx, c)
+	tp, err := r.Tracer(ctx, "")
+	x.NoError(err)
+	for _, name := range []string{"a", "b", "c"} {
+		_, span := tp.Tracer("t").Start(ctx, name)
+		span.End()
+	}
+
+	x.NoError(r.ForceFlush(ctx))
+	spans := e.spans.GetSpans()
+	x.Eq(2, len(spans))
+	x.Eq("b", spans[0].Name)
+
+	f := c.Processors["tail_sampling"].(*mkot.TailSampling)
+	x.Eq(mkot.TailSamplingDecisions{Sampled: 2, Dropped: 1}, f.Decisions())
+	x.NoError(r.Shutdown(ctx))
+}
+
+func TestTailSamplingShutdownTwice(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := &mkot.TailSampling{Policies: []mkot.TailSamplingPolicy{{Name: "all", Type: "always_sample"}}}
+	p, err := c.WrapSpanProcessor(ctx, trace.NewSimpleSpanProcessor(tracetest.NewInMemoryExporter()))
+	x.NoError(err)
+
+	wg := sync.WaitGroup{}
+	for range 2 {
+		wg.Go(func() { p.Shutdown(ctx) })
+	}
+	wg.Wait()
+	p.Shutdown(ctx)
+}
+
+func TestTailSamplingInvalid(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := mkot.NewConfig()
+	err := yaml.Unmarshal([]byte(`
+processors:
+  tail_sampling:
+    policies:
+      - name: slow
+        type: latency
+      - name: slow
+        type: always_sample
+      - name: odd
+        type: coin_flip
+      - name: mixed
+        type: composite
+        composite:
+          max_total_spans_per_second: 100
+          policy_order: [errors, rest]
+          composite_sub_policy:
+            - name: errors
+              type: status_code
+              status_code:
+                status_codes: [ERROR]
+          rate_allocation:
+            - policy: errors
+              percent: 50
+`), c)
+	x.NoError(err)
+	c.Exporters["e"] = &componentExporterConfig{}
+	c.Providers = map[mkot.Id]*mkot.ProviderConfig{
+		"tracer": {Processors: []mkot.Id{"tail_sampling"}, Exporters: []mkot.Id{"e"}},
+	}
+
+	err = c.Validate(ctx)
+	x.Contains(err.Error(), `policies[0] "slow": latency is required`)
+	x.Contains(err.Error(), `policies[1]: duplicate name "slow"`)
+	x.Contains(err.Error(), `policies[2] "odd": unknown policy type "coin_flip"`)
+	x.Contains(err.Error(), `policies[3] "mixed": composite: policy_order[1]: unknown policy "rest"`)
+}
@@ -0,0 +1,173 @@
+package mkot
+
+import (
+	"context"
+	"encoding/binary"
+	"math/rand/v2"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+// idGenerator generates random ids as the SDK does, except for the ids a
+// [multiTracer] pins in the context, so every pipeline it fans out to records
+// a span under the same ids.
+type idGenerator struct{}
+
+type pinnedIdsKey struct{}
+
+type pinnedIds struct {
+	trace trace.TraceID
+	span  trace.SpanID
+}
+
+func (idGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	if v, ok := ctx.Value(pinnedIdsKey{}).(pinnedIds); ok {
+		return v.trace, v.span
+	}
+
+	tid := trace.TraceID{}
+	for {
+		binary.NativeEndian.PutUint64(tid[:8], rand.Uint64())
+		binary.NativeEndian.PutUint64(tid[8:], rand.Uint64())
+		if tid.IsValid() {
+			break
+		}
+	}
+	return tid, idGenerator{}.NewSpanID(ctx, tid)
+}
+
+func (idGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	if v, ok := ctx.Value(pinnedIdsKey{}).(pinnedIds); ok && v.trace == traceID {
+		return v.span
+	}
+
+	sid := trace.SpanID{}
+	for {
+		binary.NativeEndian.PutUint64(sid[:], rand.Uint64())
+		if sid.IsValid() {
+			break
+		}
+	}
+	return sid
+}
+
+// multiTracerProvider mirrors [multiLoggerProvider] for tracers. A span is
+// started in every provider under the ids of the one started in the first,
+// and a child span is started under its parent in the same provider, so each
+// pipeline records the same trace while sampling it on its own.
+type multiTracerProvider struct {
+	embedded.TracerProvider
+	providers []trace.TracerProvider
+}
+
+func (m *multiTracerProvider) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	tracers := make([]trace.Tracer, len(m.providers))
+	for i, p := range m.providers {
+		tracers[i] = p.Tracer(name, opts...)
+	}
+	return &multiTracer{provider: m, tracers: tracers}
+}
+
+type multiTracer struct {
+	embedded.Tracer
+	provider *multiTracerProvider
+	tracers  []trace.Tracer
+}
+
+func (t *multiTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	parent, ok := trace.SpanFromContext(ctx).(*multiSpan)
+	if ok && parent.provider != t.provider {
+		parent = nil
+	}
+
+	spans := make([]trace.Span, len(t.tracers))
+	for i, tracer := range t.tracers {
+		ctx := ctx
+		if parent != nil {
+			ctx = trace.ContextWithSpan(ctx, parent.spans[i])
+		}
+		if i > 0 {
+			sc := spans[0].SpanContext()
+			ctx = context.WithValue(ctx, pinnedIdsKey{}, pinnedIds{sc.TraceID(), sc.SpanID()})
+		}
+		_, spans[i] = tracer.Start(ctx, name, opts...)
+	}
+
+	s := &multiSpan{provider: t.provider, spans: spans}
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+type multiSpan struct {
+	embedded.Span
+	provider *multiTracerProvider
+	spans    []trace.Span
+}
+
+func (s *multiSpan) End(options ...trace.SpanEndOption) {
+	for _, v := range s.spans {
+		v.End(options...)
+	}
+}
+
+func (s *multiSpan) AddEvent(name string, options ...trace.EventOption) {
+	for _, v := range s.spans {
+		v.AddEvent(name, options...)
+	}
+}
+
+func (s *multiSpan) AddLink(link trace.Link) {
+	for _, v := range s.spans {
+		v.AddLink(link)
+	}
+}
+
+func (s *multiSpan) IsRecording() bool {
+	for _, v := range s.spans {
+		if v.IsRecording() {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *multiSpan) RecordError(err error, options ...trace.EventOption) {
+	for _, v := range s.spans {
+		v.RecordError(err, options...)
+	}
+}
+
+// SpanContext returns the span context of the first span sampled, so the
+// span is propagated as sampled if any pipeline samples it.
+func (s *multiSpan) SpanContext() trace.SpanContext {
+	for _, v := range s.spans {
+		if sc := v.SpanContext(); sc.IsSampled() {
+			return sc
+		}
+	}
+	return s.spans[0].SpanContext()
+}
+
+func (s *multiSpan) SetStatus(code codes.Code, description string) {
+	for _, v := range s.spans {
+		v.SetStatus(code, description)
+	}
+}
+
+func (s *multiSpan) SetName(name string) {
+	for _, v := range s.spans {
+		v.SetName(name)
+	}
+}
+
+func (s *multiSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, v := range s.spans {
+		v.SetAttributes(kv...)
+	}
+}
+
+func (s *multiSpan) TracerProvider() trace.TracerProvider {
+	return s.provider
+}
@@ -0,0 +1,84 @@
+package mkot_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lesomnus/mkot"
+	"github.com/lesomnus/mkot/internal/x"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type inMemoryExporterConfig struct {
+	mkot.UnimplementedExporterConfig `yaml:"-"`
+
+	exporter *tracetest.InMemoryExporter
+}
+
+func (c *inMemoryExporterConfig) SpanExporter(ctx context.Context) (trace.SpanExporter, []trace.TracerProviderOption, error) {
+	c.exporter = tracetest.NewInMemoryExporter()
+	return c.exporter, []trace.TracerProviderOption{trace.WithSyncer(c.exporter)}, nil
+}
+
+func TestResolverIncludeTracer(t *testing.T) {
+	ctx, x := x.New(t)
+
+	a := &inMemoryExporterConfig{}
+	b := &inMemoryExporterConfig{}
+	off := &inMemoryExporterConfig{}
+	c := mkot.NewConfig()
+	c.Processors["sampler/off"] = &mkot.Sampler{Type: "always_off"}
+	c.Exporters["a"] = a
+	c.Exporters["b"] = b
+	c.Exporters["off"] = off
+	c.Providers["tracer/a"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"a"}}
+	c.Providers["tracer/b"] = &mkot.ProviderConfig{Exporters: []mkot.Id{"b"}}
+	c.Providers["tracer/off"] = &mkot.ProviderConfig{
+		Processors: []mkot.Id{"sampler/off"},
+		Exporters:  []mkot.Id{"off"},
+	}
+	c.Providers["tracer/audit"] = &mkot.ProviderConfig{
+		Include: []mkot.Id{"tracer/off", "tracer/a", "tracer/b"},
+	}
+	x.NoError(c.Validate(ctx))
+
+	r := mkot.Make(ctx, c)
+	tp, err := r.Tracer(ctx, "audit")
+	x.NoError(err)
+
+	ctx_, root := tp.Tracer("t").Start(ctx, "root")
+	_, child := tp.Tracer("t").Start(ctx_, "child")
+	child.End()
+	root.End()
+
+	// Sampled by a pipeline, so propagated as sampled.
+	x.Eq(true, root.SpanContext().IsSampled())
+
+	for _, e := range []*tracetest.InMemoryExporter{a.exporter, b.exporter} {
+		spans := e.GetSpans()
+		x.Eq(2, len(spans))
+		x.Eq("child", spans[0].Name)
+		x.Eq(root.SpanContext().TraceID(), spans[0].SpanContext.TraceID())
+		x.Eq(child.SpanContext().SpanID(), spans[0].SpanContext.SpanID())
+		x.Eq(root.SpanContext().SpanID(), spans[0].Parent.SpanID())
+		x.Eq(root.SpanContext().SpanID(), spans[1].SpanContext.SpanID())
+	}
+	x.Eq(0, len(off.exporter.GetSpans()))
+	x.NoError(r.Shutdown(ctx))
+}
+
+func TestResolverIncludeCycle(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := mkot.NewConfig()
+	c.Providers["tracer/a"] = &mkot.ProviderConfig{Include: []mkot.Id{"tracer/b"}}
+	c.Providers["tracer/b"] = &mkot.ProviderConfig{Include: []mkot.Id{"tracer/a"}}
+
+	err := c.Validate(ctx)
+	x.Contains(err.Error(), `$.providers.tracer/a.include: include cycle: tracer/a -> tracer/b -> tracer/a`)
+
+	r := mkot.Make(ctx, c)
+	_, err = r.Tracer(ctx, "a")
+	x.Contains(err.Error(), "include cycle")
+}
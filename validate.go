@@ -0,0 +1,194 @@
+package mkot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Validate checks the pipeline graph the providers describe and reports every
+// problem found, each prefixed with its YAML path:
+//   - a provider id whose type is not tracer, meter, or logger;
+//   - a processor or exporter id a provider lists but the config does not define;
+//   - a processor that cannot serve the signal of the provider it is listed in;
+//   - an exporter that does not implement the signal of the provider it is listed in;
+//   - an exporter whose processor cannot be wrapped by the processors listed;
+//   - an exporter with sending queue storage under a batch processor;
+//   - a provider that includes an undefined provider, a provider of another
+//     type, or itself, or that also lists processors or exporters;
+//   - a processor or exporter no provider uses;
+//   - a propagator [Propagators] does not know.
+//
+// Processors and exporters are built to be checked, so Validate reports the
+// same errors the [Resolver] would; the exporters built are shut down before
+// it returns.
+func (c *Config) Validate(ctx context.Context) error {
+	if !c.IsEnabled() {
+		return nil
+	}
+
+	errs := []error{}
+	used_processors := map[Id]bool{}
+	used_exporters := map[Id]bool{}
+	for _, pid := range slices.Sorted(maps.Keys(c.Providers)) {
+		p := c.Providers[pid]
+		path := func() *yaml.PathBuilder {
+			return (&yaml.PathBuilder{}).Root().Child("providers").Child(pid.String())
+		}
+
+		t := pid.Type()
+		switch t {
+		case "tracer", "meter", "logger":
+		default:
+			errs = append(errs, fmt.Errorf("%s: unknown provider type %q (want tracer, meter, or logger)", path().Build(), t))
+			continue
+		}
+		if p == nil {
+			continue
+		}
+
+		if len(p.Include) > 0 {
+			if len(p.Processors) > 0 || len(p.Exporters) > 0 {
+				errs = append(errs, fmt.Errorf("%s: include cannot be combined with processors or exporters", path().Build()))
+			}
+			for i, id := range p.Include {
+				if id.Type() != t {
+					errs = append(errs, fmt.Errorf("%s: include %q: not a %s", path().Child("include").Index(uint(i)).Build(), id.String(), t))
+				} else if _, _, ok := c.provider(id); !ok {
+					errs = append(errs, fmt.Errorf("%s: include %q: not defined", path().Child("include").Index(uint(i)).Build(), id.String()))
+				}
+			}
+			if err := c.checkIncludeCycle(pid); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", path().Child("include").Build(), err))
+			}
+		}
+
+		for i, id := range p.Processors {
+			used_processors[id] = true
+			if err := c.validateProcessor(ctx, t, id); err != nil {
+				errs = append(errs, fmt.Errorf("%s: processor %q: %w", path().Child("processors").Index(uint(i)).Build(), id.String(), err))
+			}
+		}
+		// Whether a processor wires each exporter in place of its own
+		// processor, and whether the exporter's processor is wrapped as it is.
+		wired, wrapped := false, false
+		switch t {
+		case "tracer":
+			wire, err := c.spanProcessor(p.Processors)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", path().Child("processors").Build(), err))
+			}
+			wired = wire != nil
+			wrapped = wire == nil && len(c.spanWrappers(p.Processors)) > 0
+		case "logger":
+			wire, err := c.logProcessor(p.Processors)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", path().Child("processors").Build(), err))
+			}
+			wired = wire != nil
+			wrapped = wire == nil && len(c.logWrappers(p.Processors)) > 0
+		}
+		for i, id := range p.Exporters {
+			used_exporters[id] = true
+			if err := c.validateExporter(ctx, t, id, wired, wrapped); err != nil {
+				errs = append(errs, fmt.Errorf("%s: exporter %q: %w", path().Child("exporters").Index(uint(i)).Build(), id.String(), err))
+			}
+		}
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(c.Processors)) {
+		if !used_processors[id] {
+			path := (&yaml.PathBuilder{}).Root().Child("processors").Child(id.String()).Build()
+			errs = append(errs, fmt.Errorf("%s: unused", path))
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(c.Exporters)) {
+		if !used_exporters[id] {
+			path := (&yaml.PathBuilder{}).Root().Child("exporters").Child(id.String()).Build()
+			errs = append(errs, fmt.Errorf("%s: unused", path))
+		}
+	}
+
+	if c.Resource != nil {
+		if _, err := c.Resource.detectors(); err != nil {
+			path := (&yaml.PathBuilder{}).Root().Child("resource").Build()
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	for i, name := range c.Propagators {
+		if _, ok := Propagators[name]; !ok {
+			path := (&yaml.PathBuilder{}).Root().Child("propagators").Index(uint(i)).Build()
+			errs = append(errs, fmt.Errorf("%s: unknown propagator %q", path, name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Config) validateProcessor(ctx context.Context, signal string, id Id) error {
+	if _, ok := c.Processors[id]; !ok {
+		return fmt.Errorf("not defined")
+	}
+
+	var err error
+	switch signal {
+	case "tracer":
+		_, err = c.tracerOpts(ctx, id)
+	case "meter":
+		_, err = c.meterOpts(ctx, id)
+	case "logger":
+		_, err = c.loggerOpts(ctx, id)
+	}
+	return err
+}
+
+func (c *Config) validateExporter(ctx context.Context, signal string, id Id, wired bool, wrapped bool) error {
+	if _, ok := c.Exporters[id]; !ok {
+		return fmt.Errorf("not defined")
+	}
+
+	var (
+		v   any
+		err error
+	)
+	switch signal {
+	case "tracer":
+		v, _, err = c.spanExporter(ctx, id)
+	case "meter":
+		v, _, err = c.metricExporter(ctx, id)
+	case "logger":
+		v, _, err = c.logExporter(ctx, id)
+	}
+	if errors.Is(err, ErrUnimplemented) {
+		return fmt.Errorf("not for the %s", signal)
+	}
+	if err != nil {
+		return err
+	}
+
+	if v, ok := v.(interface {
+		Shutdown(ctx context.Context) error
+	}); ok {
+		v.Shutdown(ctx)
+	}
+	if wired && storedOf(v) {
+		return errStorageBypassed
+	}
+	if wrapped {
+		// As the Resolver requires to wrap the processor.
+		switch v.(type) {
+		case spanComponent:
+		case logComponent:
+		default:
+			if signal == "tracer" {
+				return errors.New("its span processor cannot be wrapped")
+			}
+			return errors.New("its log processor cannot be wrapped")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package mkot_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/lesomnus/mkot"
+	"github.com/lesomnus/mkot/internal/x"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+type spanOnlyExporterConfig struct {
+	mkot.UnimplementedExporterConfig `yaml:"-"`
+
+	exporter *recordingSpanExporter
+}
+
+func (c *spanOnlyExporterConfig) SpanExporter(ctx context.Context) (trace.SpanExporter, []trace.TracerProviderOption, error) {
+	c.exporter = &recordingSpanExporter{}
+	return c.exporter, []trace.TracerProviderOption{trace.WithSyncer(c.exporter)}, nil
+}
+
+func TestConfigValidate(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := mkot.NewConfig()
+	c.Processors["sampler"] = &mkot.Sampler{}
+	c.Processors["resource"] = &mkot.Resource{}
+	c.Exporters["span"] = &spanOnlyExporterConfig{}
+	c.Providers["tracer"] = &mkot.ProviderConfig{
+		Processors: []mkot.Id{"sampler", "sampler/nope"},
+		Exporters:  []mkot.Id{"span"},
+	}
+	c.Providers["meter/foo"] = &mkot.ProviderConfig{
+		Processors: []mkot.Id{"sampler"},
+		Exporters:  []mkot.Id{"span", "otlp"},
+	}
+	c.Providers["tracker"] = &mkot.ProviderConfig{}
+	c.Propagators = []string{"tracecontext", "xray"}
+
+	err := c.Validate(ctx)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	errs := strings.Split(err.Error(), "\n")
+	x.Eq([]string{
+		`$.providers.meter/foo.processors[0]: processor "sampler": not for the meter`,
+		`$.providers.meter/foo.exporters[0]: exporter "span": not for the meter`,
+		`$.providers.meter/foo.exporters[1]: exporter "otlp": not defined`,
+		`$.providers.tracer.processors[1]: processor "sampler/nope": not defined`,
+		`$.providers.tracker: unknown provider type "tracker" (want tracer, meter, or logger)`,
+		`$.processors.resource: unused`,
+		`$.propagators[1]: unknown propagator "xray"`,
+	}, errs)
+}
+
+func TestConfigValidateOk(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := mkot.NewConfig()
+	c.Processors["sampler"] = &mkot.Sampler{}
+	c.Exporters["span"] = &spanOnlyExporterConfig{}
+	c.Providers["tracer"] = &mkot.ProviderConfig{
+		Processors: []mkot.Id{"sampler"},
+		Exporters:  []mkot.Id{"span"},
+	}
+	x.NoError(c.Validate(ctx))
+}
+
+func TestConfigValidateWrappers(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := mkot.NewConfig()
+	c.Processors["attributes"] = &mkot.Attributes{Actions: []mkot.AttributeAction{{Key: "k", Action: "delete"}}}
+	c.Processors["filter"] = &mkot.Filter{Logs: &mkot.FilterConfig{Exclude: &mkot.MatchConfig{LogBodies: []string{"noise"}}}}
+	c.Processors["batch"] = &mkot.Batch{}
+	c.Exporters["span"] = &spanOnlyExporterConfig{}
+	c.Exporters["log"] = &recordingLogExporterConfig{}
+	c.Exporters["component"] = &componentExporterConfig{}
+	c.Providers["tracer"] = &mkot.ProviderConfig{
+		Processors: []mkot.Id{"attributes"},
+		Exporters:  []mkot.Id{"component", "span"},
+	}
+	c.Providers["tracer/batched"] = &mkot.ProviderConfig{
+		// The batch processor wires a processor that can be wrapped.
+		Processors: []mkot.Id{"attributes", "batch"},
+		Exporters:  []mkot.Id{"span"},
+	}
+	c.Providers["logger"] = &mkot.ProviderConfig{
+		Processors: []mkot.Id{"filter"},
+		Exporters:  []mkot.Id{"log"},
+	}
+
+	err := c.Validate(ctx)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	errs := strings.Split(err.Error(), "\n")
+	x.Eq([]string{
+		`$.providers.logger.exporters[0]: exporter "log": its log processor cannot be wrapped`,
+		`$.providers.tracer.exporters[1]: exporter "span": its span processor cannot be wrapped`,
+	}, errs)
+
+	// The Resolver reports the same.
+	r := mkot.Make(ctx, c)
+	defer r.Shutdown(ctx)
+	_, err = r.Tracer(ctx, "")
+	x.Contains(err.Error(), `exporter "span": its span processor cannot be wrapped`)
+	_, err = r.Tracer(ctx, "batched")
+	x.NoError(err)
+}
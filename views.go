@@ -0,0 +1,252 @@
+package mkot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric"
+)
+
+// Views configures the metric streams of a meter provider. Each view applies
+// its stream overrides to the instruments its selector matches; an instrument
+// no view matches keeps its default stream.
+type Views struct {
+	UnimplementedProcessorConfig `yaml:"-"`
+
+	Views []ViewConfig `yaml:"views,omitempty"`
+
+	// CardinalityLimit is the number of attribute sets a stream keeps in a
+	// collection cycle. The SDK default is 2000, and zero or a negative value
+	// means no limit.
+	CardinalityLimit *int `yaml:"cardinality_limit,omitempty"`
+}
+
+type ViewConfig struct {
+	Selector ViewSelector `yaml:"selector"`
+	Stream   ViewStream   `yaml:"stream"`
+}
+
+// ViewSelector matches the instruments whose properties equal every one
+// given.
+type ViewSelector struct {
+	// InstrumentName matches the name of the instrument, where "*" matches
+	// any characters and "?" any single character.
+	InstrumentName string `yaml:"instrument_name,omitempty"`
+
+	// InstrumentType is one of "counter", "up_down_counter", "histogram",
+	// "gauge", "observable_counter", "observable_up_down_counter", or
+	// "observable_gauge".
+	InstrumentType string `yaml:"instrument_type,omitempty"`
+
+	Unit           string `yaml:"unit,omitempty"`
+	MeterName      string `yaml:"meter_name,omitempty"`
+	MeterVersion   string `yaml:"meter_version,omitempty"`
+	MeterSchemaUrl string `yaml:"meter_schema_url,omitempty"`
+}
+
+// ViewStream overrides the properties given of the streams.
+type ViewStream struct {
+	// Name renames the stream. It requires an instrument_name without
+	// wildcards, since streams must not share a name.
+	Name        string `yaml:"name,omitempty"`
+	Description string `yaml:"description,omitempty"`
+
+	Aggregation   *ViewAggregation   `yaml:"aggregation,omitempty"`
+	AttributeKeys *ViewAttributeKeys `yaml:"attribute_keys,omitempty"`
+}
+
+// ViewAggregation sets the aggregation of the streams. Exactly one of its
+// properties is given, as an empty mapping if it has no settings.
+type ViewAggregation struct {
+	Default                         *struct{}                        `yaml:"default,omitempty"`
+	Drop                            *struct{}                        `yaml:"drop,omitempty"`
+	Sum                             *struct{}                        `yaml:"sum,omitempty"`
+	LastValue                       *struct{}                        `yaml:"last_value,omitempty"`
+	ExplicitBucketHistogram         *ExplicitBucketHistogram         `yaml:"explicit_bucket_histogram,omitempty"`
+	Base2ExponentialBucketHistogram *Base2ExponentialBucketHistogram `yaml:"base2_exponential_bucket_histogram,omitempty"`
+}
+
+type ExplicitBucketHistogram struct {
+	// Boundaries are the increasing upper bounds of the buckets. The SDK
+	// defaults are used if none are given.
+	Boundaries   []float64 `yaml:"boundaries,omitempty"`
+	RecordMinMax *bool     `yaml:"record_min_max,omitempty"`
+}
+
+type Base2ExponentialBucketHistogram struct {
+	// MaxSize is the number of buckets for each of the positive and negative
+	// ranges. Defaults to 160.
+	MaxSize int32 `yaml:"max_size,omitempty"`
+
+	// MaxScale is the resolution the histogram starts at, from -10 to 20.
+	// Defaults to 20.
+	MaxScale *int32 `yaml:"max_scale,omitempty"`
+
+	RecordMinMax *bool `yaml:"record_min_max,omitempty"`
+}
+
+// ViewAttributeKeys keeps the attributes listed in Included, if given, and not
+// listed in Excluded.
+type ViewAttributeKeys struct {
+	Included []string `yaml:"included,omitempty"`
+	Excluded []string `yaml:"excluded,omitempty"`
+}
+
+func (c *Views) MeterOpts(ctx context.Context) ([]metric.Option, error) {
+	opts := []metric.Option{}
+	errs := []error{}
+	for i, v := range c.Views {
+		view, err := v.view()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("views[%d]: %w", i, err))
+			continue
+		}
+		opts = append(opts, metric.WithView(view))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	if c.CardinalityLimit != nil {
+		opts = append(opts, metric.WithCardinalityLimit(*c.CardinalityLimit))
+	}
+	return opts, nil
+}
+
+var instrumentKinds = map[string]metric.InstrumentKind{
+	"counter":                    metric.InstrumentKindCounter,
+	"up_down_counter":            metric.InstrumentKindUpDownCounter,
+	"histogram":                  metric.InstrumentKindHistogram,
+	"gauge":                      metric.InstrumentKindGauge,
+	"observable_counter":         metric.InstrumentKindObservableCounter,
+	"observable_up_down_counter": metric.InstrumentKindObservableUpDownCounter,
+	"observable_gauge":           metric.InstrumentKindObservableGauge,
+}
+
+func (c ViewConfig) view() (metric.View, error) {
+	criteria := metric.Instrument{
+		Name: c.Selector.InstrumentName,
+		Unit: c.Selector.Unit,
+		Scope: instrumentation.Scope{
+			Name:      c.Selector.MeterName,
+			Version:   c.Selector.MeterVersion,
+			SchemaURL: c.Selector.MeterSchemaUrl,
+		},
+	}
+	if c.Selector.InstrumentType != "" {
+		k, ok := instrumentKinds[c.Selector.InstrumentType]
+		if !ok {
+			return nil, fmt.Errorf("selector: unknown instrument_type %q", c.Selector.InstrumentType)
+		}
+		criteria.Kind = k
+	}
+	if criteria.IsEmpty() {
+		return nil, errors.New("selector: no properties to match")
+	}
+	if c.Stream.Name != "" && (criteria.Name == "" || strings.ContainsAny(criteria.Name, "*?")) {
+		return nil, errors.New("stream: name requires a selector instrument_name without wildcards")
+	}
+
+	mask := metric.Stream{
+		Name:        c.Stream.Name,
+		Description: c.Stream.Description,
+	}
+	if c.Stream.Aggregation != nil {
+		a, err := c.Stream.Aggregation.aggregation()
+		if err != nil {
+			return nil, fmt.Errorf("stream: aggregation: %w", err)
+		}
+		mask.Aggregation = a
+	}
+	if keys := c.Stream.AttributeKeys; keys != nil {
+		mask.AttributeFilter = keys.filter()
+	}
+	return metric.NewView(criteria, mask), nil
+}
+
+func (c *ViewAggregation) aggregation() (metric.Aggregation, error) {
+	vs := []metric.Aggregation{}
+	if c.Default != nil {
+		vs = append(vs, metric.AggregationDefault{})
+	}
+	if c.Drop != nil {
+		vs = append(vs, metric.AggregationDrop{})
+	}
+	if c.Sum != nil {
+		vs = append(vs, metric.AggregationSum{})
+	}
+	if c.LastValue != nil {
+		vs = append(vs, metric.AggregationLastValue{})
+	}
+	if h := c.ExplicitBucketHistogram; h != nil {
+		if !slices.IsSorted(h.Boundaries) || len(slices.Compact(slices.Clone(h.Boundaries))) != len(h.Boundaries) {
+			return nil, errors.New("explicit_bucket_histogram: boundaries must be increasing")
+		}
+		a := metric.AggregationExplicitBucketHistogram{
+			Boundaries: h.Boundaries,
+			NoMinMax:   h.RecordMinMax != nil && !*h.RecordMinMax,
+		}
+		if a.Boundaries == nil {
+			a.Boundaries = defaultHistogramBoundaries
+		}
+		vs = append(vs, a)
+	}
+	if h := c.Base2ExponentialBucketHistogram; h != nil {
+		a := metric.AggregationBase2ExponentialHistogram{
+			MaxSize:  160,
+			MaxScale: 20,
+			NoMinMax: h.RecordMinMax != nil && !*h.RecordMinMax,
+		}
+		if h.MaxSize < 0 {
+			return nil, errors.New("base2_exponential_bucket_histogram: max_size must be positive")
+		} else if h.MaxSize > 0 {
+			a.MaxSize = h.MaxSize
+		}
+		if h.MaxScale != nil {
+			if *h.MaxScale < -10 || *h.MaxScale > 20 {
+				return nil, errors.New("base2_exponential_bucket_histogram: max_scale must be from -10 to 20")
+			}
+			a.MaxScale = *h.MaxScale
+		}
+		vs = append(vs, a)
+	}
+
+	switch len(vs) {
+	case 0:
+		return nil, errors.New("no aggregation given")
+	case 1:
+		return vs[0], nil
+	default:
+		return nil, errors.New("only one aggregation can be given")
+	}
+}
+
+// defaultHistogramBoundaries are the boundaries the SDK uses by default.
+var defaultHistogramBoundaries = []float64{0, 5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000}
+
+func (c *ViewAttributeKeys) filter() attribute.Filter {
+	included := map[attribute.Key]bool{}
+	for _, k := range c.Included {
+		included[attribute.Key(k)] = true
+	}
+	excluded := map[attribute.Key]bool{}
+	for _, k := range c.Excluded {
+		excluded[attribute.Key(k)] = true
+	}
+	return func(kv attribute.KeyValue) bool {
+		if c.Included != nil && !included[kv.Key] {
+			return false
+		}
+		return !excluded[kv.Key]
+	}
+}
+
+func init() {
+	DefaultProcessorRegistry.Set("views", func() ProcessorConfig {
+		return &Views{}
+	})
+}
@@ -0,0 +1,146 @@
+package mkot_test
+
+import (
+	"testing"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lesomnus/mkot"
+	"github.com/lesomnus/mkot/internal/x"
+	"go.opentelemetry.io/otel/attribute"
+	ometric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestViews(t *testing.T) {
+	ctx, x := x.New(t)
+
+	reader := &manualReaderConfig{}
+	c := mkot.NewConfig()
+	err := yaml.Unmarshal([]byte(`
+processors:
+  views:
+    cardinality_limit: 3
+    views:
+      - selector:
+          instrument_name: requests
+          meter_name: app
+        stream:
+          name: http.requests
+          attribute_keys:
+            excluded: [user.id]
+      - selector:
+          instrument_name: "*.duration"
+          instrument_type: histogram
+          unit: ms
+        stream:
+          aggregation:
+            explicit_bucket_histogram:
+              boundaries: [10, 100]
+              record_min_max: false
+      - selector:
+          instrument_name: size
+        stream:
+          aggregation:
+            base2_exponential_bucket_histogram:
+              max_size: 20
+              max_scale: 5
+`), c)
+	x.NoError(err)
+	c.Exporters["reader"] = reader
+	c.Providers = map[mkot.Id]*mkot.ProviderConfig{
+		"meter": {Processors: []mkot.Id{"views"}, Exporters: []mkot.Id{"reader"}},
+	}
+	x.NoError(c.Validate(ctx))
+
+	r := mkot.Make(ctx, c)
+	mp, err := r.Meter(ctx, "")
+	x.NoError(err)
+
+	m := mp.Meter("app")
+	requests, err := m.Int64Counter("requests")
+	x.NoError(err)
+	requests.Add(ctx, 1, ometric.WithAttributes(attribute.String("method", "GET"), attribute.String("user.id", "dwight")))
+	requests.Add(ctx, 1, ometric.WithAttributes(attribute.String("method", "GET"), attribute.String("user.id", "jim")))
+	duration, err := m.Float64Histogram("http.duration", ometric.WithUnit("ms"))
+	x.NoError(err)
+	duration.Record(ctx, 42)
+	size, err := m.Float64Histogram("size")
+	x.NoError(err)
+	size.Record(ctx, 3)
+	users, err := m.Int64Counter("users")
+	x.NoError(err)
+	for _, u := range []string{"a", "b", "c", "d", "e"} {
+		users.Add(ctx, 1, ometric.WithAttributes(attribute.String("user", u)))
+	}
+
+	rm := metricdata.ResourceMetrics{}
+	x.NoError(reader.reader.Collect(ctx, &rm))
+	ms := map[string]metricdata.Metrics{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			ms[m.Name] = m
+		}
+	}
+
+	_, ok := ms["requests"]
+	x.Eq(false, ok)
+	sum := ms["http.requests"].Data.(metricdata.Sum[int64])
+	x.Eq(1, len(sum.DataPoints))
+	x.Eq(int64(2), sum.DataPoints[0].Value)
+	x.Eq(attribute.NewSet(attribute.String("method", "GET")), sum.DataPoints[0].Attributes)
+
+	hist := ms["http.duration"].Data.(metricdata.Histogram[float64])
+	x.Eq([]float64{10, 100}, hist.DataPoints[0].Bounds)
+	x.Eq([]uint64{0, 1, 0}, hist.DataPoints[0].BucketCounts)
+	_, ok = hist.DataPoints[0].Min.Value()
+	x.Eq(false, ok)
+
+	expo := ms["size"].Data.(metricdata.ExponentialHistogram[float64])
+	x.Eq(int32(5), expo.DataPoints[0].Scale)
+
+	// The limit keeps one set for the overflow.
+	x.Eq(3, len(ms["users"].Data.(metricdata.Sum[int64]).DataPoints))
+	x.NoError(r.Shutdown(ctx))
+}
+
+func TestViewsInvalid(t *testing.T) {
+	ctx, x := x.New(t)
+
+	c := mkot.NewConfig()
+	err := yaml.Unmarshal([]byte(`
+processors:
+  views:
+    views:
+      - selector: {}
+      - selector:
+          instrument_name: "*"
+        stream:
+          name: all
+      - selector:
+          instrument_type: timer
+      - selector:
+          instrument_name: h
+        stream:
+          aggregation:
+            explicit_bucket_histogram:
+              boundaries: [10, 5]
+      - selector:
+          instrument_name: h
+        stream:
+          aggregation:
+            sum: {}
+            drop: {}
+`), c)
+	x.NoError(err)
+	c.Exporters["reader"] = &manualReaderConfig{}
+	c.Providers = map[mkot.Id]*mkot.ProviderConfig{
+		"meter": {Processors: []mkot.Id{"views"}, Exporters: []mkot.Id{"reader"}},
+	}
+
+	err = c.Validate(ctx)
+	x.Contains(err.Error(), "views[0]: selector: no properties to match")
+	x.Contains(err.Error(), "views[1]: stream: name requires a selector instrument_name without wildcards")
+	x.Contains(err.Error(), `views[2]: selector: unknown instrument_type "timer"`)
+	x.Contains(err.Error(), "views[3]: stream: aggregation: explicit_bucket_histogram: boundaries must be increasing")
+	x.Contains(err.Error(), "views[4]: stream: aggregation: only one aggregation can be given")
+}